@@ -25,23 +25,27 @@ import (
 	"github.com/denverdino/aliyungo/cen"
 	"github.com/denverdino/aliyungo/common"
 	"github.com/denverdino/aliyungo/ecs"
+	"github.com/denverdino/aliyungo/pvtz"
 	"github.com/denverdino/aliyungo/slb"
 	"io"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/cloud-provider"
 	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/controller/node"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/controller/privatezone"
 	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/controller/route"
 	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
 	"k8s.io/klog"
 	controller "k8s.io/kube-aggregator/pkg/controllers"
 	"math/rand"
-	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -83,10 +87,28 @@ var (
 
 	DEFAULT_NODE_ADDR_SYNC_PERIOD = 240 * time.Second
 
+	// DEFAULT_PRIVATE_ZONE_RECONCILE_PERIOD period to repair private zone records which drift
+	DEFAULT_PRIVATE_ZONE_RECONCILE_PERIOD = 5 * time.Minute
+
 	// DEFAULT_REGION should be override in cloud initialize.
 	DEFAULT_REGION = common.Hangzhou
+
+	// LoadBalancerClass loadbalancer class owned by the service controller,
+	// set from --load-balancer-class before the cloud is initialized.
+	LoadBalancerClass string
 )
 
+// serviceLocks locks of services. EnsureLoadBalancer, EnsureLoadBalancerDeleted
+// and the periodic repair of private zone records of a service are serialized.
+var serviceLocks sync.Map
+
+// lockService lock the service and return the unlock func.
+func lockService(service *v1.Service) func() {
+	lock, _ := serviceLocks.LoadOrStore(service.UID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
 // CloudConfig wraps the settings for the Alicloud provider.
 type CloudConfig struct {
 	Global struct {
@@ -104,6 +126,23 @@ type CloudConfig struct {
 		CenID                string `json:"cenid"`
 
 		DisablePublicSLB bool `json:"disablePublicSLB"`
+		// RetainLoadBalancerOnDelete keep slb on service deletion unless retain-on-delete annotation is off.
+		RetainLoadBalancerOnDelete bool `json:"retainLoadBalancerOnDelete"`
+		// NamespaceQuotas limits slb created per namespace, key "*" applies to the others.
+		NamespaceQuotas map[string]NamespaceQuota `json:"namespaceQuotas"`
+		// VswitchIDs candidate vswitches of intranet slb, the one with the most available ips is used.
+		VswitchIDs []string `json:"vswitchIDs"`
+		// VswitchTags select candidate vswitches of intranet slb by tags.
+		VswitchTags map[string]string `json:"vswitchTags"`
+		// PrivateZoneAutoCreate create the private zone named by private-zone-name
+		// unless private-zone-auto-create annotation is off.
+		PrivateZoneAutoCreate bool `json:"privateZoneAutoCreate"`
+		// PrivateZoneVpcIDs vpcs bound to the private zones besides the cluster vpc when
+		// auto create is enabled, in the format of vpcid or region:vpcid.
+		PrivateZoneVpcIDs []string `json:"privateZoneVpcIDs"`
+		// PrivateZoneReconcilePeriod period in seconds to repair private zone
+		// records which drift, negative value disables the repair.
+		PrivateZoneReconcilePeriod int64 `json:"privateZoneReconcilePeriod"`
 
 		AccessKeyID     string `json:"accessKeyID"`
 		AccessKeySecret string `json:"accessKeySecret"`
@@ -183,24 +222,40 @@ func newAliCloud(mgr *ClientMgr, rtableids string) (*Cloud, error) {
 		return nil, fmt.Errorf("set vpc info error: %s", err.Error())
 	}
 	mgr.Routes().WithCEN(cfg.Global.CenID)
-	return &Cloud{
+	cloud := &Cloud{
 		climgr: mgr,
 		region: common.Region(region),
 		vpcID:  vpc,
 		cfg:    &cfg,
-	}, nil
+	}
+	// quota of namespace is counted across regions of its services
+	mgr.LoadBalancers().usage = cloud.namespaceUsage
+	return cloud, nil
 }
 
 // Initialize passes a Kubernetes clientBuilder interface to the cloud provider
 func (c *Cloud) Initialize(builder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
 	c.kclient = builder.ClientOrDie("shared-informers")
 	shared := informers.NewSharedInformerFactory(c.kclient, syncPeriod())
+
+	// restore private zone records created before restart, and delete
+	// records of the services deleted since then
+	err := GetPrivateZoneRecordCache().restore(context.Background(), newServiceRecordBackend(c.kclient))
+	if err != nil {
+		klog.Warningf("alicloud: restore private zone records: %s", err.Error())
+	}
+	go wait.Until(func() {
+		if err := c.collectPrivateZoneRecords(context.Background()); err != nil {
+			klog.Warningf("alicloud: %s", err.Error())
+		}
+	}, PRIVATE_ZONE_RECORD_GC_PERIOD, stop)
+
 	if route.Options.ConfigCloudRoutes {
 		cidr := route.Options.ClusterCIDR
 		if len(strings.TrimSpace(cidr)) == 0 {
 			panic(fmt.Sprintf("ivalid cluster CIDR %s", cidr))
 		}
-		_, cidrc, err := net.ParseCIDR(cidr)
+		cidrs, err := route.ParseClusterCIDRs(cidr)
 		if err != nil {
 			panic(fmt.Sprintf("Unsuccessful parsing of cluster CIDR %v: %v", cidr, err))
 		}
@@ -210,10 +265,19 @@ func (c *Cloud) Initialize(builder cloudprovider.ControllerClientBuilder, stop <
 			clusterid = c.cfg.Global.KubernetesClusterTag
 		}
 
+		subnets, err := route.NewNodeSubnetProvider(
+			route.Options.NodeSubnetSource,
+			route.Options.NodeSubnetAnnotation,
+			builder.ConfigOrDie(route.ROUTE_CONTROLLER),
+		)
+		if err != nil {
+			panic(fmt.Sprintf("unable to initialize node subnet source, %s", err.Error()))
+		}
+
 		ctrl, err := route.New(
 			c, builder.ClientOrDie(route.ROUTE_CONTROLLER),
 			shared.Core().V1().Nodes(),
-			clusterid, cidrc, c.cfg.Global.CenID,
+			clusterid, cidrs, c.cfg.Global.CenID, subnets,
 		)
 		if err != nil {
 			panic(fmt.Sprintf("unable to initialize route controller, %s", err.Error()))
@@ -245,6 +309,25 @@ func (c *Cloud) Initialize(builder cloudprovider.ControllerClientBuilder, stop <
 		)
 		go nctrl.Run(stop)
 	}()
+
+	// run private zone controller for services which are not of LoadBalancer type,
+	// records of all services which drift are repaired periodically
+	pvtzReconcilePeriod := DEFAULT_PRIVATE_ZONE_RECONCILE_PERIOD
+	if c.cfg != nil &&
+		c.cfg.Global.PrivateZoneReconcilePeriod != 0 {
+		pvtzReconcilePeriod = time.Duration(c.cfg.Global.PrivateZoneReconcilePeriod * int64(time.Second))
+	}
+	pctrl, err := privatezone.New(
+		c, builder.ClientOrDie(privatezone.PVTZ_CONTROLLER),
+		shared.Core().V1().Services(),
+		shared.Core().V1().Endpoints(),
+		pvtzReconcilePeriod,
+		LoadBalancerClass,
+	)
+	if err != nil {
+		panic(fmt.Sprintf("unable to initialize private zone controller, %s", err.Error()))
+	}
+	go pctrl.Run(stop, 1)
 	inform := shared.Core().V1().Endpoints().Informer()
 	shared.Start(stop)
 	if !controller.WaitForCacheSync(
@@ -273,22 +356,42 @@ func (c *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, ser
 // TODO: Break this up into different interfaces (LB, etc) when we have more than one type of service
 func (c *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
 
-	exists, lb, err := c.climgr.LoadBalancers().FindLoadBalancer(ctx, service)
+	regional := c.climgr.Regional(getLoadBalancerRegion(service))
+	exists, lb, err := regional.LoadBalancers().FindLoadBalancer(ctx, service)
 
 	if err != nil || !exists {
 		return nil, exists, err
 	}
 
-	zone, record, _, err := c.climgr.PrivateZones().findExactRecordByService(ctx, service, lb.Address, lb.AddressIPVersion)
+	zone, record, _, err := regional.PrivateZones().findExactRecordByService(ctx, service, lb.Address, lb.AddressIPVersion)
 	if err != nil {
 		return nil, exists, err
 	}
 
-	return &v1.LoadBalancerStatus{
+	status = &v1.LoadBalancerStatus{
 		Ingress: []v1.LoadBalancerIngress{{
 			IP:       lb.Address,
 			Hostname: getHostName(zone, record),
-		}}}, true, nil
+		}}}
+	if !isDualStack(service) {
+		return status, true, nil
+	}
+
+	ipv6 := dualStackIPv6Service(service)
+	exists, lb, err = regional.LoadBalancers().FindLoadBalancer(ctx, ipv6)
+	if err != nil || !exists {
+		return status, true, err
+	}
+	zone, record, _, err = regional.PrivateZones().findExactRecordByService(ctx, ipv6, lb.Address, lb.AddressIPVersion)
+	if err != nil {
+		return nil, true, err
+	}
+	status.Ingress = append(status.Ingress,
+		v1.LoadBalancerIngress{
+			IP:       lb.Address,
+			Hostname: getHostName(zone, record),
+		})
+	return status, true, nil
 }
 
 // EnsureLoadBalancer creates a new load balancer 'name', or updates the existing one. Returns the status of the balancer
@@ -304,6 +407,7 @@ func (c *Cloud) EnsureLoadBalancer(
 
 	klog.V(2).Infof("Alicloud.EnsureLoadBalancer(%v, %s/%s, %v, %v)",
 		clusterName, service.Namespace, service.Name, c.region, NodeList(nodes))
+	defer lockService(service)()
 	defaulted, _ := ExtractAnnotationRequest(service)
 	if defaulted.AddressType == slb.InternetAddressType {
 		if c.cfg != nil && c.cfg.Global.DisablePublicSLB {
@@ -319,8 +423,15 @@ func (c *Cloud) EnsureLoadBalancer(
 	if len(service.Spec.Ports) == 0 {
 		return nil, fmt.Errorf("requested load balancer with no ports")
 	}
+	if isRequireDualStack(service) && !isDualStack(service) {
+		return nil, fmt.Errorf("dual stack is not supported by user assigned or shared loadbalancer")
+	}
+	if err := checkRegionalLoadBalancer(service, defaulted); err != nil {
+		return nil, err
+	}
 	vswitchid := defaulted.VswitchID
-	if vswitchid == "" {
+	if vswitchid == "" && defaulted.Region == DEFAULT_REGION && !c.climgr.LoadBalancers().vswitch.Enabled() {
+		// vswitch is selected from candidates on creation when configured
 		var err error
 		vswitchid, err = c.climgr.MetaData().VswitchID()
 		if err != nil {
@@ -356,8 +467,137 @@ func (c *Cloud) EnsureLoadBalancer(
 
 	utils.Logf(service, "using vswitch id=%s", vswitchid)
 
+	regional := c.climgr.Regional(defaulted.Region)
+	status, err := c.ensureServiceLoadBalancers(ctx, regional, service, backends, vswitchid)
+	if err != nil {
+		return status, err
+	}
+	published := getPublishedDNS(service)
+	if !isPublicDNSEnabled(service) && published == nil {
+		return status, nil
+	}
+	err = c.ensurePublicDNS(ctx, service, status, published)
+	return status, utils.RecordCondition(ctx, utils.ConditionDNSRecordSynced,
+		"PublicDNSRecordSyncFailed", err)
+}
+
+// ensurePublicDNS publish the public ips of the service. Records published
+// before are deleted when the domain or rr changed, or the annotation is
+// removed. The published records are recorded in the resources annotation.
+func (c *Cloud) ensurePublicDNS(
+	ctx context.Context,
+	service *v1.Service,
+	status *v1.LoadBalancerStatus,
+	published *utils.PublicDNSResource,
+) error {
+	client := c.climgr.PublicDNS()
+	if client == nil {
+		return fmt.Errorf("alicloud: public dns client is not initialized")
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	// records of service without the resources annotation are found by ingress
+	previous := ingressIPs(&service.Status.LoadBalancer)
+	if published != nil {
+		previous = published.IPs
+		if !isPublicDNSEnabled(service) ||
+			published.Domain != defaulted.PublicDNSDomain ||
+			published.Rr != defaulted.PublicDNSRR {
+			err := client.EnsurePublicDNSRecordsDeleted(ctx, service, published.Domain, published.Rr, published.IPs)
+			if err != nil {
+				return err
+			}
+			previous = nil
+		}
+	}
+	if !isPublicDNSEnabled(service) {
+		return nil
+	}
+	ips := publicIPs(service, status)
+	if err := client.EnsurePublicDNSRecords(ctx, service, ips, previous); err != nil {
+		return err
+	}
+	recordPublishedDNS(ctx,
+		&utils.PublicDNSResource{
+			Domain: defaulted.PublicDNSDomain,
+			Rr:     defaulted.PublicDNSRR,
+			IPs:    ips,
+		})
+	return nil
+}
+
+// checkRegionalLoadBalancer backends of the cluster, ecs and eni alike, are in
+// the vpc of the cluster region and can not be attached to slb in other regions,
+// so slb is only provisioned in the cluster region. Region of slb can not be
+// changed once created, slb recorded in another region is deleted from there.
+func checkRegionalLoadBalancer(service *v1.Service, defaulted *AnnotationRequest) error {
+	if recorded := getRecordedRegion(service); recorded != "" && recorded != defaulted.Region {
+		return fmt.Errorf("alicloud: region of loadbalancer can not be changed from %s to %s, "+
+			"restore annotation %s, or delete the service and create it again",
+			recorded, defaulted.Region, ServiceAnnotationLoadBalancerRegion)
+	}
+	if defaulted.Region != DEFAULT_REGION {
+		return fmt.Errorf("alicloud: loadbalancer in region %s is not supported, backends in "+
+			"the vpc of the cluster in region %s can not be attached to it", defaulted.Region, DEFAULT_REGION)
+	}
+	return nil
+}
+
+// getLoadBalancerRegion region of the existing slb of the service, which is the
+// region recorded by the last reconcile, or the region annotation otherwise.
+func getLoadBalancerRegion(service *v1.Service) common.Region {
+	if recorded := getRecordedRegion(service); recorded != "" {
+		return recorded
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return defaulted.Region
+}
+
+// ensureServiceLoadBalancers ensure the slb of the service, and the ipv6 slb
+// of dual stack service.
+func (c *Cloud) ensureServiceLoadBalancers(
+	ctx context.Context,
+	regional *RegionalClient,
+	service *v1.Service,
+	backends *EndpointWithENI,
+	vswitchid string,
+) (*v1.LoadBalancerStatus, error) {
+	if !isDualStack(service) {
+		// ipv6 slb is left over when dual stack service turns into single stack
+		if hasDualStackIngress(service) {
+			if err := c.ensureDualStackIPv6Deleted(ctx, regional, service); err != nil {
+				return nil, err
+			}
+		}
+		return c.ensureLoadBalancer(ctx, regional, service, backends, vswitchid)
+	}
+
+	status, err := c.ensureLoadBalancer(ctx, regional, service, backends, vswitchid)
+	if err != nil {
+		return nil, err
+	}
+	ipv6, err := c.ensureLoadBalancer(ctx, regional, dualStackIPv6Service(service), backends, vswitchid)
+	if err != nil {
+		if err := dualStackFailed(ctx, service, err); err != nil {
+			return nil, err
+		}
+		return status, nil
+	}
+	status.Ingress = append(status.Ingress, ipv6.Ingress...)
+	return status, nil
+}
+
+// ensureLoadBalancer ensure the slb and private zone record of the service.
+func (c *Cloud) ensureLoadBalancer(
+	ctx context.Context,
+	regional *RegionalClient,
+	service *v1.Service,
+	backends *EndpointWithENI,
+	vswitchid string,
+) (*v1.LoadBalancerStatus, error) {
+	defaulted, _ := ExtractAnnotationRequest(service)
+
 	// EnsureLoadBalancer with EndpointWithENI
-	lb, err := c.climgr.
+	lb, err := regional.
 		LoadBalancers().
 		EnsureLoadBalancer(
 			ctx, service, backends, vswitchid,
@@ -370,20 +610,26 @@ func (c *Cloud) EnsureLoadBalancer(
 
 	// EIP ExternalIPType, display the slb associated elastic ip as service external ip
 	if defaulted.ExternalIPType == string(EIPExternalIPType) {
-		status.Ingress, err = c.setEIPAsExternalIP(ctx, lb.LoadBalancerId)
+		status.Ingress, err = c.setEIPAsExternalIP(ctx, regional.Instances(), defaulted.Region, lb.LoadBalancerId)
 	}
 
 	// SLB ExternalIPType, display the slb ip as service external ip
 	// If the length of elastic ip is 0, display the slb ip
+	var (
+		pz  *pvtz.DescribeZoneInfoResponse
+		pzr *pvtz.ZoneRecordType
+	)
 	if len(status.Ingress) == 0 {
-		pz, pzr, err := c.climgr.
+		zone, record, err := regional.
 			PrivateZones().
 			EnsurePrivateZoneRecord(
 				ctx, service, lb.Address, defaulted.AddressIPVersion,
 			)
-		if err != nil {
+		if err := utils.RecordCondition(ctx, utils.ConditionDNSRecordSynced,
+			"DNSRecordSyncFailed", err); err != nil {
 			return nil, err
 		}
+		pz, pzr = zone, record
 		status.Ingress = append(status.Ingress,
 			v1.LoadBalancerIngress{
 				IP:       lb.Address,
@@ -391,7 +637,17 @@ func (c *Cloud) EnsureLoadBalancer(
 			})
 
 	}
-	return status, err
+	if pzr == nil {
+		// no private zone is configured, or eip is used as external ip
+		if conditions, cerr := utils.GetConditionsFromContext(ctx); cerr == nil {
+			conditions.Skip(utils.ConditionDNSRecordSynced, "NotRequired")
+		}
+	}
+	if err != nil {
+		return status, err
+	}
+	recordRelatedResources(ctx, service, regional.Instances(), lb, pz, pzr)
+	return status, nil
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
@@ -433,7 +689,31 @@ func (c *Cloud) UpdateLoadBalancer(
 		Nodes:          ns,
 		BackendTypeENI: IsENIBackendType(service),
 	}
-	return c.climgr.LoadBalancers().UpdateLoadBalancer(ctx, service, backends, true)
+	defaulted, _ := ExtractAnnotationRequest(service)
+	lbs := c.climgr.Regional(defaulted.Region).LoadBalancers()
+	if err := lbs.UpdateLoadBalancer(ctx, service, backends, true); err != nil {
+		return err
+	}
+	if !isDualStack(service) {
+		return nil
+	}
+
+	ipv6 := dualStackIPv6Service(service)
+	exists, _, err := lbs.FindLoadBalancer(ctx, ipv6)
+	if err != nil {
+		return dualStackFailed(ctx, service, err)
+	}
+	if !exists {
+		// ipv6 slb is optional for PreferDualStack service, it is created by EnsureLoadBalancer
+		if isRequireDualStack(service) {
+			return fmt.Errorf("ipv6 loadbalancer of dual stack service does not exist")
+		}
+		return nil
+	}
+	if err := lbs.UpdateLoadBalancer(ctx, ipv6, backends, true); err != nil {
+		return dualStackFailed(ctx, service, err)
+	}
+	return nil
 }
 
 // EnsureLoadBalancerDeleted deletes the specified load balancer if it
@@ -451,17 +731,42 @@ func (c *Cloud) EnsureLoadBalancerDeleted(
 ) error {
 	klog.V(2).Infof("Alicloud.EnsureLoadBalancerDeleted(%v, %v, %v, %v, %v, %v)",
 		clusterName, service.Namespace, service.Name, c.region, service.Spec.LoadBalancerIP, service.Spec.Ports)
+	// the lock is released before the entry is deleted
+	defer serviceLocks.Delete(service.UID)
+	defer lockService(service)()
 
 	defaulted, _ := ExtractAnnotationRequest(service)
+	// slb left in the previous region is deleted when region annotation changed
+	regional := c.climgr.Regional(getLoadBalancerRegion(service))
+
+	// ipv6 slb and AAAA record of dual stack service are deleted together
+	if isDualStack(service) || hasDualStackIngress(service) {
+		if err := c.ensureDualStackIPv6Deleted(ctx, regional, service); err != nil {
+			return err
+		}
+	}
+
+	if client := c.climgr.PublicDNS(); client != nil {
+		var err error
+		if published := getPublishedDNS(service); published != nil {
+			err = client.EnsurePublicDNSRecordsDeleted(ctx, service, published.Domain, published.Rr, published.IPs)
+		} else if isPublicDNSEnabled(service) {
+			err = client.EnsurePublicDNSRecordsDeleted(ctx, service, defaulted.PublicDNSDomain,
+				defaulted.PublicDNSRR, ingressIPs(&service.Status.LoadBalancer))
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	if len(service.Status.LoadBalancer.Ingress) > 0 {
-		err := c.climgr.PrivateZones().EnsurePrivateZoneRecordDeleted(ctx, service, service.Status.LoadBalancer.Ingress[0].IP, defaulted.AddressIPVersion)
+		err := regional.PrivateZones().EnsurePrivateZoneRecordDeleted(ctx, service, service.Status.LoadBalancer.Ingress[0].IP, defaulted.AddressIPVersion)
 		if err != nil {
 			return err
 		}
 	}
 
-	return c.climgr.LoadBalancers().EnsureLoadBalanceDeleted(ctx, service)
+	return regional.LoadBalancers().EnsureLoadBalanceDeleted(ctx, service)
 }
 
 // NodeAddresses returns the addresses of the specified instance.
@@ -584,6 +889,12 @@ func (c *Cloud) RouteTables(ctx context.Context, clusterName string) ([]string,
 func (c *Cloud) ListRoutes(ctx context.Context, clusterName string, tableid string) ([]*cloudprovider.Route, error) {
 	klog.V(5).Infof("alicloud: ListRoutes \n")
 
+	// ipv6 routes are listed for dual-stack cluster only, routes are created
+	// for the subnets within the cluster cidrs, see routesToCreate
+	cidrs, err := route.ParseClusterCIDRs(route.Options.ClusterCIDR)
+	if err == nil && route.HasIPv6(cidrs) {
+		return c.climgr.Routes().ListRoutes(ctx, tableid, ROUTE_IPV4, ROUTE_IPV6)
+	}
 	return c.climgr.Routes().ListRoutes(ctx, tableid)
 }
 
@@ -604,6 +915,27 @@ func (c *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint st
 	return c.climgr.Routes().CreateRoute(ctx, tableid, cRoute, ins.RegionId, ins.VpcAttributes.VpcId)
 }
 
+// SubmitRoute creates the described managed route without waiting for it to
+// be available, see WaitRouteTable
+func (c *Cloud) SubmitRoute(ctx context.Context, clusterName string, nameHint string, tableid string, route *cloudprovider.Route) error {
+	klog.V(2).Infof("Alicloud.SubmitRoute(\"%s, %+v\")", clusterName, route)
+	ins, err := c.climgr.Instances().findInstanceByProviderID(ctx, string(route.TargetNode))
+	if err != nil {
+		return err
+	}
+	cRoute := &cloudprovider.Route{
+		Name:            fmt.Sprintf("%s.%s", ins.RegionId, ins.InstanceId),
+		DestinationCIDR: route.DestinationCIDR,
+		TargetNode:      types.NodeName(ins.InstanceId),
+	}
+	return c.climgr.Routes().SubmitRoute(ctx, tableid, cRoute, ins.RegionId, ins.VpcAttributes.VpcId)
+}
+
+// WaitRouteTable wait for the routes submitted to the table available
+func (c *Cloud) WaitRouteTable(ctx context.Context, clusterName string, tableid string) error {
+	return c.climgr.Routes().WaitRouteTable(ctx, tableid)
+}
+
 // DeleteRoute deletes the specified managed route
 // Route should be as returned by ListRoutes
 func (c *Cloud) DeleteRoute(ctx context.Context, clusterName string, tableid string, route *cloudprovider.Route) error {
@@ -692,6 +1024,71 @@ func (c *Cloud) ListPublishedRoutes(
 	return routes, nil
 }
 
+// EnsureServiceRecords publish private zone records of the service which is
+// not of LoadBalancer type.
+func (c *Cloud) EnsureServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return c.climgr.Regional(defaulted.Region).PrivateZones().EnsureServiceRecords(ctx, service, records)
+}
+
+// EnsureServiceRecordsDeleted delete private zone records of the service
+// which is not of LoadBalancer type.
+func (c *Cloud) EnsureServiceRecordsDeleted(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return c.climgr.Regional(defaulted.Region).PrivateZones().EnsureServiceRecordsDeleted(ctx, service, records)
+}
+
+// ReconcileServiceRecords repair drift of private zone records of the service
+// which is not of LoadBalancer type.
+func (c *Cloud) ReconcileServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) ([]string, error) {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return c.climgr.Regional(defaulted.Region).PrivateZones().ReconcileServiceRecords(ctx, service, records)
+}
+
+// ReconcileLoadBalancerRecords repair drift of private zone records of the
+// LoadBalancer service. Records of the addresses in service status are
+// repaired, eip is not published in private zone. Repair is serialized with
+// EnsureLoadBalancer of the service, and skipped if the service has changed
+// since it was listed, records are then left to the running sync.
+func (c *Cloud) ReconcileLoadBalancerRecords(ctx context.Context, service *v1.Service) ([]string, error) {
+	defer lockService(service)()
+	if c.kclient != nil {
+		latest, err := c.kclient.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("get service: %s", err.Error())
+		}
+		if latest.ResourceVersion != service.ResourceVersion {
+			utils.Logf(service, "private zone: service changed, skip repairing records")
+			return nil, nil
+		}
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	if defaulted.PrivateZoneRecordName == "" ||
+		defaulted.ExternalIPType == string(EIPExternalIPType) {
+		return nil, nil
+	}
+	zones := c.climgr.Regional(defaulted.Region).PrivateZones()
+	var drifts []string
+	for i, ing := range service.Status.LoadBalancer.Ingress {
+		svc := service
+		if isDualStack(service) && ingressIPVersion(ing) == slb.IPv6 {
+			svc = dualStackIPv6Service(service)
+		} else if i > 0 || ing.IP == "" {
+			continue
+		}
+		request, _ := ExtractAnnotationRequest(svc)
+		repaired, err := zones.ReconcilePrivateZoneRecord(ctx, svc, ing.IP, request.AddressIPVersion)
+		drifts = append(drifts, repaired...)
+		if err != nil {
+			return drifts, err
+		}
+	}
+	return drifts, nil
+}
+
 // GetZone returns the Zone containing the current failure zone and locality region that the program is running in
 func (c *Cloud) GetZone(ctx context.Context) (cloudprovider.Zone, error) {
 	if cfg.Global.ZoneID != "" && cfg.Global.Region != "" {
@@ -789,7 +1186,7 @@ func (c *Cloud) fileOutNode(nodes []*v1.Node, service *v1.Service) ([]*v1.Node,
 	return c.climgr.Instances().filterOutByLabel(nodes, ar.BackendLabel)
 }
 
-func (c *Cloud) setEIPAsExternalIP(ctx context.Context, lbId string) ([]v1.LoadBalancerIngress, error) {
+func (c *Cloud) setEIPAsExternalIP(ctx context.Context, ins *InstanceClient, region common.Region, lbId string) ([]v1.LoadBalancerIngress, error) {
 	var (
 		ingress    []v1.LoadBalancerIngress
 		pagination common.Pagination
@@ -797,9 +1194,9 @@ func (c *Cloud) setEIPAsExternalIP(ctx context.Context, lbId string) ([]v1.LoadB
 	)
 
 	for {
-		ret, paginationResult, err := c.climgr.instance.DescribeEipAddresses(ctx,
+		ret, paginationResult, err := ins.DescribeEipAddresses(ctx,
 			&ecs.DescribeEipAddressesArgs{
-				RegionId:               c.region,
+				RegionId:               region,
 				AssociatedInstanceType: ecs.AssociatedInstanceTypeSlbInstance,
 				AssociatedInstanceId:   lbId,
 				Pagination:             pagination,
@@ -671,6 +671,9 @@ func TestEnsureLoadBalancerDeleteWithUserDefined(t *testing.T) {
 			if err != nil || !exist {
 				t.Fatalf("Delete LoadBalancer error: %v, %t", err, exist)
 			}
+			if _, ok := serviceLocks.Load(f.SVC.UID); ok {
+				t.Fatalf("expect lock of the service deleted")
+			}
 			return nil
 		},
 	)
@@ -18,7 +18,9 @@ package alicloud
 
 import (
 	"encoding/json"
+	"github.com/denverdino/aliyungo/common"
 	"github.com/denverdino/aliyungo/metadata"
+	"github.com/denverdino/aliyungo/pvtz"
 	"github.com/ghodss/yaml"
 	"github.com/go-cmd/cmd"
 
@@ -32,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"os"
 	"strings"
+	"sync"
 )
 
 // ROLE_NAME default kubernetes master role name
@@ -51,6 +54,22 @@ type ClientMgr struct {
 
 	meta         IMetaData
 	routes       *RoutesClient
+	loadbalancer *LoadBalancerClient
+	privateZone  *PrivateZoneClient
+	publicDNS    *PublicDNSClient
+	instance     *InstanceClient
+
+	key    string
+	secret string
+	// regional clients for loadbalancers outside of the cluster region,
+	// created on first use.
+	lock      sync.RWMutex
+	regions   map[common.Region]*RegionalClient
+	lastToken *Token
+}
+
+// RegionalClient loadbalancer related clients of one region
+type RegionalClient struct {
 	loadbalancer *LoadBalancerClient
 	privateZone  *PrivateZoneClient
 	instance     *InstanceClient
@@ -68,23 +87,38 @@ func NewClientMgr(key, secret string) (*ClientMgr, error) {
 		return nil, fmt.Errorf("can not determin vpcid: %s", err.Error())
 	}
 	ecsclient := NewContextedClientINS(key, secret, region)
+	vpcclient := NewContextedClientRoute(key, secret, region)
 	mgr := &ClientMgr{
-		stop: make(<-chan struct{}, 1),
-		meta: m,
+		stop:    make(<-chan struct{}, 1),
+		meta:    m,
+		key:     key,
+		secret:  secret,
+		regions: map[common.Region]*RegionalClient{},
 		instance: &InstanceClient{
 			c: ecsclient,
 		},
 		loadbalancer: &LoadBalancerClient{
-			vpcid: vpcid,
-			ins:   ecsclient,
-			c:     NewContextedClientSLB(key, secret, region),
+			region: region,
+			vpcid:  vpcid,
+			ins:    ecsclient,
+			c:      NewContextedClientSLB(key, secret, region),
+			vswitch: &VSwitchSelector{
+				c:    vpcclient,
+				ids:  cfg.Global.VswitchIDs,
+				tags: cfg.Global.VswitchTags,
+			},
+			eip: vpcclient,
 		},
 		privateZone: &PrivateZoneClient{
-			c: NewContextedClientPVTZ(key, secret, "cn-hangzhou"),
+			c:   NewContextedClientPVTZ(key, secret, "cn-hangzhou"),
+			vpc: pvtz.VPCType{RegionId: common.Region(region), VpcId: vpcid},
+		},
+		publicDNS: &PublicDNSClient{
+			c: NewContextedClientDNS(key, secret),
 		},
 		routes: &RoutesClient{
 			cen:    NewContextedClientCEN(key, secret, region),
-			client: NewContextedClientRoute(key, secret, region),
+			client: vpcclient,
 			region: region,
 		},
 	}
@@ -146,35 +180,128 @@ func (mgr *ClientMgr) Start(settoken func(mgr *ClientMgr, token *Token) error) e
 }
 
 func RefreshToken(mgr *ClientMgr, token *Token) error {
-	ecsclient := mgr.instance.c.(*ContextedClientINS)
-	slbclient := mgr.loadbalancer.c.(*ContextedClientSLB)
-	pvtzclient := mgr.privateZone.c.(*ContextedClientPVTZ)
 	vpcclient := mgr.routes.client.(*ContextedClientRoute)
 	cen := mgr.routes.cen.(*ContextedClientCEN)
-	ecsclient.ecs.WithSecurityToken(token.Token).
+	refreshRegionalToken(
+		&RegionalClient{
+			loadbalancer: mgr.loadbalancer,
+			privateZone:  mgr.privateZone,
+			instance:     mgr.instance,
+		}, token,
+	)
+	vpcclient.ecs.WithSecurityToken(token.Token).
 		WithAccessKeyId(token.AccessKey).
 		WithAccessKeySecret(token.AccessSecret)
-	slbclient.slb.WithSecurityToken(token.Token).
+	cen.cen.WithSecurityToken(token.Token).
 		WithAccessKeyId(token.AccessKey).
 		WithAccessKeySecret(token.AccessSecret)
-	pvtzclient.pvtz.WithSecurityToken(token.Token).
+
+	vpcclient.ecs.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
+	cen.cen.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
+
+	if mgr.publicDNS != nil {
+		dnsclient := mgr.publicDNS.c.(*ContextedClientDNS)
+		dnsclient.dns.WithSecurityToken(token.Token).
+			WithAccessKeyId(token.AccessKey).
+			WithAccessKeySecret(token.AccessSecret)
+		dnsclient.dns.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
+	}
+
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	mgr.lastToken = token
+	for _, rc := range mgr.regions {
+		refreshRegionalToken(rc, token)
+	}
+	return nil
+}
+
+func refreshRegionalToken(rc *RegionalClient, token *Token) {
+	ecsclient := rc.instance.c.(*ContextedClientINS)
+	slbclient := rc.loadbalancer.c.(*ContextedClientSLB)
+	pvtzclient := rc.privateZone.c.(*ContextedClientPVTZ)
+	ecsclient.ecs.WithSecurityToken(token.Token).
 		WithAccessKeyId(token.AccessKey).
 		WithAccessKeySecret(token.AccessSecret)
-	vpcclient.ecs.WithSecurityToken(token.Token).
+	slbclient.slb.WithSecurityToken(token.Token).
 		WithAccessKeyId(token.AccessKey).
 		WithAccessKeySecret(token.AccessSecret)
-	cen.cen.WithSecurityToken(token.Token).
+	pvtzclient.pvtz.WithSecurityToken(token.Token).
 		WithAccessKeyId(token.AccessKey).
 		WithAccessKeySecret(token.AccessSecret)
 
 	ecsclient.ecs.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
 	slbclient.slb.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
 	pvtzclient.pvtz.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
-	vpcclient.ecs.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
-	cen.cen.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
-	return nil
+
+	if eipclient, ok := rc.loadbalancer.eip.(*ContextedClientRoute); ok {
+		eipclient.ecs.WithSecurityToken(token.Token).
+			WithAccessKeyId(token.AccessKey).
+			WithAccessKeySecret(token.AccessSecret)
+		eipclient.ecs.SetUserAgent(KUBERNETES_ALICLOUD_IDENTITY)
+	}
+}
+
+// Regional return clients of the region. Clients of the cluster region are
+// returned when region is empty, others are created on first use.
+func (mgr *ClientMgr) Regional(region common.Region) *RegionalClient {
+	if region == "" || region == DEFAULT_REGION {
+		return &RegionalClient{
+			loadbalancer: mgr.loadbalancer,
+			privateZone:  mgr.privateZone,
+			instance:     mgr.instance,
+		}
+	}
+	mgr.lock.RLock()
+	rc, ok := mgr.regions[region]
+	mgr.lock.RUnlock()
+	if ok {
+		return rc
+	}
+
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	if rc, ok := mgr.regions[region]; ok {
+		return rc
+	}
+	klog.Infof("alicloud: create clients for region %s", region)
+	rc = &RegionalClient{
+		loadbalancer: &LoadBalancerClient{
+			region: string(region),
+			// slb of other regions are only looked up and deleted,
+			// see checkRegionalLoadBalancer
+			vpcid: mgr.loadbalancer.vpcid,
+			ins:   mgr.loadbalancer.ins,
+			c:     NewContextedClientSLB(mgr.key, mgr.secret, string(region)),
+			eip:   NewContextedClientRoute(mgr.key, mgr.secret, string(region)),
+			usage: mgr.loadbalancer.usage,
+		},
+		// private zone is a global service and zones are bound to the
+		// cluster vpc, records are always published through the default client
+		privateZone: mgr.privateZone,
+		instance: &InstanceClient{
+			c: NewContextedClientINS(mgr.key, mgr.secret, string(region)),
+		},
+	}
+	if mgr.lastToken != nil {
+		refreshRegionalToken(rc, mgr.lastToken)
+	}
+	if mgr.regions == nil {
+		mgr.regions = map[common.Region]*RegionalClient{}
+	}
+	mgr.regions[region] = rc
+	return rc
 }
 
+// LoadBalancers return loadbalancer client of the region
+func (rc *RegionalClient) LoadBalancers() *LoadBalancerClient { return rc.loadbalancer }
+
+// PrivateZones return PrivateZones client of the region
+func (rc *RegionalClient) PrivateZones() *PrivateZoneClient { return rc.privateZone }
+
+// Instances return instance client of the region
+func (rc *RegionalClient) Instances() *InstanceClient { return rc.instance }
+
 // Instances return instance client
 func (mgr *ClientMgr) Instances() *InstanceClient { return mgr.instance }
 
@@ -187,6 +314,9 @@ func (mgr *ClientMgr) LoadBalancers() *LoadBalancerClient { return mgr.loadbalan
 // PrivateZones return PrivateZones client
 func (mgr *ClientMgr) PrivateZones() *PrivateZoneClient { return mgr.privateZone }
 
+// PublicDNS return PublicDNS client
+func (mgr *ClientMgr) PublicDNS() *PublicDNSClient { return mgr.publicDNS }
+
 // MetaData return MetaData client
 func (mgr *ClientMgr) MetaData() IMetaData { return mgr.meta }
 
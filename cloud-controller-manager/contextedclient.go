@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/denverdino/aliyungo/cen"
 	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/dns"
 	"github.com/denverdino/aliyungo/ecs"
 	"github.com/denverdino/aliyungo/pvtz"
 	"github.com/denverdino/aliyungo/slb"
@@ -79,6 +80,42 @@ func (c *ContextedClientSLB) DescribeTags(ctx context.Context, args *slb.Describ
 	return c.slb.DescribeTags(args)
 }
 
+func (c *ContextedClientSLB) DescribeAvailableResource(
+	ctx context.Context,
+	args *DescribeAvailableResourceArgs,
+) (resources []AvailableResourceType, err error) {
+	response := &DescribeAvailableResourceResponse{}
+	err = c.slb.Invoke("DescribeAvailableResource", args, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.AvailableResources.AvailableResource, nil
+}
+
+func (c *ContextedClientSLB) TagResources(ctx context.Context, args *TagResourcesArgs) error {
+	response := &common.Response{}
+	return c.slb.Invoke("TagResources", args, response)
+}
+
+func (c *ContextedClientSLB) UntagResources(ctx context.Context, args *UntagResourcesArgs) error {
+	response := &common.Response{}
+	return c.slb.Invoke("UntagResources", args, response)
+}
+
+func (c *ContextedClientSLB) ListTagResources(ctx context.Context, args *ListTagResourcesArgs) (tags []TagResourceType, err error) {
+	for {
+		response := &ListTagResourcesResponse{}
+		if err := c.slb.Invoke("ListTagResources", args, response); err != nil {
+			return nil, err
+		}
+		tags = append(tags, response.TagResources.TagResource...)
+		if response.NextToken == "" {
+			return tags, nil
+		}
+		args.NextToken = response.NextToken
+	}
+}
+
 func (c *ContextedClientSLB) DescribeVServerGroups(
 	ctx context.Context,
 	args *slb.DescribeVServerGroupsArgs,
@@ -374,6 +411,72 @@ func (c *ContextedClientPVTZ) DeleteZoneRecord(ctx context.Context, args *pvtz.D
 func (c *ContextedClientPVTZ) SetZoneRecordStatus(ctx context.Context, args *pvtz.SetZoneRecordStatusArgs) (err error) {
 	return c.pvtz.SetZoneRecordStatus(args)
 }
+func (c *ContextedClientPVTZ) UpdateZoneRecordWeight(ctx context.Context, args *UpdateZoneRecordWeightArgs) (err error) {
+	response := &pvtz.UpdateZoneRecordResponse{}
+	return c.pvtz.Invoke("UpdateZoneRecord", args, response)
+}
+func (c *ContextedClientPVTZ) DescribeZoneRecordWeights(ctx context.Context, zoneId string, rr string) (weights map[int64]int, err error) {
+	args := &pvtz.DescribeZoneRecordsArgs{ZoneId: zoneId, Keyword: rr}
+	weights = make(map[int64]int)
+	for {
+		response := &DescribeWeightedZoneRecordsResponse{}
+		if err := c.pvtz.Invoke("DescribeZoneRecords", args, response); err != nil {
+			return nil, err
+		}
+		for _, record := range response.Records.Record {
+			if record.Rr == rr {
+				weights[record.RecordId] = record.Weight
+			}
+		}
+		next := response.PaginationResult.NextPage()
+		if next == nil {
+			return weights, nil
+		}
+		args.Pagination = *next
+	}
+}
+
+// =====================================================================================================================
+func NewContextedClientDNS(key, secret string) *ContextedClientDNS {
+	return &ContextedClientDNS{
+		BaseClient: BaseClient{},
+		dns:        dns.NewClientNew(key, secret),
+	}
+}
+
+type ContextedClientDNS struct {
+	BaseClient
+	// base alidns client
+	dns *dns.Client
+}
+
+func (c *ContextedClientDNS) DescribeSubDomainRecords(ctx context.Context, args *dns.DescribeSubDomainRecordsArgs) (records []dns.RecordType, err error) {
+	args.PageSize = 500
+	for args.PageNumber = 1; ; args.PageNumber++ {
+		response, err := c.dns.DescribeSubDomainRecords(args)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, response.DomainRecords.Record...)
+		if len(records) >= int(response.TotalCount) || len(response.DomainRecords.Record) == 0 {
+			return records, nil
+		}
+	}
+}
+
+func (c *ContextedClientDNS) AddDomainRecord(ctx context.Context, args *dns.AddDomainRecordArgs) (response *dns.AddDomainRecordResponse, err error) {
+	return c.dns.AddDomainRecord(args)
+}
+
+func (c *ContextedClientDNS) UpdateDomainRecord(ctx context.Context, args *dns.UpdateDomainRecordArgs) (err error) {
+	_, err = c.dns.UpdateDomainRecord(args)
+	return err
+}
+
+func (c *ContextedClientDNS) DeleteDomainRecord(ctx context.Context, args *dns.DeleteDomainRecordArgs) (err error) {
+	_, err = c.dns.DeleteDomainRecord(args)
+	return err
+}
 
 // =====================================================================================================================
 
@@ -394,6 +497,46 @@ func (c *ContextedClientRoute) DescribeVpcs(ctx context.Context, args *ecs.Descr
 	return c.ecs.DescribeVpcs(args)
 }
 
+func (c *ContextedClientRoute) DescribeVSwitches(ctx context.Context, args *DescribeVSwitchesArgs) (vswitches []ecs.VSwitchSetType, pagination *common.PaginationResult, err error) {
+	response := &ecs.DescribeVSwitchesResponse{}
+	err = c.ecs.Invoke("DescribeVSwitches", args, response)
+	if err != nil {
+		return nil, nil, err
+	}
+	return response.VSwitches.VSwitch, &response.PaginationResult, nil
+}
+
+func (c *ContextedClientRoute) DescribeEipAddresses(
+	ctx context.Context,
+	args *ecs.DescribeEipAddressesArgs,
+) (eipAddresses []ecs.EipAddressSetType, pagination *common.PaginationResult, err error) {
+	return c.ecs.DescribeEipAddresses(args)
+}
+
+func (c *ContextedClientRoute) TagResources(ctx context.Context, args *TagResourcesArgs) error {
+	response := &common.Response{}
+	return c.ecs.Invoke("TagResources", args, response)
+}
+
+func (c *ContextedClientRoute) UntagResources(ctx context.Context, args *UntagResourcesArgs) error {
+	response := &common.Response{}
+	return c.ecs.Invoke("UntagResources", args, response)
+}
+
+func (c *ContextedClientRoute) ListTagResources(ctx context.Context, args *ListTagResourcesArgs) (tags []TagResourceType, err error) {
+	for {
+		response := &ListTagResourcesResponse{}
+		if err := c.ecs.Invoke("ListTagResources", args, response); err != nil {
+			return nil, err
+		}
+		tags = append(tags, response.TagResources.TagResource...)
+		if response.NextToken == "" {
+			return tags, nil
+		}
+		args.NextToken = response.NextToken
+	}
+}
+
 func (c *ContextedClientRoute) DescribeVRouters(ctx context.Context, args *ecs.DescribeVRoutersArgs) (vrouters []ecs.VRouterSetType, pagination *common.PaginationResult, err error) {
 	return c.ecs.DescribeVRouters(args)
 }
@@ -0,0 +1,437 @@
+package privatezone
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	queue "k8s.io/client-go/util/workqueue"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/controller/service"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	controller "k8s.io/kube-aggregator/pkg/controllers"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PVTZ_CONTROLLER private zone controller name
+	PVTZ_CONTROLLER = "privatezone-controller"
+	SERVICE_QUEUE   = "privatezone.service.queue"
+)
+
+// PrivateZones publish private zone records of services which are not of
+// LoadBalancer type. Records are ips keyed by host, host "" is the service
+// itself, other hosts are pods of headless service.
+type PrivateZones interface {
+	// EnsureServiceRecords make sure records of the service are published,
+	// records created before and no longer desired are deleted.
+	EnsureServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) error
+	// EnsureServiceRecordsDeleted delete records created for the service.
+	EnsureServiceRecordsDeleted(ctx context.Context, service *v1.Service, records map[string][]string) error
+	// ReconcileServiceRecords repair the published records of the service
+	// which drift, e.g. deleted, modified or disabled by others. The drifts
+	// repaired are returned.
+	ReconcileServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) ([]string, error)
+	// ReconcileLoadBalancerRecords repair the records of LoadBalancer service
+	// which drift. The drifts repaired are returned.
+	ReconcileLoadBalancerRecords(ctx context.Context, service *v1.Service) ([]string, error)
+}
+
+// published records of a service which are published successfully. records
+// is nil for the services restored from the persisted records, which are not
+// published since the last start.
+type published struct {
+	service *v1.Service
+	records map[string][]string
+}
+
+// Controller publish private zone records for ClusterIP and headless services,
+// and repair records of all services which drift periodically.
+type Controller struct {
+	zones          PrivateZones
+	kubeClient     clientset.Interface
+	serviceLister  corelisters.ServiceLister
+	endpointLister corelisters.EndpointsLister
+	synced         []cache.InformerSynced
+	broadcaster    record.EventBroadcaster
+	recorder       record.EventRecorder
+	// services last published records, keyed by service key
+	services sync.Map
+	queue    queue.DelayingInterface
+	// reconcilePeriod period to repair records which drift
+	reconcilePeriod time.Duration
+	// class loadbalancer class owned by service controller, records of
+	// LoadBalancer services of other classes are not repaired.
+	class string
+}
+
+// New new private zone controller
+func New(
+	zones PrivateZones,
+	kubeClient clientset.Interface,
+	serviceInformer coreinformers.ServiceInformer,
+	endpointInformer coreinformers.EndpointsInformer,
+	reconcilePeriod time.Duration,
+	class string,
+) (*Controller, error) {
+	if zones == nil {
+		return nil, fmt.Errorf("private zone controller: PrivateZones must be provided")
+	}
+	eventer, caster := broadcaster()
+	con := &Controller{
+		zones:          zones,
+		kubeClient:     kubeClient,
+		serviceLister:  serviceInformer.Lister(),
+		endpointLister: endpointInformer.Lister(),
+		synced: []cache.InformerSynced{
+			serviceInformer.Informer().HasSynced,
+			endpointInformer.Informer().HasSynced,
+		},
+		broadcaster: caster,
+		recorder:    eventer,
+		queue:       workqueue.NewNamedDelayingQueue(SERVICE_QUEUE),
+
+		reconcilePeriod: reconcilePeriod,
+		class:           class,
+	}
+	serviceInformer.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: con.enqueue,
+			UpdateFunc: func(old, cur interface{}) {
+				svc1, ok1 := old.(*v1.Service)
+				svc2, ok2 := cur.(*v1.Service)
+				if ok1 && ok2 &&
+					reflect.DeepEqual(svc1.Spec, svc2.Spec) &&
+					reflect.DeepEqual(utils.SpecAnnotations(svc1.Annotations), utils.SpecAnnotations(svc2.Annotations)) &&
+					(svc1.DeletionTimestamp == nil) == (svc2.DeletionTimestamp == nil) {
+					return
+				}
+				con.enqueue(cur)
+			},
+			DeleteFunc: con.enqueue,
+		},
+	)
+	endpointInformer.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: con.enqueueEndpoints,
+			UpdateFunc: func(old, cur interface{}) {
+				ep1, ok1 := old.(*v1.Endpoints)
+				ep2, ok2 := cur.(*v1.Endpoints)
+				if ok1 && ok2 && reflect.DeepEqual(ep1.Subsets, ep2.Subsets) {
+					return
+				}
+				con.enqueueEndpoints(cur)
+			},
+			DeleteFunc: con.enqueueEndpoints,
+		},
+	)
+	return con, nil
+}
+
+func (con *Controller) enqueue(obj interface{}) {
+	k, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Warningf("private zone controller: get key of object: %s", err.Error())
+		return
+	}
+	con.queue.Add(k)
+}
+
+// enqueueEndpoints only endpoints of headless service with records affect
+// the records.
+func (con *Controller) enqueueEndpoints(obj interface{}) {
+	k, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Warningf("private zone controller: get key of object: %s", err.Error())
+		return
+	}
+	ns, name, err := cache.SplitMetaNamespaceKey(k)
+	if err != nil {
+		return
+	}
+	svc, err := con.serviceLister.Services(ns).Get(name)
+	if err != nil || !NeedRecords(svc) || !IsHeadless(svc) {
+		return
+	}
+	con.queue.Add(k)
+}
+
+// Run start private zone controller
+func (con *Controller) Run(stopCh <-chan struct{}, workers int) {
+	defer utilruntime.HandleCrash()
+	defer con.queue.ShutDown()
+
+	klog.Info("starting private zone controller")
+	defer klog.Info("shutting down private zone controller")
+
+	if !controller.WaitForCacheSync(PVTZ_CONTROLLER, stopCh, con.synced...) {
+		return
+	}
+
+	if con.broadcaster != nil && con.kubeClient != nil {
+		sink := &v1core.EventSinkImpl{
+			Interface: v1core.New(con.kubeClient.CoreV1().RESTClient()).Events(""),
+		}
+		con.broadcaster.StartRecordingToSink(sink)
+	}
+
+	con.restore()
+	for i := 0; i < workers; i++ {
+		go wait.Until(con.worker, 2*time.Second, stopCh)
+	}
+	if con.reconcilePeriod > 0 {
+		go wait.Until(con.reconcile, con.reconcilePeriod, stopCh)
+	}
+	<-stopCh
+}
+
+// restore rebuild the published records from the records persisted on the
+// services, so that records of the services which no longer need them since
+// the last run are deleted. Records of LoadBalancer services are published by
+// service controller.
+func (con *Controller) restore() {
+	svcs, err := con.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("private zone controller: list services: %s", err.Error())
+		return
+	}
+	for _, svc := range svcs {
+		if _, ok := svc.Annotations[utils.ServiceAnnotationPrivateZoneRecords]; !ok ||
+			svc.Spec.Type == v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		k, err := cache.MetaNamespaceKeyFunc(svc)
+		if err != nil {
+			continue
+		}
+		con.services.LoadOrStore(k, &published{service: svc})
+		con.queue.Add(k)
+	}
+}
+
+func (con *Controller) worker() {
+	for con.processNext() {
+	}
+}
+
+func (con *Controller) processNext() bool {
+	k, quit := con.queue.Get()
+	if quit {
+		return false
+	}
+	defer con.queue.Done(k)
+	if err := con.sync(k.(string)); err != nil {
+		klog.Errorf("requeue: sync private zone records for service %s, error %s", k, err.Error())
+		con.queue.AddAfter(k, 30*time.Second)
+	}
+	return true
+}
+
+func (con *Controller) sync(k string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(k)
+	if err != nil {
+		return nil
+	}
+	svc, err := con.serviceLister.Services(ns).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("get service: %s", err.Error())
+		}
+		svc = nil
+	}
+
+	var last *published
+	if cached, ok := con.services.Load(k); ok {
+		last = cached.(*published)
+	}
+	if last != nil &&
+		(svc == nil || !NeedRecords(svc) || svc.UID != last.service.UID) {
+		utils.Logf(last.service, "private zone: delete records %v", last.records)
+		err := con.zones.EnsureServiceRecordsDeleted(context.Background(), last.service, last.records)
+		if err != nil {
+			if svc != nil {
+				con.recorder.Eventf(svc, v1.EventTypeWarning, "DeletePrivateZoneRecordFailed",
+					"Error deleting private zone records: %s", err.Error())
+			}
+			return err
+		}
+		con.services.Delete(k)
+		last = nil
+	}
+	if svc == nil || !NeedRecords(svc) {
+		return nil
+	}
+
+	records, err := con.buildRecords(svc)
+	if err != nil {
+		return err
+	}
+	if last != nil &&
+		reflect.DeepEqual(last.records, records) &&
+		reflect.DeepEqual(utils.SpecAnnotations(last.service.Annotations), utils.SpecAnnotations(svc.Annotations)) {
+		return nil
+	}
+	utils.Logf(svc, "private zone: ensure records %v", records)
+	if err := con.zones.EnsureServiceRecords(context.Background(), svc, records); err != nil {
+		con.recorder.Eventf(svc, v1.EventTypeWarning, "SyncPrivateZoneRecordFailed",
+			"Error syncing private zone records: %s", err.Error())
+		return err
+	}
+	con.recorder.Eventf(svc, v1.EventTypeNormal, "EnsuredPrivateZoneRecord",
+		"Ensured private zone records for %d hosts", len(records))
+	con.services.Store(k, &published{service: svc, records: records})
+	return nil
+}
+
+// reconcile repair the records of services which drift from the services,
+// records are otherwise only touched when the service changes. Records of
+// ClusterIP and headless services are repaired once published by this
+// controller, records of LoadBalancer services once the address is assigned.
+func (con *Controller) reconcile() {
+	svcs, err := con.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("private zone controller: list services: %s", err.Error())
+		return
+	}
+	for _, svc := range svcs {
+		var (
+			drifts []string
+			err    error
+		)
+		switch {
+		case NeedRecords(svc):
+			k, kerr := cache.MetaNamespaceKeyFunc(svc)
+			if kerr != nil {
+				continue
+			}
+			cached, ok := con.services.Load(k)
+			if !ok ||
+				cached.(*published).records == nil ||
+				cached.(*published).service.UID != svc.UID {
+				continue
+			}
+			last := cached.(*published)
+			drifts, err = con.zones.ReconcileServiceRecords(context.Background(), last.service, last.records)
+		case NeedLoadBalancerRecords(svc, con.class):
+			drifts, err = con.zones.ReconcileLoadBalancerRecords(context.Background(), svc)
+		default:
+			continue
+		}
+		if len(drifts) > 0 {
+			utils.Logf(svc, "private zone: repaired records %v", drifts)
+			con.recorder.Eventf(svc, v1.EventTypeNormal, "RepairedPrivateZoneRecord",
+				"Repaired private zone records: %s", strings.Join(drifts, "; "))
+		}
+		if err != nil {
+			utils.Logf(svc, "private zone: reconcile records error: %s", err.Error())
+			con.recorder.Eventf(svc, v1.EventTypeWarning, "ReconcilePrivateZoneRecordFailed",
+				"Error reconciling private zone records: %s", err.Error())
+		}
+	}
+}
+
+// buildRecords records of the service. ClusterIP is published for normal
+// service, and endpoint ips for headless service. Each pod of headless service
+// is also published with its hostname, or pod name if hostname is not set.
+func (con *Controller) buildRecords(svc *v1.Service) (map[string][]string, error) {
+	if !IsHeadless(svc) {
+		return map[string][]string{"": {svc.Spec.ClusterIP}}, nil
+	}
+	eps, err := con.endpointLister.Endpoints(svc.Namespace).Get(svc.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return map[string][]string{}, nil
+		}
+		return nil, fmt.Errorf("get endpoints: %s", err.Error())
+	}
+	return BuildHeadlessRecords(svc, eps), nil
+}
+
+// BuildHeadlessRecords records of headless service
+func BuildHeadlessRecords(svc *v1.Service, eps *v1.Endpoints) map[string][]string {
+	records := make(map[string][]string)
+	add := func(host, ip string) {
+		for _, v := range records[host] {
+			if v == ip {
+				return
+			}
+		}
+		records[host] = append(records[host], ip)
+	}
+	for _, subset := range eps.Subsets {
+		addrs := subset.Addresses
+		if svc.Spec.PublishNotReadyAddresses {
+			addrs = append(addrs, subset.NotReadyAddresses...)
+		}
+		for _, addr := range addrs {
+			add("", addr.IP)
+			host := addr.Hostname
+			if host == "" && addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+				host = addr.TargetRef.Name
+			}
+			if host != "" {
+				add(host, addr.IP)
+			}
+		}
+	}
+	for host := range records {
+		sort.Strings(records[host])
+	}
+	return records
+}
+
+// NeedRecords whether records of the service should be published by this
+// controller. Records of LoadBalancer service are published by service controller.
+func NeedRecords(svc *v1.Service) bool {
+	if svc.DeletionTimestamp != nil ||
+		svc.Annotations[utils.ServiceAnnotationPrivateZoneEnable] != "on" {
+		return false
+	}
+	if svc.Spec.Type != v1.ServiceTypeClusterIP && svc.Spec.Type != v1.ServiceTypeNodePort {
+		return false
+	}
+	return svc.Spec.ClusterIP != ""
+}
+
+// NeedLoadBalancerRecords whether the records of LoadBalancer service should
+// be repaired. Records are published by service controller, services which
+// are paused or not processed by the service controller of the class are skipped.
+func NeedLoadBalancerRecords(svc *v1.Service, class string) bool {
+	if svc.DeletionTimestamp != nil ||
+		svc.Spec.Type != v1.ServiceTypeLoadBalancer ||
+		len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return false
+	}
+	if strings.ToLower(svc.Annotations[utils.ServiceAnnotationLoadBalancerPauseReconcile]) == "on" ||
+		!service.IsProcessNeeded(svc, class) {
+		return false
+	}
+	return svc.Annotations[utils.ServiceAnnotationPrivateZoneRecordName] != ""
+}
+
+// IsHeadless whether the service is headless
+func IsHeadless(svc *v1.Service) bool {
+	return svc.Spec.ClusterIP == v1.ClusterIPNone
+}
+
+func broadcaster() (record.EventRecorder, record.EventBroadcaster) {
+	caster := record.NewBroadcaster()
+	caster.StartLogging(klog.Infof)
+	source := v1.EventSource{Component: PVTZ_CONTROLLER}
+	return caster.NewRecorder(scheme.Scheme, source), caster
+}
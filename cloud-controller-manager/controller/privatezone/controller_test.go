@@ -0,0 +1,301 @@
+package privatezone
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/controller/service"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type fakeZones struct {
+	ensured map[string]map[string][]string
+	deleted map[string]map[string][]string
+	// drifts repaired by reconcile keyed by service name
+	drifts     map[string][]string
+	reconciled []string
+}
+
+func (f *fakeZones) EnsureServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	f.ensured[service.Name] = records
+	return nil
+}
+
+func (f *fakeZones) EnsureServiceRecordsDeleted(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	f.deleted[service.Name] = records
+	return nil
+}
+
+func (f *fakeZones) ReconcileServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) ([]string, error) {
+	f.reconciled = append(f.reconciled, service.Name)
+	return f.drifts[service.Name], nil
+}
+
+func (f *fakeZones) ReconcileLoadBalancerRecords(ctx context.Context, service *v1.Service) ([]string, error) {
+	f.reconciled = append(f.reconciled, service.Name)
+	return f.drifts[service.Name], nil
+}
+
+func TestSyncPrivateZoneRecords(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	zones := &fakeZones{
+		ensured: map[string]map[string][]string{},
+		deleted: map[string]map[string][]string{},
+	}
+	con, err := New(zones, client, factory.Core().V1().Services(), factory.Core().V1().Endpoints(), 0, "")
+	if err != nil {
+		t.Fatalf("new controller: %s", err.Error())
+	}
+	con.recorder = record.NewFakeRecorder(10)
+	services := factory.Core().V1().Services().Informer().GetIndexer()
+	endpoints := factory.Core().V1().Endpoints().Informer().GetIndexer()
+
+	annotations := map[string]string{utils.ServiceAnnotationPrivateZoneEnable: "on"}
+	normal := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "uid-api", Annotations: annotations},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.10"},
+	}
+	headless := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-web", Annotations: annotations},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: v1.ClusterIPNone},
+	}
+	optout := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", UID: "uid-db"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.11"},
+	}
+	eps := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.2", Hostname: "web-1"},
+					{IP: "10.0.0.1", TargetRef: &v1.ObjectReference{Kind: "Pod", Name: "web-0"}},
+				},
+				NotReadyAddresses: []v1.EndpointAddress{
+					{IP: "10.0.0.3", Hostname: "web-2"},
+				},
+			},
+		},
+	}
+	for _, obj := range []interface{}{normal, headless, optout} {
+		_ = services.Add(obj)
+	}
+	_ = endpoints.Add(eps)
+
+	for _, k := range []string{"default/api", "default/web", "default/db"} {
+		if err := con.sync(k); err != nil {
+			t.Fatalf("sync %s: %s", k, err.Error())
+		}
+	}
+	if !reflect.DeepEqual(zones.ensured["api"], map[string][]string{"": {"172.16.0.10"}}) {
+		t.Fatalf("unexpected records of normal service: %v", zones.ensured["api"])
+	}
+	expect := map[string][]string{
+		"":      {"10.0.0.1", "10.0.0.2"},
+		"web-0": {"10.0.0.1"},
+		"web-1": {"10.0.0.2"},
+	}
+	if !reflect.DeepEqual(zones.ensured["web"], expect) {
+		t.Fatalf("unexpected records of headless service: %v", zones.ensured["web"])
+	}
+	if _, ok := zones.ensured["db"]; ok {
+		t.Fatal("service without annotation should be skipped")
+	}
+
+	// unchanged records are not ensured again
+	delete(zones.ensured, "web")
+	if err := con.sync("default/web"); err != nil {
+		t.Fatalf("sync: %s", err.Error())
+	}
+	if _, ok := zones.ensured["web"]; ok {
+		t.Fatal("unchanged records should not be ensured again")
+	}
+
+	// not ready addresses are published when requested
+	published := headless.DeepCopy()
+	published.Spec.PublishNotReadyAddresses = true
+	_ = services.Update(published)
+	if err := con.sync("default/web"); err != nil {
+		t.Fatalf("sync: %s", err.Error())
+	}
+	if len(zones.ensured["web"][""]) != 3 || len(zones.ensured["web"]["web-2"]) != 1 {
+		t.Fatalf("expect not ready addresses published, got %v", zones.ensured["web"])
+	}
+
+	// opt out and deletion
+	disabled := normal.DeepCopy()
+	disabled.Annotations = nil
+	_ = services.Update(disabled)
+	_ = services.Delete(published)
+	for _, k := range []string{"default/api", "default/web"} {
+		if err := con.sync(k); err != nil {
+			t.Fatalf("sync %s: %s", k, err.Error())
+		}
+	}
+	if !reflect.DeepEqual(zones.deleted["api"], map[string][]string{"": {"172.16.0.10"}}) {
+		t.Fatalf("expect records of opted out service deleted, got %v", zones.deleted["api"])
+	}
+	if len(zones.deleted["web"]) != 4 {
+		t.Fatalf("expect records of deleted service deleted, got %v", zones.deleted["web"])
+	}
+}
+
+func TestRestorePublishedRecords(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	zones := &fakeZones{
+		ensured: map[string]map[string][]string{},
+		deleted: map[string]map[string][]string{},
+	}
+	con, err := New(zones, client, factory.Core().V1().Services(), factory.Core().V1().Endpoints(), 0, "")
+	if err != nil {
+		t.Fatalf("new controller: %s", err.Error())
+	}
+	con.recorder = record.NewFakeRecorder(10)
+	services := factory.Core().V1().Services().Informer().GetIndexer()
+
+	persisted := `{"zoneId":"zone-1","records":{"uid":1}}`
+	// opted out while ccm is not running
+	optout := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "api", Namespace: "default", UID: "uid-api",
+			Annotations: map[string]string{utils.ServiceAnnotationPrivateZoneRecords: persisted},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.10"},
+	}
+	kept := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "web", Namespace: "default", UID: "uid-web",
+			Annotations: map[string]string{
+				utils.ServiceAnnotationPrivateZoneEnable:  "on",
+				utils.ServiceAnnotationPrivateZoneRecords: persisted,
+			},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.11"},
+	}
+	// records of loadbalancer service are published by service controller
+	lb := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "lb", Namespace: "default", UID: "uid-lb",
+			Annotations: map[string]string{utils.ServiceAnnotationPrivateZoneRecords: persisted},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	for _, obj := range []interface{}{optout, kept, lb} {
+		_ = services.Add(obj)
+	}
+	con.restore()
+	if con.queue.Len() != 2 {
+		t.Fatalf("expect 2 restored services queued, got %d", con.queue.Len())
+	}
+
+	// restored records are not reconciled before published
+	con.reconcile()
+	if len(zones.reconciled) != 0 {
+		t.Fatalf("expect restored records not reconciled, got %v", zones.reconciled)
+	}
+
+	for _, k := range []string{"default/api", "default/web", "default/lb"} {
+		if err := con.sync(k); err != nil {
+			t.Fatalf("sync %s: %s", k, err.Error())
+		}
+	}
+	if _, ok := zones.deleted["api"]; !ok {
+		t.Fatal("expect records of opted out service deleted")
+	}
+	if _, ok := zones.deleted["lb"]; ok {
+		t.Fatal("expect records of loadbalancer service left to service controller")
+	}
+	if !reflect.DeepEqual(zones.ensured["web"], map[string][]string{"": {"172.16.0.11"}}) {
+		t.Fatalf("expect records of restored service ensured, got %v", zones.ensured["web"])
+	}
+}
+
+func TestReconcilePrivateZoneRecords(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	zones := &fakeZones{
+		ensured: map[string]map[string][]string{},
+		deleted: map[string]map[string][]string{},
+		drifts:  map[string][]string{"api": {"[api.example.com] A 172.16.0.10: disabled, enabled"}},
+	}
+	con, err := New(zones, client, factory.Core().V1().Services(), factory.Core().V1().Endpoints(), 0, "alibaba")
+	if err != nil {
+		t.Fatalf("new controller: %s", err.Error())
+	}
+	recorder := record.NewFakeRecorder(10)
+	con.recorder = recorder
+	services := factory.Core().V1().Services().Informer().GetIndexer()
+
+	normal := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "api", Namespace: "default", UID: "uid-api",
+			Annotations: map[string]string{utils.ServiceAnnotationPrivateZoneEnable: "on"},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.10"},
+	}
+	unpublished := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "db", Namespace: "default", UID: "uid-db",
+			Annotations: map[string]string{utils.ServiceAnnotationPrivateZoneEnable: "on"},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.11"},
+	}
+	lb := func(name string, annotations map[string]string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name), Annotations: annotations},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+			Status: v1.ServiceStatus{
+				LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}},
+			},
+		}
+	}
+	named := map[string]string{utils.ServiceAnnotationPrivateZoneRecordName: "web"}
+	web := lb("web", named)
+	paused := lb("paused", map[string]string{
+		utils.ServiceAnnotationPrivateZoneRecordName:      "web",
+		utils.ServiceAnnotationLoadBalancerPauseReconcile: "on",
+	})
+	owned := lb("owned", map[string]string{
+		utils.ServiceAnnotationPrivateZoneRecordName: "web",
+		service.CCM_CLASS: "alibaba",
+	})
+	other := lb("other", map[string]string{
+		utils.ServiceAnnotationPrivateZoneRecordName: "web",
+		service.CCM_CLASS: "nginx",
+	})
+	norecord := lb("norecord", nil)
+	pending := lb("pending", named)
+	pending.Status.LoadBalancer.Ingress = nil
+	for _, obj := range []interface{}{normal, unpublished, web, paused, owned, other, norecord, pending} {
+		_ = services.Add(obj)
+	}
+	// only records published by the controller are repaired
+	if err := con.sync("default/api"); err != nil {
+		t.Fatalf("sync: %s", err.Error())
+	}
+	<-recorder.Events
+
+	con.reconcile()
+	sort.Strings(zones.reconciled)
+	if !reflect.DeepEqual(zones.reconciled, []string{"api", "owned", "web"}) {
+		t.Fatalf("unexpected services reconciled: %v", zones.reconciled)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "RepairedPrivateZoneRecord") || !strings.Contains(event, "disabled, enabled") {
+			t.Fatalf("unexpected event %s", event)
+		}
+	default:
+		t.Fatal("expect event of repaired records")
+	}
+}
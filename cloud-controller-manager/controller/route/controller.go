@@ -77,6 +77,11 @@ type Routes interface {
 	// route.Name will be ignored, although the cloud-provider may use nameHint
 	// to create a more user-meaningful name.
 	CreateRoute(ctx context.Context, clusterName string, nameHint string, table string, route *cloudprovider.Route) error
+	// SubmitRoute creates the described managed route without waiting for
+	// it to be available, see WaitRouteTable.
+	SubmitRoute(ctx context.Context, clusterName string, nameHint string, table string, route *cloudprovider.Route) error
+	// WaitRouteTable waits for the routes submitted to the table available
+	WaitRouteTable(ctx context.Context, clusterName string, table string) error
 	// DeleteRoute deletes the specified managed route
 	// Route should be as returned by ListRoutes
 	DeleteRoute(ctx context.Context, clusterName string, table string, route *cloudprovider.Route) error
@@ -103,11 +108,15 @@ type RouteController struct {
 	kubeClient       clientset.Interface
 	cenid            string
 	clusterName      string
-	clusterCIDR      *net.IPNet
+	clusterCIDRs     []*net.IPNet
 	nodeLister       corelisters.NodeLister
 	nodeListerSynced cache.InformerSynced
 	broadcaster      record.EventBroadcaster
 	recorder         record.EventRecorder
+	// scheduler creates routes in batches per route table
+	scheduler *routeScheduler
+	// subnets source of node subnets to route
+	subnets NodeSubnetProvider
 	// Package workqueue provides a simple queue that supports the following
 	// features:
 	//  * Fair: items processed in the order in which they are added.
@@ -122,14 +131,18 @@ type RouteController struct {
 
 const NODE_QUEUE = "node.queue"
 
+// NODE_ROUTE_QUEUE queue of nodes whose routes should be created, keyed by node name
+const NODE_ROUTE_QUEUE = "node.route.queue"
+
 // New new route controller
 func New(
 	routes Routes,
 	kubeClient clientset.Interface,
 	nodeInformer coreinformers.NodeInformer,
 	clusterName string,
-	clusterCIDR *net.IPNet,
+	clusterCIDRs []*net.IPNet,
 	cenid string,
+	subnets NodeSubnetProvider,
 ) (*RouteController, error) {
 
 	if kubeClient != nil && kubeClient.CoreV1().RESTClient().GetRateLimiter() != nil {
@@ -142,31 +155,48 @@ func New(
 		}
 	}
 
-	if clusterCIDR == nil {
+	if len(clusterCIDRs) == 0 {
 		return nil, fmt.Errorf("RouteController: Must specify clusterCIDR")
 	}
 
+	if subnets == nil {
+		subnets = &autoSubnets{}
+	}
+
 	eventer, caster := broadcaster()
 
 	rc := &RouteController{
 		routes:           routes,
 		kubeClient:       kubeClient,
 		clusterName:      clusterName,
-		clusterCIDR:      clusterCIDR,
+		clusterCIDRs:     clusterCIDRs,
 		nodeLister:       nodeInformer.Lister(),
 		nodeListerSynced: nodeInformer.Informer().HasSynced,
 		broadcaster:      caster,
 		recorder:         eventer,
 		cenid:            cenid,
+		subnets:          subnets,
 		queues: map[string]queue.DelayingInterface{
-			NODE_QUEUE: workqueue.NewNamedDelayingQueue(NODE_QUEUE),
+			NODE_QUEUE:       workqueue.NewNamedDelayingQueue(NODE_QUEUE),
+			NODE_ROUTE_QUEUE: workqueue.NewNamedDelayingQueue(NODE_ROUTE_QUEUE),
 		},
 	}
+	rc.scheduler = newRouteScheduler(routes, clusterName, Options.ConcurrentRouteTableSyncs)
+	rc.scheduler.created = rc.routeCreated
+	rc.scheduler.nodeDone = rc.nodeRoutesCreated
 
 	rc.HandlerForNodeDeletion(
 		rc.queues[NODE_QUEUE],
 		nodeInformer.Informer(),
 	)
+	rc.HandlerForNodeSubnetChange(
+		rc.queues[NODE_ROUTE_QUEUE],
+		nodeInformer.Informer(),
+	)
+	if watched, ok := subnets.(watchedSubnetProvider); ok {
+		que := rc.queues[NODE_ROUTE_QUEUE]
+		watched.OnSubnetChange(func(node string) { que.Add(node) })
+	}
 
 	return rc, nil
 }
@@ -194,6 +224,55 @@ func (rc *RouteController) HandlerForNodeDeletion(
 	)
 }
 
+// HandlerForNodeSubnetChange enqueue the node when its subnet appears or
+// changes, so that routes of new nodes are created without waiting for the
+// next reconcile.
+func (rc *RouteController) HandlerForNodeSubnetChange(
+	que queue.DelayingInterface,
+	informer cache.SharedIndexInformer,
+) {
+	enqueue := func(node *v1.Node) {
+		subnets, _ := rc.subnets.NodeSubnets(node)
+		if utils.IsExcludedNode(node) || len(subnets) == 0 {
+			return
+		}
+		que.Add(node.Name)
+		klog.Infof("node subnet event: %s, %s", node.Name, subnets)
+	}
+	informer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(nodec interface{}) {
+				node, ok := nodec.(*v1.Node)
+				if !ok {
+					klog.Infof("not node type: %s\n", reflect.TypeOf(nodec))
+					return
+				}
+				// routes of existing nodes are left to reconcile on restart
+				_, condition := helpers.GetNodeCondition(&node.Status, v1.NodeNetworkUnavailable)
+				if condition != nil && condition.Status == v1.ConditionFalse {
+					return
+				}
+				enqueue(node)
+			},
+			UpdateFunc: func(oldc, curc interface{}) {
+				old, ok1 := oldc.(*v1.Node)
+				cur, ok2 := curc.(*v1.Node)
+				if !ok1 || !ok2 {
+					klog.Infof("not node type: %s\n", reflect.TypeOf(curc))
+					return
+				}
+				oldSubnets, _ := rc.subnets.NodeSubnets(old)
+				curSubnets, _ := rc.subnets.NodeSubnets(cur)
+				if reflect.DeepEqual(oldSubnets, curSubnets) &&
+					old.Spec.ProviderID == cur.Spec.ProviderID {
+					return
+				}
+				enqueue(cur)
+			},
+		},
+	)
+}
+
 // Run start route controller
 func (rc *RouteController) Run(stopCh <-chan struct{}, syncPeriod time.Duration) {
 	defer utilruntime.HandleCrash()
@@ -201,7 +280,12 @@ func (rc *RouteController) Run(stopCh <-chan struct{}, syncPeriod time.Duration)
 	klog.Info("starting route controller")
 	defer klog.Info("shutting down route controller")
 
-	if !controller.WaitForCacheSync(ROUTE_CONTROLLER, stopCh, rc.nodeListerSynced) {
+	synced := []cache.InformerSynced{rc.nodeListerSynced}
+	if watched, ok := rc.subnets.(watchedSubnetProvider); ok {
+		watched.Run(stopCh)
+		synced = append(synced, watched.HasSynced)
+	}
+	if !controller.WaitForCacheSync(ROUTE_CONTROLLER, stopCh, synced...) {
 		return
 	}
 
@@ -212,11 +296,9 @@ func (rc *RouteController) Run(stopCh <-chan struct{}, syncPeriod time.Duration)
 		rc.broadcaster.StartRecordingToSink(sink)
 	}
 
-	// TODO: If we do just the full Resync every 5 minutes (default value)
-	// that means that we may wait up to 5 minutes before even starting
-	// creating a route for it. This is bad.
-	// We should have a watch on node and if we observe a new node (with CIDR?)
-	// trigger reconciliation for that node.
+	// routes of a node are created once its subnet is observed, see
+	// HandlerForNodeSubnetChange. The full reconcile is a safety net for
+	// failed creations and routes modified outside.
 	go wait.NonSlidingUntil(func() {
 		if err := rc.reconcile(); err != nil {
 			klog.Errorf("Couldn't reconcile node routes: %v", err)
@@ -253,29 +335,120 @@ func (rc *RouteController) Run(stopCh <-chan struct{}, syncPeriod time.Duration)
 		2*time.Second,
 		stopCh,
 	)
+
+	go wait.Until(
+		func() {
+			for rc.processNodeRoute() {
+			}
+		},
+		2*time.Second,
+		stopCh,
+	)
 	<-stopCh
 }
 
-func (rc *RouteController) syncd(node *v1.Node) error {
-	var nodeSubnet string
-	ipnet, err := GetOVNNodeHostSubnet(node)
-	if err == nil {
-		nodeSubnet = ipnet[0].String()
-	} else {
-		nodeSubnet = node.Spec.PodCIDR
+func (rc *RouteController) processNodeRoute() bool {
+	que := rc.queues[NODE_ROUTE_QUEUE]
+	key, quit := que.Get()
+	if quit {
+		return false
 	}
+	defer que.Done(key)
+	name, ok := key.(string)
+	if !ok {
+		klog.Errorf("not type of node name, %s", reflect.TypeOf(key))
+		return true
+	}
+	klog.Infof("worker: queued sync for [%s] node subnet with route", name)
+	if err := rc.syncNodeRoute(name); err != nil {
+		que.AddAfter(key, 30*time.Second)
+		klog.Errorf("requeue: create route for node %s, error %v", name, err)
+	}
+	return true
+}
 
+// syncNodeRoute create the route of the node in every route table
+func (rc *RouteController) syncNodeRoute(name string) error {
+	node, err := rc.nodeLister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// routes of deleted node are removed by node deletion handler
+			return nil
+		}
+		return fmt.Errorf("get node %s: %s", name, err.Error())
+	}
 	if utils.IsExcludedNode(node) {
 		return nil
 	}
-	if nodeSubnet == "" {
-		klog.Warningf("Node %s PodCIDR is nil, skip delete route", node.Name)
+	subnets, err := rc.subnets.NodeSubnets(node)
+	if err != nil {
+		klog.Errorf("subnets of node %s: %s", node.Name, err.Error())
+		return nil
+	}
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	tabs, err := rc.routes.RouteTables(ctx, rc.clusterName)
+	if err != nil {
+		return fmt.Errorf("RouteTables: %s", err.Error())
+	}
+	var ops []*routeOp
+	for _, table := range tabs {
+		routes, err := rc.deleteStaleRoutesOfNode(ctx, table, node)
+		if err != nil {
+			return err
+		}
+		pending, err := rc.routesToCreate(table, node, RouteCacheMap(routes))
+		if err != nil {
+			return err
+		}
+		ops = append(ops, pending...)
+	}
+	return rc.scheduler.run(ctx, ops)
+}
+
+// deleteStaleRoutesOfNode delete routes to the node of its previous subnets
+// from the table while holding the table lock, and return the routes left.
+func (rc *RouteController) deleteStaleRoutesOfNode(
+	ctx context.Context,
+	table string,
+	node *v1.Node,
+) ([]*cloudprovider.Route, error) {
+	defer rc.scheduler.lockTable(table)()
+	routes, err := rc.routes.ListRoutes(ctx, rc.clusterName, table)
+	if err != nil {
+		return nil, fmt.Errorf("error listing routes: %v", err)
+	}
+	var left []*cloudprovider.Route
+	for _, route := range routes {
+		if !rc.isResponsibleForRoute(route) || !rc.isRouteStale([]*v1.Node{node}, route) {
+			left = append(left, route)
+			continue
+		}
+		klog.Infof("Deleting stale route %s %s of node %s", route.Name, route.DestinationCIDR, node.Name)
+		if err := rc.routes.DeleteRoute(ctx, rc.clusterName, table, route); err != nil {
+			return nil, fmt.Errorf("delete stale route %s of node %s from table %s: %s",
+				route.DestinationCIDR, node.Name, table, err.Error())
+		}
+		klog.Infof("Delete stale route %s %s from table %s SUCCESS.", route.Name, route.DestinationCIDR, table)
+	}
+	return left, nil
+}
+
+func (rc *RouteController) syncd(node *v1.Node) error {
+	if utils.IsExcludedNode(node) {
 		return nil
 	}
 	if node.Spec.ProviderID == "" {
 		klog.Warningf("Node %s has no Provider ID, skip delete route", node.Name)
 		return nil
 	}
+	nodeSubnets, err := rc.subnets.NodeSubnets(node)
+	if err != nil {
+		klog.Warningf("subnets of node %s: %s, delete routes found in route tables only", node.Name, err.Error())
+	}
 
 	ctx := context.Background()
 	tabs, err := rc.routes.RouteTables(ctx, rc.clusterName)
@@ -283,11 +456,27 @@ func (rc *RouteController) syncd(node *v1.Node) error {
 		return fmt.Errorf("RouteTables: %s", err.Error())
 	}
 	for _, table := range tabs {
-		route := &cloudprovider.Route{
-			Name:            node.Spec.ProviderID,
-			TargetNode:      types.NodeName(node.Spec.ProviderID),
-			DestinationCIDR: nodeSubnet,
+		if err := rc.deleteRoutesOfNode(ctx, table, node, nodeSubnets); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// deleteRoutesOfNode delete routes to the node from the table while holding
+// the table lock.
+func (rc *RouteController) deleteRoutesOfNode(
+	ctx context.Context,
+	table string,
+	node *v1.Node,
+	nodeSubnets []string,
+) error {
+	defer rc.scheduler.lockTable(table)()
+	routes, err := rc.routesOfNode(ctx, table, node, nodeSubnets)
+	if err != nil {
+		return fmt.Errorf("node deletion, list route error: %s", err.Error())
+	}
+	for _, route := range routes {
 		if err := rc.routes.DeleteRoute(
 			ctx, rc.clusterName, table, route,
 		); err != nil {
@@ -300,6 +489,40 @@ func (rc *RouteController) syncd(node *v1.Node) error {
 	return nil
 }
 
+// routesOfNode routes to the node in the table, the routes of its subnets
+// and routes within cluster cidrs targeting the node. Subnets may be released
+// before the node deletion is observed, e.g. calico ipam blocks.
+func (rc *RouteController) routesOfNode(
+	ctx context.Context,
+	table string,
+	node *v1.Node,
+	nodeSubnets []string,
+) ([]*cloudprovider.Route, error) {
+	var routes []*cloudprovider.Route
+	found := make(map[string]bool)
+	for _, nodeSubnet := range nodeSubnets {
+		routes = append(routes, &cloudprovider.Route{
+			Name:            node.Spec.ProviderID,
+			TargetNode:      types.NodeName(node.Spec.ProviderID),
+			DestinationCIDR: nodeSubnet,
+		})
+		found[routeKey("", nodeSubnet)] = true
+	}
+	listed, err := rc.routes.ListRoutes(ctx, rc.clusterName, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range listed {
+		if found[routeKey("", route.DestinationCIDR)] || route.TargetNode == "" ||
+			!strings.Contains(node.Spec.ProviderID, string(route.TargetNode)) ||
+			!rc.isResponsibleForRoute(route) {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
 func (rc *RouteController) reconcile() error {
 	ctx := context.Background()
 	start := time.Now()
@@ -311,15 +534,14 @@ func (rc *RouteController) reconcile() error {
 	if err != nil {
 		return fmt.Errorf("RouteTables: %s", err.Error())
 	}
+	var ops []*routeOp
 	for _, table := range tabs {
 		//ListRoutes & Sync
 		routeList, err := rc.routes.ListRoutes(ctx, rc.clusterName, table)
 		if err != nil {
 			return fmt.Errorf("error listing routes: %v", err)
 		}
-		if err := rc.sync(ctx, table, nodes, routeList); err != nil {
-			return fmt.Errorf("reconcile route for table [%s] error: %s", table, err.Error())
-		}
+		ops = append(ops, rc.sync(ctx, table, nodes, routeList)...)
 		if rc.cenid != "" {
 			// if cenid is configured , try to publish route into CEN
 			err := rc.syncPublishedRoutes(ctx, table, nodes, routeList)
@@ -328,6 +550,10 @@ func (rc *RouteController) reconcile() error {
 			}
 		}
 	}
+	// ignore error return. Try it next time anyway.
+	if err := rc.scheduler.run(ctx, ops); err != nil {
+		klog.Errorf("try create route error: %s", err.Error())
+	}
 	metric.RouteLatency.WithLabelValues("reconcile").Observe(metric.MsSince(start))
 	return nil
 }
@@ -371,17 +597,20 @@ func (rc *RouteController) syncPublishedRoutes(
 	return nil
 }
 
+// sync delete the conflicted routes of the table, and return the routes to
+// be created for nodes.
 // Aoxn: Alibaba cloud does not support concurrent route operation
-func (rc *RouteController) sync(ctx context.Context, table string, nodes []*v1.Node, routes []*cloudprovider.Route) error {
+func (rc *RouteController) sync(ctx context.Context, table string, nodes []*v1.Node, routes []*cloudprovider.Route) []*routeOp {
 
 	//try delete conflicted route from vpc route table.
+	unlock := rc.scheduler.lockTable(table)
 	for _, route := range routes {
 		if !rc.isResponsibleForRoute(route) {
 			continue
 		}
 
 		// Check if this route is a blackhole, or applies to a node we know about & has an incorrect CIDR.
-		if route.Blackhole || rc.isRouteConflicted(nodes, route) {
+		if route.Blackhole || rc.isRouteConflicted(nodes, route) || rc.isRouteStale(nodes, route) {
 
 			// Aoxn: Alibaba cloud does not support concurrent route operation
 			klog.Infof("Deleting route %s %s", route.Name, route.DestinationCIDR)
@@ -392,7 +621,9 @@ func (rc *RouteController) sync(ctx context.Context, table string, nodes []*v1.N
 			klog.Infof("Delete route %s %s from table %s SUCCESS.", route.Name, route.DestinationCIDR, table)
 		}
 	}
+	unlock()
 	cached := RouteCacheMap(routes)
+	var ops []*routeOp
 	// try create desired routes
 	for _, node := range nodes {
 
@@ -400,15 +631,12 @@ func (rc *RouteController) sync(ctx context.Context, table string, nodes []*v1.N
 			continue
 		}
 
-		var nodeSubnet string
-		ipnet, err := GetOVNNodeHostSubnet(node)
-		if err == nil {
-			nodeSubnet = ipnet[0].String()
-		} else {
-			nodeSubnet = node.Spec.PodCIDR
+		subnets, err := rc.subnets.NodeSubnets(node)
+		if err != nil {
+			klog.Errorf("subnets of node %s: %s", node.Name, err.Error())
+			continue
 		}
-
-		if nodeSubnet == "" {
+		if len(subnets) == 0 {
 			err := rc.updateNetworkingCondition(types.NodeName(node.Name), false)
 			if err != nil {
 				klog.Errorf("route, update network condition error: %s", err.Error())
@@ -419,13 +647,14 @@ func (rc *RouteController) sync(ctx context.Context, table string, nodes []*v1.N
 			klog.Errorf("Node %s has no Provider ID, skip it", node.Name)
 			continue
 		}
-		// ignore error return. Try it next time anyway.
-		err = rc.tryCreateRoute(ctx, table, node, cached)
+		pending, err := rc.routesToCreate(table, node, cached)
 		if err != nil {
 			klog.Errorf("try create route error: %s", err.Error())
+			continue
 		}
+		ops = append(ops, pending...)
 	}
-	return nil
+	return ops
 }
 
 // RouteCacheMap return cached map for routes
@@ -434,158 +663,181 @@ func RouteCacheMap(routes []*cloudprovider.Route) map[string]*cloudprovider.Rout
 	routeMap := make(map[string]*cloudprovider.Route)
 	for _, route := range routes {
 		if route.TargetNode != "" && route.DestinationCIDR != "" {
-			routeKey := fmt.Sprintf("%s-%s", route.TargetNode, route.DestinationCIDR)
-			routeMap[routeKey] = route
+			routeMap[routeKey(string(route.TargetNode), route.DestinationCIDR)] = route
 		}
 	}
 	return routeMap
 }
 
-func (rc *RouteController) tryCreateRoute(
-	ctx context.Context,
+// routeKey key of the route in RouteCacheMap, ipv6 cidrs are compared in
+// canonical form.
+func routeKey(target, cidr string) string {
+	if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+		cidr = ipnet.String()
+	}
+	return fmt.Sprintf("%s-%s", target, cidr)
+}
+
+// routesToCreate routes of the node to be created in the table, one for each
+// subnet of the node which has no route yet. Subnets out of the cluster cidrs
+// are skipped, their routes are not listed and would be created every sync.
+func (rc *RouteController) routesToCreate(
 	table string,
 	node *v1.Node,
 	cache map[string]*cloudprovider.Route,
-) error {
+) ([]*routeOp, error) {
 
 	_, condition := helpers.GetNodeCondition(&node.Status, v1.NodeReady)
 	if condition != nil && condition.Status == v1.ConditionUnknown {
 		klog.Infof("node %s is in unknown status.Skip creating route.", node.Name)
-		return nil
+		return nil, nil
 	}
 
-	var nodeSubnet string
-	ipnet, err := GetOVNNodeHostSubnet(node)
-	if err == nil {
-		nodeSubnet = ipnet[0].String()
-	} else {
-		nodeSubnet = node.Spec.PodCIDR
+	nodeSubnets, err := rc.subnets.NodeSubnets(node)
+	if err != nil {
+		return nil, fmt.Errorf("subnets of node %s: %s", node.Name, err.Error())
 	}
-
-	if nodeSubnet == "" {
-		return rc.updateNetworkingCondition(types.NodeName(node.Name), false)
+	if len(nodeSubnets) == 0 {
+		return nil, rc.updateNetworkingCondition(types.NodeName(node.Name), false)
 	}
 
 	if node.Spec.ProviderID == "" {
 		klog.Warningf("node %s has no node.Spec.ProviderID, skip it", node.Name)
-		return nil
+		return nil, nil
 	}
 	providerID := node.Spec.ProviderID
-	destinationCIDR := nodeSubnet
-	// Check if we have a route for this node w/ the correct CIDR.
-	routeKey := fmt.Sprintf("%s-%s", providerID, destinationCIDR)
-	r := cache[routeKey]
-	if r == nil || r.DestinationCIDR != nodeSubnet {
-		start := time.Now()
-		// If not, create the route.
+	var ops []*routeOp
+	for _, nodeSubnet := range nodeSubnets {
+		// Check if we have a route for this node w/ the correct CIDR.
+		if cache[routeKey(providerID, nodeSubnet)] != nil {
+			continue
+		}
 		route := &cloudprovider.Route{
 			TargetNode:      types.NodeName(providerID),
 			DestinationCIDR: nodeSubnet,
 		}
-
-		backoff := wait.Backoff{
-			Duration: 4 * time.Second,
-			Steps:    3,
-			Factor:   2,
-			Jitter:   1,
+		if !rc.isResponsibleForRoute(route) {
+			klog.Warningf("subnet %s of node %s is out of cluster cidrs, skip creating route.", nodeSubnet, node.Name)
+			continue
 		}
-		var lasterr error
-		err := wait.ExponentialBackoff(backoff, func() (bool, error) {
-
-			klog.Infof("Creating route for node %s %s with hint %s", node.Name, route.DestinationCIDR, node.Name)
-			err := rc.routes.CreateRoute(ctx, rc.clusterName, node.Name, table, route)
-			if err != nil {
-				lasterr = err
-				if strings.Contains(err.Error(), "not found") {
-					klog.Infof("not found route %s", err.Error())
-					return true, nil
-				}
-				klog.Errorf("Backoff creating route: %s", err.Error())
-				return false, nil
-			}
-			return true, nil
+		// If not, create the route.
+		ops = append(ops, &routeOp{
+			node:  node,
+			table: table,
+			route: route,
+			start: time.Now(),
 		})
-
-		ref := &v1.ObjectReference{
-			Kind:      "Node",
-			Name:      node.Name,
-			UID:       node.UID,
-			Namespace: "",
-		}
-		if err != nil {
-			rc.recorder.Eventf(
-				ref,
-				v1.EventTypeWarning,
-				"CreateRouteFailed",
-				"Error creating route: %s",
-				err.Error())
-			klog.Errorf("could not create route %s for node %s: %v -> %v", route.DestinationCIDR, node.Name, err, lasterr)
-		} else {
-			rc.recorder.Eventf(
-				ref,
-				v1.EventTypeNormal,
-				"CreatedRoute",
-				"Created route for %s with %s -> %s successfully",
-				table, node.Name, nodeSubnet,
-			)
-			klog.Infof("Created route for %s with %s -> %s", table, node.Name, nodeSubnet)
-		}
-		metric.RouteLatency.WithLabelValues("create").Observe(metric.MsSince(start))
-		klog.Infof("Created route for %s with %s -> %s", table, node.Name, nodeSubnet)
-		return rc.updateNetworkingCondition(types.NodeName(node.Name), err == nil)
+	}
+	if len(ops) > 0 {
+		return ops, nil
 	}
 	// Update condition only if it doesn't reflect the current state.
 	_, condition = helpers.GetNodeCondition(&node.Status, v1.NodeNetworkUnavailable)
 	if condition != nil &&
 		condition.Status == v1.ConditionFalse {
-		return nil
+		return nil, nil
+	}
+	return nil, rc.updateNetworkingCondition(types.NodeName(node.Name), true)
+}
+
+// routeCreated record the result of the route creation
+func (rc *RouteController) routeCreated(op *routeOp, err error) {
+	ref := &v1.ObjectReference{
+		Kind:      "Node",
+		Name:      op.node.Name,
+		UID:       op.node.UID,
+		Namespace: "",
+	}
+	if err != nil {
+		rc.recorder.Eventf(
+			ref,
+			v1.EventTypeWarning,
+			"CreateRouteFailed",
+			"Error creating route: %s",
+			err.Error())
+		klog.Errorf("could not create route %s for node %s: %v", op.route.DestinationCIDR, op.node.Name, err)
+	} else {
+		rc.recorder.Eventf(
+			ref,
+			v1.EventTypeNormal,
+			"CreatedRoute",
+			"Created route for %s with %s -> %s successfully",
+			op.table, op.node.Name, op.route.DestinationCIDR,
+		)
+		klog.Infof("Created route for %s with %s -> %s", op.table, op.node.Name, op.route.DestinationCIDR)
+	}
+	metric.RouteLatency.WithLabelValues("create").Observe(metric.MsSince(op.start))
+}
+
+// nodeRoutesCreated update the networking condition once routes of the node
+// are created in all tables.
+func (rc *RouteController) nodeRoutesCreated(node *v1.Node, err error) {
+	if cerr := rc.updateNetworkingCondition(types.NodeName(node.Name), err == nil); cerr != nil {
+		klog.Errorf("route, update network condition error: %s", cerr.Error())
 	}
-	return rc.updateNetworkingCondition(types.NodeName(node.Name), true)
 }
 
 func (rc *RouteController) isRouteConflicted(nodes []*v1.Node, route *cloudprovider.Route) bool {
 	for _, node := range nodes {
-		var nodeSubnet string
-		ipnet, err := GetOVNNodeHostSubnet(node)
-		if err == nil {
-			nodeSubnet = ipnet[0].String()
-		} else {
-			nodeSubnet = node.Spec.PodCIDR
-		}
-		// skip node without podcidr
-		if nodeSubnet == "" {
-			continue
+		// skip node whose subnets are unknown
+		nodeSubnets, _ := rc.subnets.NodeSubnets(node)
+		for _, nodeSubnet := range nodeSubnets {
+			if routeKey("", nodeSubnet) == routeKey("", route.DestinationCIDR) &&
+				!strings.Contains(node.Spec.ProviderID, string(route.TargetNode)) {
+				// conflicted with exist route.
+				return true
+			}
+			contains, err := RealContainsCidr(nodeSubnet, route.DestinationCIDR)
+			if err != nil {
+				// record event an error out.
+				if rc.recorder != nil {
+					rc.recorder.Eventf(
+						&v1.ObjectReference{
+							Kind:      "Node",
+							Name:      node.Name,
+							UID:       node.UID,
+							Namespace: "",
+						},
+						v1.EventTypeWarning,
+						"SyncRouteFailed",
+						"Error syncing route :route conflict, %s",
+						err.Error(),
+					)
+				}
+				klog.Errorf("route conflicted: NodeSubnet=%s -> "+
+					"route.CIDR=%s, %s", nodeSubnet, route.DestinationCIDR, err.Error())
+				return false
+			}
+			if contains {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		if nodeSubnet == route.DestinationCIDR &&
+// isRouteStale whether the route targets one of the nodes but none of its
+// subnets, e.g. the PodCIDR of the node changed. Nodes whose subnets are
+// unknown are skipped.
+func (rc *RouteController) isRouteStale(nodes []*v1.Node, route *cloudprovider.Route) bool {
+	if route.TargetNode == "" {
+		return false
+	}
+	for _, node := range nodes {
+		if utils.IsExcludedNode(node) || node.Spec.ProviderID == "" ||
 			!strings.Contains(node.Spec.ProviderID, string(route.TargetNode)) {
-			// conflicted with exist route.
-			return true
+			continue
 		}
-		contains, err := RealContainsCidr(nodeSubnet, route.DestinationCIDR)
-		if err != nil {
-			// record event an error out.
-			if rc.recorder != nil {
-				rc.recorder.Eventf(
-					&v1.ObjectReference{
-						Kind:      "Node",
-						Name:      node.Name,
-						UID:       node.UID,
-						Namespace: "",
-					},
-					v1.EventTypeWarning,
-					"SyncRouteFailed",
-					"Error syncing route :route conflict, %s",
-					err.Error(),
-				)
-			}
-			klog.Errorf("route conflicted: NodeSubnet=%s -> "+
-				"route.CIDR=%s, %s", nodeSubnet, route.DestinationCIDR, err.Error())
+		nodeSubnets, err := rc.subnets.NodeSubnets(node)
+		if err != nil || len(nodeSubnets) == 0 {
 			return false
 		}
-		if contains {
-			return true
+		for _, nodeSubnet := range nodeSubnets {
+			if routeKey("", nodeSubnet) == routeKey("", route.DestinationCIDR) {
+				return false
+			}
 		}
+		return true
 	}
 	return false
 }
@@ -632,15 +884,17 @@ func (rc *RouteController) isResponsibleForRoute(route *cloudprovider.Route) boo
 		klog.Errorf("Ignoring route %s, unparsable CIDR: %v", route.Name, err)
 		return false
 	}
-	// Not responsible if this route's CIDR is not within our clusterCIDR
+	// Not responsible if this route's CIDR is not within any of our clusterCIDRs
 	lastIP := make([]byte, len(cidr.IP))
 	for i := range lastIP {
 		lastIP[i] = cidr.IP[i] | ^cidr.Mask[i]
 	}
-	if !rc.clusterCIDR.Contains(cidr.IP) || !rc.clusterCIDR.Contains(lastIP) {
-		return false
+	for _, clusterCIDR := range rc.clusterCIDRs {
+		if clusterCIDR.Contains(cidr.IP) && clusterCIDR.Contains(lastIP) {
+			return true
+		}
 	}
-	return true
+	return false
 }
 
 func broadcaster() (record.EventRecorder, record.EventBroadcaster) {
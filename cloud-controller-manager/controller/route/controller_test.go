@@ -0,0 +1,385 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/node/helpers"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRoutes routes of the tables in memory
+type fakeRoutes struct {
+	lock   sync.Mutex
+	tables map[string][]*cloudprovider.Route
+	// errs errors returned by SubmitRoute of the table one by one
+	errs map[string][]error
+	// waits WaitRouteTable calls of the table
+	waits map[string]int
+	// submitting tables being submitted to, and the max of them
+	submitting    map[string]bool
+	maxSubmitting int
+}
+
+func (f *fakeRoutes) RouteTables(ctx context.Context, clusterName string) ([]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var tables []string
+	for table := range f.tables {
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func (f *fakeRoutes) ListRoutes(ctx context.Context, clusterName string, table string) ([]*cloudprovider.Route, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*cloudprovider.Route{}, f.tables[table]...), nil
+}
+
+func (f *fakeRoutes) CreateRoute(ctx context.Context, clusterName string, nameHint string, table string, route *cloudprovider.Route) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.tables[table] = append(f.tables[table], route)
+	return nil
+}
+
+func (f *fakeRoutes) SubmitRoute(ctx context.Context, clusterName string, nameHint string, table string, route *cloudprovider.Route) error {
+	f.lock.Lock()
+	if f.submitting == nil {
+		f.submitting = map[string]bool{}
+	}
+	if f.submitting[table] {
+		f.lock.Unlock()
+		return fmt.Errorf("concurrent operation on table %s", table)
+	}
+	f.submitting[table] = true
+	if len(f.submitting) > f.maxSubmitting {
+		f.maxSubmitting = len(f.submitting)
+	}
+	f.lock.Unlock()
+	// hold the table for a while to observe concurrent submissions
+	time.Sleep(10 * time.Millisecond)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.submitting, table)
+	if errs := f.errs[table]; len(errs) > 0 {
+		f.errs[table] = errs[1:]
+		if errs[0] != nil {
+			return errs[0]
+		}
+	}
+	f.tables[table] = append(f.tables[table], route)
+	return nil
+}
+
+func (f *fakeRoutes) WaitRouteTable(ctx context.Context, clusterName string, table string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.waits == nil {
+		f.waits = map[string]int{}
+	}
+	f.waits[table]++
+	return nil
+}
+
+func (f *fakeRoutes) DeleteRoute(ctx context.Context, clusterName string, table string, route *cloudprovider.Route) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.submitting[table] {
+		return fmt.Errorf("concurrent operation on table %s", table)
+	}
+	var routes []*cloudprovider.Route
+	for _, r := range f.tables[table] {
+		if r.DestinationCIDR != route.DestinationCIDR || r.TargetNode != route.TargetNode {
+			routes = append(routes, r)
+		}
+	}
+	f.tables[table] = routes
+	return nil
+}
+
+func (f *fakeRoutes) ListPublishedRoutes(ctx context.Context, clusterName string, tableid string) ([]*cloudprovider.Route, error) {
+	return nil, nil
+}
+
+func (f *fakeRoutes) PublishRoute(ctx context.Context, clusterName string, tableid string, route *cloudprovider.Route) error {
+	return nil
+}
+
+func (f *fakeRoutes) has(table, node, cidr string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, r := range f.tables[table] {
+		if string(r.TargetNode) == node && r.DestinationCIDR == cidr {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateRouteOnNodeSubnetChange(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: types.UID("uid-node-1")},
+		Spec:       v1.NodeSpec{ProviderID: "cn-hangzhou.i-1"},
+	}
+	client := fake.NewSimpleClientset(node)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	routes := &fakeRoutes{tables: map[string][]*cloudprovider.Route{"vtb-1": nil, "vtb-2": nil}}
+	_, cidr, _ := net.ParseCIDR("172.16.0.0/16")
+	rc, err := New(routes, client, factory.Core().V1().Nodes(), "cluster", []*net.IPNet{cidr}, "", nil)
+	if err != nil {
+		t.Fatalf("new route controller: %s", err.Error())
+	}
+	rc.recorder = record.NewFakeRecorder(10)
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+
+	que := rc.queues[NODE_ROUTE_QUEUE]
+	waitQueued := func() {
+		err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			return que.Len() > 0, nil
+		})
+		if err != nil {
+			t.Fatal("expect node queued")
+		}
+	}
+	waitSynced := func(name string, check func(node *v1.Node) bool) {
+		err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			node, err := rc.nodeLister.Get(name)
+			return err == nil && check(node), nil
+		})
+		if err != nil {
+			t.Fatalf("node %s is not synced", name)
+		}
+	}
+	if que.Len() != 0 {
+		t.Fatal("node without subnet should not be queued")
+	}
+
+	// pod cidr assigned
+	node = node.DeepCopy()
+	node.Spec.PodCIDR = "172.16.1.0/24"
+	if _, err := client.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update node: %s", err.Error())
+	}
+	waitQueued()
+	waitSynced("node-1", func(node *v1.Node) bool { return node.Spec.PodCIDR != "" })
+	rc.processNodeRoute()
+	for _, table := range []string{"vtb-1", "vtb-2"} {
+		if !routes.has(table, "cn-hangzhou.i-1", "172.16.1.0/24") {
+			t.Fatalf("expect route of node created in %s", table)
+		}
+	}
+	updated, err := client.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get node: %s", err.Error())
+	}
+	_, condition := helpers.GetNodeCondition(&updated.Status, v1.NodeNetworkUnavailable)
+	if condition == nil || condition.Status != v1.ConditionFalse {
+		t.Fatalf("expect network available, got %v", condition)
+	}
+
+	// ovn host subnet changed
+	updated.Annotations = map[string]string{ovnNodeSubnets: `{"default":"172.16.2.0/24"}`}
+	if _, err := client.CoreV1().Nodes().Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update node: %s", err.Error())
+	}
+	waitQueued()
+	waitSynced("node-1", func(node *v1.Node) bool {
+		subnets, _ := rc.subnets.NodeSubnets(node)
+		return reflect.DeepEqual(subnets, []string{"172.16.2.0/24"})
+	})
+	rc.processNodeRoute()
+	for _, table := range []string{"vtb-1", "vtb-2"} {
+		if !routes.has(table, "cn-hangzhou.i-1", "172.16.2.0/24") {
+			t.Fatalf("expect route of ovn subnet created in %s", table)
+		}
+		if routes.has(table, "cn-hangzhou.i-1", "172.16.1.0/24") {
+			t.Fatalf("expect route of previous subnet deleted from %s", table)
+		}
+	}
+
+	// routes of previous subnets left by a missed event are deleted on reconcile
+	routes.tables["vtb-2"] = append(routes.tables["vtb-2"],
+		&cloudprovider.Route{TargetNode: "cn-hangzhou.i-1", DestinationCIDR: "172.16.1.0/24"})
+	if err := rc.reconcile(); err != nil {
+		t.Fatalf("reconcile: %s", err.Error())
+	}
+	if routes.has("vtb-2", "cn-hangzhou.i-1", "172.16.1.0/24") ||
+		!routes.has("vtb-2", "cn-hangzhou.i-1", "172.16.2.0/24") {
+		t.Fatalf("unexpected routes after reconcile %v", routes.tables["vtb-2"])
+	}
+}
+
+func TestDualStackRoutes(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: types.UID("uid-node-1")},
+		Spec: v1.NodeSpec{
+			ProviderID: "cn-hangzhou.i-1",
+			PodCIDR:    "172.16.1.0/24",
+			PodCIDRs:   []string{"172.16.1.0/24", "2408:4005:3f6:2400::/64"},
+		},
+	}
+	client := fake.NewSimpleClientset(node)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	routes := &fakeRoutes{tables: map[string][]*cloudprovider.Route{
+		"vtb-1": {
+			// stale route of the node, and route out of cluster cidrs
+			{Name: "stale", TargetNode: "cn-hangzhou.i-2", DestinationCIDR: "2408:4005:3f6:2400::/64"},
+			{Name: "other", TargetNode: "cn-hangzhou.i-3", DestinationCIDR: "2408:4005:3f7:100::/64"},
+		},
+	}}
+	cidrs, err := ParseClusterCIDRs("172.16.0.0/16, 2408:4005:3f6::/48")
+	if err != nil {
+		t.Fatalf("parse cluster cidrs: %s", err.Error())
+	}
+	rc, err := New(routes, client, factory.Core().V1().Nodes(), "cluster", cidrs, "", nil)
+	if err != nil {
+		t.Fatalf("new route controller: %s", err.Error())
+	}
+	rc.recorder = record.NewFakeRecorder(10)
+	_ = factory.Core().V1().Nodes().Informer().GetIndexer().Add(node)
+
+	if err := rc.reconcile(); err != nil {
+		t.Fatalf("reconcile: %s", err.Error())
+	}
+	for _, cidr := range node.Spec.PodCIDRs {
+		if !routes.has("vtb-1", "cn-hangzhou.i-1", cidr) {
+			t.Fatalf("expect route %s of node created", cidr)
+		}
+	}
+	if routes.has("vtb-1", "cn-hangzhou.i-2", "2408:4005:3f6:2400::/64") {
+		t.Fatal("expect conflicted ipv6 route deleted")
+	}
+	if !routes.has("vtb-1", "cn-hangzhou.i-3", "2408:4005:3f7:100::/64") {
+		t.Fatal("route out of cluster cidrs should be kept")
+	}
+
+	// routes of all families are removed on node deletion
+	if err := rc.syncd(node); err != nil {
+		t.Fatalf("delete routes of node: %s", err.Error())
+	}
+	for _, cidr := range node.Spec.PodCIDRs {
+		if routes.has("vtb-1", "cn-hangzhou.i-1", cidr) {
+			t.Fatalf("expect route %s of node deleted", cidr)
+		}
+	}
+
+	// routes to the node are removed even if its subnets are released
+	routes.tables["vtb-1"] = append(routes.tables["vtb-1"],
+		&cloudprovider.Route{TargetNode: "cn-hangzhou.i-1", DestinationCIDR: "172.16.5.0/24"},
+		&cloudprovider.Route{TargetNode: "cn-hangzhou.i-1", DestinationCIDR: "192.168.0.0/24"},
+	)
+	released := node.DeepCopy()
+	released.Spec.PodCIDR = ""
+	released.Spec.PodCIDRs = nil
+	if err := rc.syncd(released); err != nil {
+		t.Fatalf("delete routes of node: %s", err.Error())
+	}
+	if routes.has("vtb-1", "cn-hangzhou.i-1", "172.16.5.0/24") {
+		t.Fatal("expect route of released subnet deleted")
+	}
+	if !routes.has("vtb-1", "cn-hangzhou.i-1", "192.168.0.0/24") {
+		t.Fatal("route out of cluster cidrs should be kept")
+	}
+}
+
+func TestSkipSubnetOutOfClusterCIDRs(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: types.UID("uid-node-1")},
+		Spec: v1.NodeSpec{
+			ProviderID: "cn-hangzhou.i-1",
+			PodCIDR:    "172.16.1.0/24",
+			PodCIDRs:   []string{"172.16.1.0/24", "2408:4005:3f6:2400::/64"},
+		},
+	}
+	client := fake.NewSimpleClientset(node)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	routes := &fakeRoutes{tables: map[string][]*cloudprovider.Route{"vtb-1": {}}}
+	// ipv6 routes are not listed for ipv4 cluster
+	cidrs, err := ParseClusterCIDRs("172.16.0.0/16")
+	if err != nil {
+		t.Fatalf("parse cluster cidrs: %s", err.Error())
+	}
+	rc, err := New(routes, client, factory.Core().V1().Nodes(), "cluster", cidrs, "", nil)
+	if err != nil {
+		t.Fatalf("new route controller: %s", err.Error())
+	}
+	rc.recorder = record.NewFakeRecorder(10)
+	_ = factory.Core().V1().Nodes().Informer().GetIndexer().Add(node)
+
+	ops, err := rc.routesToCreate("vtb-1", node, nil)
+	if err != nil {
+		t.Fatalf("routes to create: %s", err.Error())
+	}
+	if len(ops) != 1 || ops[0].route.DestinationCIDR != "172.16.1.0/24" {
+		t.Fatalf("expect only route of subnet in cluster cidrs, got %v", ops)
+	}
+	if err := rc.reconcile(); err != nil {
+		t.Fatalf("reconcile: %s", err.Error())
+	}
+	if !routes.has("vtb-1", "cn-hangzhou.i-1", "172.16.1.0/24") {
+		t.Fatal("expect route of node created")
+	}
+	if routes.has("vtb-1", "cn-hangzhou.i-1", "2408:4005:3f6:2400::/64") {
+		t.Fatal("expect route out of cluster cidrs not created")
+	}
+}
+
+func TestRouteTableOperationsSerialized(t *testing.T) {
+	deleted := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+		Spec:       v1.NodeSpec{ProviderID: "cn-hangzhou.i-0", PodCIDR: "172.16.0.0/24"},
+	}
+	routes := &fakeRoutes{tables: map[string][]*cloudprovider.Route{
+		"vtb-1": {{TargetNode: "cn-hangzhou.i-0", DestinationCIDR: "172.16.0.0/24"}},
+	}}
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	_, cidr, _ := net.ParseCIDR("172.16.0.0/16")
+	rc, err := New(routes, client, factory.Core().V1().Nodes(), "cluster", []*net.IPNet{cidr}, "", nil)
+	if err != nil {
+		t.Fatalf("new route controller: %s", err.Error())
+	}
+	rc.recorder = record.NewFakeRecorder(100)
+
+	var ops []*routeOp
+	for i := 1; i <= 5; i++ {
+		ops = append(ops, &routeOp{
+			node:  &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}},
+			table: "vtb-1",
+			route: &cloudprovider.Route{
+				TargetNode:      types.NodeName(fmt.Sprintf("cn-hangzhou.i-%d", i)),
+				DestinationCIDR: fmt.Sprintf("172.16.%d.0/24", i),
+			},
+		})
+	}
+	// creations and deletions of the table never overlap
+	created := make(chan error)
+	go func() { created <- rc.scheduler.run(context.TODO(), ops) }()
+	time.Sleep(5 * time.Millisecond)
+	if err := rc.syncd(deleted); err != nil {
+		t.Fatalf("delete routes of node: %s", err.Error())
+	}
+	if err := <-created; err != nil {
+		t.Fatalf("create routes: %s", err.Error())
+	}
+	if routes.has("vtb-1", "cn-hangzhou.i-0", "172.16.0.0/24") || len(routes.tables["vtb-1"]) != 5 {
+		t.Fatalf("unexpected routes %v", routes.tables["vtb-1"])
+	}
+}
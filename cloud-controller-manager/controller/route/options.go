@@ -4,6 +4,7 @@ import (
 	"fmt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net"
+	"strings"
 )
 
 // RoutesOptions route controller options
@@ -14,11 +15,48 @@ type RoutesOptions struct {
 	MinResyncPeriod           metav1.Duration
 	RouteReconciliationPeriod metav1.Duration
 	ControllerStartInterval   metav1.Duration
+	// ConcurrentRouteTableSyncs route tables operated concurrently
+	ConcurrentRouteTableSyncs int
+	// NodeSubnetSource source of node subnets, see NewNodeSubnetProvider
+	NodeSubnetSource string
+	// NodeSubnetAnnotation node annotation of subnets for annotation source
+	NodeSubnetAnnotation string
 }
 
 // Options global options for route controller
 var Options = RoutesOptions{}
 
+// ParseClusterCIDRs parse the comma separated cluster cidrs, a dual-stack
+// cluster has an ipv4 and an ipv6 cidr.
+func ParseClusterCIDRs(cidrs string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse cluster cidr %s: %s", cidr, err.Error())
+		}
+		result = append(result, ipnet)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no cluster cidr specified")
+	}
+	return result, nil
+}
+
+// HasIPv6 whether any of the cidrs is ipv6
+func HasIPv6(cidrs []*net.IPNet) bool {
+	for _, cidr := range cidrs {
+		if cidr.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // RealContainsCidr real contains cidr
 func RealContainsCidr(outer string, inner string) (bool, error) {
 	contains, err := ContainsCidr(outer, inner)
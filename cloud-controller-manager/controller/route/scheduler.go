@@ -0,0 +1,223 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider"
+	"k8s.io/klog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULT_ROUTE_TABLE_CONCURRENCY route tables operated concurrently
+	DEFAULT_ROUTE_TABLE_CONCURRENCY = 3
+
+	// DEFAULT_ROUTE_BATCH_SIZE routes submitted to a table before waiting for
+	// them to be available
+	DEFAULT_ROUTE_BATCH_SIZE = 10
+)
+
+// retryableRouteErrors route table is busy with other operations, the
+// operation succeeds when retried later.
+var retryableRouteErrors = []string{
+	"IncorrectRouteEntryStatus",
+	"OperationConflict",
+	"TaskConflict",
+	"concurrent operation",
+}
+
+// routeBackoff backoff of operations rejected by busy route table
+var routeBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   1.5,
+	Jitter:   0.5,
+	Steps:    8,
+}
+
+// routeOp creation of the route of a node in a route table
+type routeOp struct {
+	node  *v1.Node
+	table string
+	route *cloudprovider.Route
+	start time.Time
+}
+
+// routeScheduler create routes in batches. Routes of a table are submitted
+// one after another and waited together, since route table does not accept
+// concurrent operations. Different tables are operated concurrently.
+type routeScheduler struct {
+	routes      Routes
+	clusterName string
+	concurrency int
+	batchSize   int
+	backoff     wait.Backoff
+	// tables locks of route tables, operations of a table from different
+	// runs and route deletions are serialized, see lockTable.
+	tables sync.Map
+
+	// created called with the result of each route
+	created func(op *routeOp, err error)
+	// nodeDone called when routes of the node are created in all tables,
+	// err is the first error of the routes.
+	nodeDone func(node *v1.Node, err error)
+}
+
+func newRouteScheduler(routes Routes, clusterName string, concurrency int) *routeScheduler {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_ROUTE_TABLE_CONCURRENCY
+	}
+	return &routeScheduler{
+		routes:      routes,
+		clusterName: clusterName,
+		concurrency: concurrency,
+		batchSize:   DEFAULT_ROUTE_BATCH_SIZE,
+		backoff:     routeBackoff,
+		created:     func(op *routeOp, err error) {},
+		nodeDone:    func(node *v1.Node, err error) {},
+	}
+}
+
+// run create the routes, and return the aggregated errors.
+func (s *routeScheduler) run(ctx context.Context, ops []*routeOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	var (
+		lock    sync.Mutex
+		errs    []error
+		pending = make(map[string]int)
+		failed  = make(map[string]error)
+		tables  []string
+		batches = make(map[string][]*routeOp)
+	)
+	for _, op := range ops {
+		pending[op.node.Name]++
+		if _, ok := batches[op.table]; !ok {
+			tables = append(tables, op.table)
+		}
+		batches[op.table] = append(batches[op.table], op)
+	}
+	report := func(op *routeOp, err error) {
+		s.created(op, err)
+		lock.Lock()
+		if err != nil {
+			errs = append(errs, err)
+			if failed[op.node.Name] == nil {
+				failed[op.node.Name] = err
+			}
+		}
+		pending[op.node.Name]--
+		done := pending[op.node.Name] == 0
+		lock.Unlock()
+		if done {
+			s.nodeDone(op.node, failed[op.node.Name])
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.concurrency)
+	for _, table := range tables {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(table string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.runTable(ctx, table, batches[table], report)
+		}(table)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// runTable submit the routes of the table in batches, and wait each batch
+// available before the next one.
+func (s *routeScheduler) runTable(ctx context.Context, table string, ops []*routeOp, report func(op *routeOp, err error)) {
+	defer s.lockTable(table)()
+
+	for len(ops) > 0 {
+		size := s.batchSize
+		if size <= 0 || size > len(ops) {
+			size = len(ops)
+		}
+		var submitted []*routeOp
+		for _, op := range ops[:size] {
+			if err := s.submit(ctx, op); err != nil {
+				report(op, err)
+				continue
+			}
+			submitted = append(submitted, op)
+		}
+		ops = ops[size:]
+		if len(submitted) == 0 {
+			continue
+		}
+		err := s.retry(fmt.Sprintf("wait route table %s", table), func() error {
+			return s.routes.WaitRouteTable(ctx, s.clusterName, table)
+		})
+		if err != nil {
+			err = fmt.Errorf("wait routes of table %s available: %s", table, err.Error())
+		}
+		for _, op := range submitted {
+			report(op, err)
+		}
+	}
+}
+
+// lockTable lock the route table and return the unlock func. Route table
+// does not accept concurrent operations, every creation and deletion of
+// routes holds the lock of the table.
+func (s *routeScheduler) lockTable(table string) func() {
+	lock, _ := s.tables.LoadOrStore(table, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+func (s *routeScheduler) submit(ctx context.Context, op *routeOp) error {
+	klog.Infof("Creating route for node %s %s with hint %s", op.node.Name, op.route.DestinationCIDR, op.node.Name)
+	err := s.retry(fmt.Sprintf("create route %s", op.route.DestinationCIDR), func() error {
+		return s.routes.SubmitRoute(ctx, s.clusterName, op.node.Name, op.table, op.route)
+	})
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		klog.Infof("not found route %s", err.Error())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create route %s for node %s: %s", op.route.DestinationCIDR, op.node.Name, err.Error())
+	}
+	return nil
+}
+
+// retry the operation with backoff while the route table is busy
+func (s *routeScheduler) retry(action string, operation func() error) error {
+	var lasterr error
+	err := wait.ExponentialBackoff(s.backoff, func() (bool, error) {
+		lasterr = operation()
+		if lasterr == nil {
+			return true, nil
+		}
+		if !isRetryableRouteError(lasterr) {
+			return false, lasterr
+		}
+		klog.Warningf("Backoff %s: %s", action, lasterr.Error())
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return lasterr
+	}
+	return err
+}
+
+func isRetryableRouteError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, code := range retryableRouteErrors {
+		if strings.Contains(msg, strings.ToLower(code)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cloud-provider"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRouteScheduler(t *testing.T) {
+	routes := &fakeRoutes{
+		tables: map[string][]*cloudprovider.Route{"vtb-1": nil, "vtb-2": nil, "vtb-3": nil},
+		errs: map[string][]error{
+			"vtb-1": {fmt.Errorf("IncorrectRouteEntryStatus: route entry is in transient state")},
+			"vtb-3": {nil, nil, fmt.Errorf("InvalidParameter: bad destination cidr")},
+		},
+	}
+	s := newRouteScheduler(routes, "cluster", 2)
+	s.batchSize = 2
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Steps: 3, Factor: 1}
+
+	var (
+		lock    sync.Mutex
+		created int
+		done    = map[string]error{}
+	)
+	s.created = func(op *routeOp, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		created++
+	}
+	s.nodeDone = func(node *v1.Node, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := done[node.Name]; ok {
+			t.Errorf("node %s reported more than once", node.Name)
+		}
+		done[node.Name] = err
+	}
+
+	var ops []*routeOp
+	for _, table := range []string{"vtb-1", "vtb-2", "vtb-3"} {
+		for i := 1; i <= 3; i++ {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}}
+			ops = append(ops, &routeOp{
+				node:  node,
+				table: table,
+				route: &cloudprovider.Route{
+					TargetNode:      types.NodeName(fmt.Sprintf("i-%d", i)),
+					DestinationCIDR: fmt.Sprintf("172.16.%d.0/24", i),
+				},
+			})
+		}
+	}
+	if err := s.run(context.TODO(), ops); err == nil {
+		t.Fatal("expect error of failed route")
+	}
+
+	// busy table is retried, other errors are not
+	for _, table := range []string{"vtb-1", "vtb-2"} {
+		if len(routes.tables[table]) != 3 {
+			t.Fatalf("expect all routes created in %s, got %d", table, len(routes.tables[table]))
+		}
+	}
+	if len(routes.tables["vtb-3"]) != 2 || routes.has("vtb-3", "i-3", "172.16.3.0/24") {
+		t.Fatalf("expect failed route not retried, got %v", routes.tables["vtb-3"])
+	}
+	// routes are waited per batch
+	expect := map[string]int{"vtb-1": 2, "vtb-2": 2, "vtb-3": 1}
+	for table, waits := range expect {
+		if routes.waits[table] != waits {
+			t.Fatalf("expect table %s waited %d times, got %d", table, waits, routes.waits[table])
+		}
+	}
+	if routes.maxSubmitting > 2 {
+		t.Fatalf("expect at most 2 tables operated concurrently, got %d", routes.maxSubmitting)
+	}
+	// progress is reported per node once all its tables are done
+	if created != 9 || len(done) != 3 {
+		t.Fatalf("unexpected progress, created %d, nodes done %v", created, done)
+	}
+	if done["node-1"] != nil || done["node-2"] != nil || done["node-3"] == nil {
+		t.Fatalf("unexpected node results: %v", done)
+	}
+}
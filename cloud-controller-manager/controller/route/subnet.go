@@ -0,0 +1,234 @@
+package route
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"net"
+	"sort"
+	"strings"
+)
+
+// sources of node subnets, see NewNodeSubnetProvider
+const (
+	// SUBNET_SOURCE_AUTO ovn host subnets of the node if annotated, PodCIDRs otherwise
+	SUBNET_SOURCE_AUTO = "auto"
+	// SUBNET_SOURCE_PODCIDR PodCIDRs of the node
+	SUBNET_SOURCE_PODCIDR = "podcidr"
+	// SUBNET_SOURCE_OVN host subnets of ovn-kubernetes
+	SUBNET_SOURCE_OVN = "ovn"
+	// SUBNET_SOURCE_CALICO ipam blocks affine to the node of calico
+	SUBNET_SOURCE_CALICO = "calico"
+	// SUBNET_SOURCE_ANNOTATION comma separated cidrs in the node annotation
+	SUBNET_SOURCE_ANNOTATION = "annotation"
+
+	calicoBlockAffinityNodeIndex = "node"
+)
+
+// calicoBlockAffinities block affinities of calico ipam
+var calicoBlockAffinities = schema.GroupVersionResource{
+	Group:    "crd.projectcalico.org",
+	Version:  "v1",
+	Resource: "blockaffinities",
+}
+
+// NodeSubnetProvider source of the pod subnets of nodes, a route to the node
+// is created in the route tables for each of its subnets.
+type NodeSubnetProvider interface {
+	// NodeSubnets subnets of the node, empty if not allocated yet
+	NodeSubnets(node *v1.Node) ([]string, error)
+}
+
+// watchedSubnetProvider provider of subnets not kept in node objects, which
+// watches the subnets itself.
+type watchedSubnetProvider interface {
+	NodeSubnetProvider
+	// Run start watching subnets
+	Run(stopCh <-chan struct{})
+	// HasSynced whether subnets of all nodes are known
+	HasSynced() bool
+	// OnSubnetChange register handler called with the name of the node
+	// whose subnets changed
+	OnSubnetChange(handler func(node string))
+}
+
+// NewNodeSubnetProvider provider of the source, annotation is the node
+// annotation key of SUBNET_SOURCE_ANNOTATION.
+func NewNodeSubnetProvider(source, annotation string, config *rest.Config) (NodeSubnetProvider, error) {
+	switch source {
+	case "", SUBNET_SOURCE_AUTO:
+		return &autoSubnets{}, nil
+	case SUBNET_SOURCE_PODCIDR:
+		return &podCIDRSubnets{}, nil
+	case SUBNET_SOURCE_OVN:
+		return &ovnSubnets{}, nil
+	case SUBNET_SOURCE_ANNOTATION:
+		if annotation == "" {
+			return nil, fmt.Errorf("node subnet annotation must be specified for source %s", source)
+		}
+		return &annotationSubnets{key: annotation}, nil
+	case SUBNET_SOURCE_CALICO:
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("create dynamic client: %s", err.Error())
+		}
+		return newCalicoSubnets(client), nil
+	}
+	return nil, fmt.Errorf("unknown node subnet source %s, "+
+		"valid sources are auto, podcidr, ovn, calico and annotation", source)
+}
+
+// podCIDRSubnets PodCIDRs of the node, a dual-stack node has one of each ip family.
+type podCIDRSubnets struct{}
+
+func (p *podCIDRSubnets) NodeSubnets(node *v1.Node) ([]string, error) {
+	if len(node.Spec.PodCIDRs) > 0 {
+		return node.Spec.PodCIDRs, nil
+	}
+	if node.Spec.PodCIDR != "" {
+		return []string{node.Spec.PodCIDR}, nil
+	}
+	return nil, nil
+}
+
+// ovnSubnets host subnets of ovn-kubernetes, see GetOVNNodeHostSubnet
+type ovnSubnets struct{}
+
+func (p *ovnSubnets) NodeSubnets(node *v1.Node) ([]string, error) {
+	ipnets, err := GetOVNNodeHostSubnet(node)
+	if err != nil {
+		if _, ok := err.(annotationNotSetError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var subnets []string
+	for _, ipnet := range ipnets {
+		subnets = append(subnets, ipnet.String())
+	}
+	return subnets, nil
+}
+
+// autoSubnets ovn host subnets if the node is annotated by ovn-kubernetes,
+// otherwise PodCIDRs.
+type autoSubnets struct {
+	ovn     ovnSubnets
+	podCIDR podCIDRSubnets
+}
+
+func (p *autoSubnets) NodeSubnets(node *v1.Node) ([]string, error) {
+	subnets, err := p.ovn.NodeSubnets(node)
+	if err == nil && len(subnets) > 0 {
+		return subnets, nil
+	}
+	return p.podCIDR.NodeSubnets(node)
+}
+
+// annotationSubnets comma separated cidrs in the node annotation
+type annotationSubnets struct {
+	key string
+}
+
+func (p *annotationSubnets) NodeSubnets(node *v1.Node) ([]string, error) {
+	var subnets []string
+	for _, cidr := range strings.Split(node.Annotations[p.key], ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse annotation %s of node %s: %s", p.key, node.Name, err.Error())
+		}
+		subnets = append(subnets, ipnet.String())
+	}
+	return subnets, nil
+}
+
+// calicoSubnets ipam blocks affine to the node, calico allocates pod
+// addresses of the node from these blocks.
+type calicoSubnets struct {
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+}
+
+// newCalicoSubnets provider of calico ipam blocks watched through the
+// blockaffinities of crd.projectcalico.org.
+func newCalicoSubnets(client dynamic.Interface) *calicoSubnets {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(calicoBlockAffinities).Informer()
+	err := informer.AddIndexers(cache.Indexers{
+		calicoBlockAffinityNodeIndex: func(obj interface{}) ([]string, error) {
+			affinity, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return nil, nil
+			}
+			node, _, _ := unstructured.NestedString(affinity.Object, "spec", "node")
+			return []string{node}, nil
+		},
+	})
+	if err != nil {
+		klog.Errorf("add calico block affinity indexer: %s", err.Error())
+	}
+	return &calicoSubnets{factory: factory, informer: informer}
+}
+
+func (p *calicoSubnets) NodeSubnets(node *v1.Node) ([]string, error) {
+	affinities, err := p.informer.GetIndexer().ByIndex(calicoBlockAffinityNodeIndex, node.Name)
+	if err != nil {
+		return nil, fmt.Errorf("list calico block affinities of node %s: %s", node.Name, err.Error())
+	}
+	var subnets []string
+	for _, obj := range affinities {
+		affinity, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		state, _, _ := unstructured.NestedString(affinity.Object, "spec", "state")
+		deleted, _, _ := unstructured.NestedString(affinity.Object, "spec", "deleted")
+		cidr, _, _ := unstructured.NestedString(affinity.Object, "spec", "cidr")
+		// blocks pending are not used by pods yet
+		if state != "confirmed" || deleted == "true" || cidr == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse cidr of calico block affinity %s: %s", affinity.GetName(), err.Error())
+		}
+		subnets = append(subnets, ipnet.String())
+	}
+	sort.Strings(subnets)
+	return subnets, nil
+}
+
+func (p *calicoSubnets) Run(stopCh <-chan struct{}) { p.factory.Start(stopCh) }
+
+func (p *calicoSubnets) HasSynced() bool { return p.informer.HasSynced() }
+
+func (p *calicoSubnets) OnSubnetChange(handler func(node string)) {
+	notify := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		affinity, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		if node, _, _ := unstructured.NestedString(affinity.Object, "spec", "node"); node != "" {
+			handler(node)
+		}
+	}
+	p.informer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    notify,
+			UpdateFunc: func(old, cur interface{}) { notify(cur) },
+			DeleteFunc: notify,
+		},
+	)
+}
@@ -0,0 +1,133 @@
+package route
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/fake"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeSubnetProviders(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-1",
+			Annotations: map[string]string{
+				ovnNodeSubnets:        `{"default":["10.128.1.0/24","fd00:10:128:1::/64"]}`,
+				"example.com/subnets": "10.0.1.0/26, 10.0.2.0/26",
+			},
+		},
+		Spec: v1.NodeSpec{PodCIDR: "172.16.1.0/24", PodCIDRs: []string{"172.16.1.0/24"}},
+	}
+	plain := node.DeepCopy()
+	plain.Annotations = nil
+
+	expects := []struct {
+		source string
+		node   *v1.Node
+		expect []string
+	}{
+		{SUBNET_SOURCE_PODCIDR, node, []string{"172.16.1.0/24"}},
+		{SUBNET_SOURCE_OVN, node, []string{"10.128.1.0/24", "fd00:10:128:1::/64"}},
+		{SUBNET_SOURCE_OVN, plain, nil},
+		{SUBNET_SOURCE_AUTO, node, []string{"10.128.1.0/24", "fd00:10:128:1::/64"}},
+		{SUBNET_SOURCE_AUTO, plain, []string{"172.16.1.0/24"}},
+		{SUBNET_SOURCE_ANNOTATION, node, []string{"10.0.1.0/26", "10.0.2.0/26"}},
+		{SUBNET_SOURCE_ANNOTATION, plain, nil},
+	}
+	for _, e := range expects {
+		provider, err := NewNodeSubnetProvider(e.source, "example.com/subnets", nil)
+		if err != nil {
+			t.Fatalf("new provider %s: %s", e.source, err.Error())
+		}
+		subnets, err := provider.NodeSubnets(e.node)
+		if err != nil {
+			t.Fatalf("subnets of source %s: %s", e.source, err.Error())
+		}
+		if !reflect.DeepEqual(subnets, e.expect) {
+			t.Fatalf("expect subnets %v of source %s, got %v", e.expect, e.source, subnets)
+		}
+	}
+
+	malformed := node.DeepCopy()
+	malformed.Annotations["example.com/subnets"] = "10.0.1.0"
+	provider, _ := NewNodeSubnetProvider(SUBNET_SOURCE_ANNOTATION, "example.com/subnets", nil)
+	if _, err := provider.NodeSubnets(malformed); err == nil {
+		t.Fatal("expect error of malformed annotation")
+	}
+	if _, err := NewNodeSubnetProvider(SUBNET_SOURCE_ANNOTATION, "", nil); err == nil {
+		t.Fatal("expect error without annotation key")
+	}
+	if _, err := NewNodeSubnetProvider("flannel", "", nil); err == nil {
+		t.Fatal("expect error of unknown source")
+	}
+}
+
+func TestCalicoSubnets(t *testing.T) {
+	affinity := func(name, node, cidr, state string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "crd.projectcalico.org/v1",
+			"kind":       "BlockAffinity",
+			"metadata":   map[string]interface{}{"name": name},
+			"spec": map[string]interface{}{
+				"node":    node,
+				"cidr":    cidr,
+				"state":   state,
+				"deleted": "false",
+			},
+		}}
+	}
+	client := fake.NewSimpleDynamicClient(
+		runtime.NewScheme(),
+		affinity("node-1-10-244-1-0-26", "node-1", "10.244.1.0/26", "confirmed"),
+		affinity("node-1-10-244-0-0-26", "node-1", "10.244.0.0/26", "confirmed"),
+		affinity("node-1-10-244-2-0-26", "node-1", "10.244.2.0/26", "pending"),
+		affinity("node-2-10-244-3-0-26", "node-2", "10.244.3.0/26", "confirmed"),
+	)
+	provider := newCalicoSubnets(client)
+	changed := make(chan string, 10)
+	provider.OnSubnetChange(func(node string) { changed <- node })
+	stop := make(chan struct{})
+	defer close(stop)
+	provider.Run(stop)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return provider.HasSynced(), nil
+	}); err != nil {
+		t.Fatal("calico block affinities not synced")
+	}
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	subnets, err := provider.NodeSubnets(node)
+	if err != nil {
+		t.Fatalf("subnets of node: %s", err.Error())
+	}
+	if !reflect.DeepEqual(subnets, []string{"10.244.0.0/26", "10.244.1.0/26"}) {
+		t.Fatalf("expect confirmed blocks of the node, got %v", subnets)
+	}
+
+	// new blocks are notified
+	for len(changed) > 0 {
+		<-changed
+	}
+	_, err = client.Resource(calicoBlockAffinities).Create(
+		context.TODO(),
+		affinity("node-2-10-244-4-0-26", "node-2", "10.244.4.0/26", "confirmed"),
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		t.Fatalf("create block affinity: %s", err.Error())
+	}
+	select {
+	case name := <-changed:
+		if name != "node-2" {
+			t.Fatalf("expect change of node-2, got %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect subnet change notified")
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"time"
+)
+
+// reasons of the phases which are not recorded in a reconcile
+const (
+	ConditionReasonNotRequired = "NotRequired"
+	ConditionReasonNotReached  = "NotReached"
+)
+
+// ServiceCondition condition of service status. Service.Status.Conditions is
+// not available in the vendored api version, conditions are patched as raw json.
+// API servers before 1.20 drop the field from the patch.
+type ServiceCondition struct {
+	Type               string             `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime"`
+	Reason             string             `json:"reason"`
+	Message            string             `json:"message"`
+}
+
+// buildConditions build conditions from the phases recorded in a reconcile.
+// Phases which are not recorded are NotRequired when the reconcile succeeded,
+// and Unknown when it is aborted before reaching them.
+func buildConditions(conditions *utils.SyncConditions, err error) []ServiceCondition {
+	var result []ServiceCondition
+	failed := false
+	for _, ctype := range utils.ConditionTypes {
+		cond := ServiceCondition{
+			Type:   ctype,
+			Status: v1.ConditionTrue,
+			Reason: ConditionReasonNotRequired,
+		}
+		if c := conditions.Get(ctype); c != nil {
+			cond.Reason, cond.Message = c.Reason, c.Message
+			if !c.Synced {
+				cond.Status = v1.ConditionFalse
+				failed = true
+			}
+		} else if err != nil {
+			cond.Status = v1.ConditionUnknown
+			cond.Reason = ConditionReasonNotReached
+		}
+		result = append(result, cond)
+	}
+	if err != nil && !failed {
+		// reconcile failed before or out of the recorded phases
+		result[0].Status = v1.ConditionFalse
+		result[0].Reason = "SyncLoadBalancerFailed"
+		result[0].Message = getLogMessage(err)
+	}
+	return result
+}
+
+// updateConditions patch the conditions of service status after a reconcile,
+// and fire an event for each condition turning into or out of False.
+// LastTransitionTime is kept in memory, conditions are not patched unless
+// changed or force is set.
+func (con *Controller) updateConditions(
+	svc *v1.Service,
+	conditions *utils.SyncConditions,
+	err error,
+	force bool,
+) {
+	now := metav1.NewTime(time.Now())
+	var previous []ServiceCondition
+	if cached, ok := con.conditions.Load(key(svc)); ok {
+		previous = cached.([]ServiceCondition)
+	}
+	current := buildConditions(conditions, err)
+	changed := force || len(previous) != len(current)
+	for i := range current {
+		cond := &current[i]
+		cond.LastTransitionTime = now
+		old := ServiceCondition{Status: v1.ConditionUnknown}
+		if i < len(previous) {
+			old = previous[i]
+			if old.Status == cond.Status {
+				cond.LastTransitionTime = old.LastTransitionTime
+			}
+		}
+		if old.Status != cond.Status ||
+			old.Reason != cond.Reason ||
+			old.Message != cond.Message {
+			changed = true
+		}
+		if old.Status != v1.ConditionFalse && cond.Status == v1.ConditionFalse {
+			con.recorder.Eventf(svc, v1.EventTypeWarning, cond.Reason, "%s: %s", cond.Type, cond.Message)
+		}
+		if old.Status == v1.ConditionFalse && cond.Status == v1.ConditionTrue {
+			con.recorder.Eventf(svc, v1.EventTypeNormal, cond.Reason, "%s is recovered", cond.Type)
+		}
+	}
+	if !changed {
+		return
+	}
+	if perr := con.patchConditions(svc, current); perr != nil {
+		// conditions are patched again on next reconcile
+		klog.Warningf("update conditions of service %s: %s", key(svc), perr.Error())
+		return
+	}
+	con.conditions.Store(key(svc), current)
+}
+
+// removeConditions remove the conditions maintained by ccm when service no
+// longer needs a loadbalancer. Conditions are read from the service status
+// on the api server, the cache is empty after a restart.
+func (con *Controller) removeConditions(svc *v1.Service) error {
+	current, err := con.getConditions(svc)
+	if err != nil {
+		return err
+	}
+	var deleted []map[string]string
+	for _, cond := range current {
+		for _, ctype := range utils.ConditionTypes {
+			if cond.Type == ctype {
+				deleted = append(deleted, map[string]string{"type": ctype, "$patch": "delete"})
+			}
+		}
+	}
+	if len(deleted) > 0 {
+		if err := con.patchConditions(svc, deleted); err != nil {
+			return err
+		}
+	}
+	con.conditions.Delete(key(svc))
+	return nil
+}
+
+// getConditions conditions of the service status on the api server.
+// Conditions are read from the raw json, see Controller.rest.
+func (con *Controller) getConditions(svc *v1.Service) ([]ServiceCondition, error) {
+	if c, ok := con.rest.(*rest.RESTClient); con.rest == nil || ok && c == nil {
+		// rest client is not provided by fake clientset
+		return nil, nil
+	}
+	data, err := con.
+		rest.
+		Get().
+		Namespace(svc.Namespace).
+		Resource("services").
+		Name(svc.Name).
+		DoRaw(context.TODO())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get service status: %s", err.Error())
+	}
+	remote := struct {
+		Status struct {
+			Conditions []ServiceCondition `json:"conditions"`
+		} `json:"status"`
+	}{}
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return nil, fmt.Errorf("unmarshal service status: %s", err.Error())
+	}
+	return remote.Status.Conditions, nil
+}
+
+func (con *Controller) patchConditions(svc *v1.Service, conditions interface{}) error {
+	data, err := json.Marshal(
+		map[string]interface{}{
+			"status": map[string]interface{}{
+				"conditions": conditions,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("marshal conditions: %s", err.Error())
+	}
+	_, err = con.
+		client.
+		CoreV1().
+		Services(svc.Namespace).
+		Patch(context.TODO(), svc.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{}, "status")
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("patch conditions: %s", err.Error())
+	}
+	return nil
+}
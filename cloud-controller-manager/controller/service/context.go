@@ -71,7 +71,7 @@ func NeedUpdate(old, newm *v1.Service, record record.EventRecorder) bool {
 		return true
 	}
 
-	if !reflect.DeepEqual(old.Annotations, newm.Annotations) {
+	if !reflect.DeepEqual(utils.SpecAnnotations(old.Annotations), utils.SpecAnnotations(newm.Annotations)) {
 		klog.Infof("AnnotationChanged: %v -> %v", old.Annotations, newm.Annotations)
 		record.Eventf(
 			newm,
@@ -14,6 +14,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -29,6 +30,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -40,6 +42,8 @@ const (
 
 	LabelNodeRoleMaster = "node-role.kubernetes.io/master"
 
+	// CCM_CLASS loadbalancer class of the service. Service.Spec.LoadBalancerClass
+	// is not available in the vendored api version, annotation is used instead.
 	CCM_CLASS = "service.beta.kubernetes.io/class"
 )
 
@@ -50,9 +54,17 @@ type Controller struct {
 	client      clientset.Interface
 	ifactory    informers.SharedInformerFactory
 	clusterName string
-	local       *Context
-	caster      record.EventBroadcaster
-	recorder    record.EventRecorder
+	// class loadbalancer class owned by this controller.
+	// Services without class are always processed.
+	class    string
+	local    *Context
+	caster   record.EventBroadcaster
+	recorder record.EventRecorder
+	// conditions last conditions patched to service status, keyed by service key
+	conditions sync.Map
+	// rest raw client of services. Service.Status.Conditions is not available
+	// in the vendored api version and is dropped by the typed client.
+	rest rest.Interface
 
 	// Package workqueue provides a simple queue that supports the following
 	// features:
@@ -71,6 +83,7 @@ func NewController(
 	client clientset.Interface,
 	ifactory informers.SharedInformerFactory,
 	clusterName string,
+	class string,
 ) (*Controller, error) {
 
 	recorder, caster := broadcaster(client)
@@ -84,11 +97,13 @@ func NewController(
 	con := &Controller{
 		cloud:       cloud,
 		clusterName: clusterName,
+		class:       class,
 		ifactory:    ifactory,
 		local:       &Context{},
 		caster:      caster,
 		recorder:    recorder,
 		client:      client,
+		rest:        client.CoreV1().RESTClient(),
 		queues: map[string]queue.DelayingInterface{
 			SERVICE_QUEUE: workqueue.NewNamedDelayingQueue(SERVICE_QUEUE),
 		},
@@ -202,8 +217,8 @@ func (con *Controller) HandlerForNodesChange(
 					utils.Logf(svc, "node change: loadbalancer is not needed, skip")
 					return true
 				}
-				if !isProcessNeeded(svc) {
-					utils.Logf(svc, "node change: class not empty, skip process ")
+				if !con.isProcessNeeded(svc) {
+					utils.Logf(svc, "node change: class %s not owned, skip process", svc.Annotations[CCM_CLASS])
 					return true
 				}
 				utils.Logf(svc, "node change: enqueue service")
@@ -255,8 +270,8 @@ func (con *Controller) HandlerForEndpointChange(
 				return
 			}
 		}
-		if !isProcessNeeded(svc) {
-			utils.Logf(svc, "endpoint: class not empty, skip process ")
+		if !con.isProcessNeeded(svc) {
+			utils.Logf(svc, "endpoint: class %s not owned, skip process", svc.Annotations[CCM_CLASS])
 			return
 		}
 		if !NeedLoadBalancer(svc) {
@@ -303,8 +318,8 @@ func (con *Controller) HandlerForServiceChange(
 	record record.EventRecorder,
 ) {
 	syncService := func(svc *v1.Service) {
-		if !isProcessNeeded(svc) {
-			utils.Logf(svc, "class not empty, skip process")
+		if !con.isProcessNeeded(svc) {
+			utils.Logf(svc, "class %s not owned, skip process", svc.Annotations[CCM_CLASS])
 			return
 		}
 		Enqueue(que, key(svc))
@@ -470,6 +485,17 @@ func (con *Controller) ServiceSyncTask(k string) error {
 		// service absence in store means watcher caught the deletion, ensure LB
 		// info is cleaned delete error would cause ReEnqueue svc, which mean retry.
 		utils.Logf(cached, "service has been deleted %v", key(cached))
+		if isReconcilePaused(cached) {
+			utils.Logf(cached, "reconcile paused, loadbalancer is left untouched")
+			con.recorder.Eventf(
+				cached,
+				v1.EventTypeWarning,
+				"ReconcilePaused",
+				"Reconcile paused, load balancer is not deleted",
+			)
+			con.local.Remove(k)
+			return nil
+		}
 		return retry(nil, con.delete, cached)
 	case err != nil:
 		return fmt.Errorf("failed to load service from local context: %s", err.Error())
@@ -479,11 +505,28 @@ func (con *Controller) ServiceSyncTask(k string) error {
 			klog.Errorf("unexpected nil service for update, wait retry. %s", k)
 			return fmt.Errorf("retry unexpected nil service %s. ", k)
 		}
+		if isReconcilePaused(service) {
+			return con.observe(service)
+		}
+		if err := con.removeObservedState(service); err != nil {
+			return err
+		}
 		return con.update(cached, service)
 	}
 }
 
-func isProcessNeeded(svc *v1.Service) bool { return svc.Annotations[CCM_CLASS] == "" }
+// isProcessNeeded unclassed services and services of the class owned
+// by this controller are processed. Others belong to other implementations.
+func (con *Controller) isProcessNeeded(svc *v1.Service) bool {
+	return IsProcessNeeded(svc, con.class)
+}
+
+// IsProcessNeeded whether the service is processed by the controller which
+// owns the loadbalancer class.
+func IsProcessNeeded(svc *v1.Service, class string) bool {
+	owner := svc.Annotations[CCM_CLASS]
+	return owner == "" || (class != "" && owner == class)
+}
 
 func retry(
 	backoff *wait.Backoff,
@@ -525,6 +568,7 @@ func (con *Controller) update(cached, svc *v1.Service) error {
 	}
 	ctx := context.Background()
 	var newm *v1.LoadBalancerStatus
+	var conditions *utils.SyncConditions
 	if !NeedLoadBalancer(svc) {
 		_, exits, err := con.cloud.GetLoadBalancer(ctx, "", svc)
 		if err != nil {
@@ -545,6 +589,12 @@ func (con *Controller) update(cached, svc *v1.Service) error {
 		if err := con.removeServiceHash(svc); err != nil {
 			return err
 		}
+		if err := con.updateManagedResources(svc, nil); err != nil {
+			return err
+		}
+		if err := con.removeConditions(svc); err != nil {
+			return err
+		}
 
 		// continue for updating service status.
 		newm = &v1.LoadBalancerStatus{}
@@ -567,6 +617,10 @@ func (con *Controller) update(cached, svc *v1.Service) error {
 		}
 		ctx = context.WithValue(ctx, utils.ContextService, svc)
 		ctx = context.WithValue(ctx, utils.ContextRecorder, con.recorder)
+		resources := &utils.ManagedResources{}
+		ctx = context.WithValue(ctx, utils.ContextResources, resources)
+		conditions = &utils.SyncConditions{}
+		ctx = context.WithValue(ctx, utils.ContextConditions, conditions)
 		newm, err = con.cloud.EnsureLoadBalancer(ctx, con.clusterName, svc, nodes)
 
 		metric.SLBLatency.WithLabelValues("create").Observe(metric.MsSince(start))
@@ -580,6 +634,9 @@ func (con *Controller) update(cached, svc *v1.Service) error {
 			if err := con.addServiceHash(svc); err != nil {
 				return err
 			}
+			if err := con.updateManagedResources(svc, resources); err != nil {
+				return err
+			}
 		} else {
 			message := getLogMessage(err)
 			con.recorder.Eventf(
@@ -589,12 +646,17 @@ func (con *Controller) update(cached, svc *v1.Service) error {
 				"Error syncing load balancer: %s",
 				message,
 			)
+			con.updateConditions(svc, conditions, err, false)
 			return fmt.Errorf("ensure loadbalancer error: %s", err)
 		}
 	}
 	if err := con.updateStatus(svc, pre, newm); err != nil {
 		return fmt.Errorf("update service status: %s", err.Error())
 	}
+	if conditions != nil {
+		// conditions are dropped by UpdateStatus, which is not aware of them
+		con.updateConditions(svc, conditions, nil, !v1helper.LoadBalancerStatusEqual(pre, newm))
+	}
 	// Always update the cache upon success.
 	// NOTE: Since we update the cached service if and only if we successfully
 	// processed it, a cached service being nil implies that it hasn't yet
@@ -688,6 +750,7 @@ func (con *Controller) updateStatus(svc *v1.Service, pre, newm *v1.LoadBalancerS
 func (con *Controller) delete(svc *v1.Service) error {
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, utils.ContextService, svc)
+	ctx = context.WithValue(ctx, utils.ContextRecorder, con.recorder)
 	// do not check for the neediness of loadbalancer, delete anyway.
 	klog.Infof("DeletingLoadBalancer for service %s", key(svc))
 
@@ -713,6 +776,7 @@ func (con *Controller) delete(svc *v1.Service) error {
 		key(svc),
 	)
 	con.local.Remove(key(svc))
+	con.conditions.Delete(key(svc))
 	return nil
 }
 
@@ -1,10 +1,22 @@
 package service
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"io/ioutil"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakerest "k8s.io/client-go/rest/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"net/http"
 	"testing"
 )
 
@@ -176,3 +188,291 @@ func TestGetServiceHash(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type fakeLoadBalancer struct {
+	status *v1.LoadBalancerStatus
+	synced int
+}
+
+func (f *fakeLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return f.status, f.status != nil, nil
+}
+
+func (f *fakeLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	return ""
+}
+
+func (f *fakeLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	f.synced++
+	return f.status, nil
+}
+
+func (f *fakeLoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	f.synced++
+	return nil
+}
+
+func (f *fakeLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	f.synced++
+	return nil
+}
+
+func TestObservePausedService(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basic-service",
+			Namespace: "default",
+			Annotations: map[string]string{
+				utils.ServiceAnnotationLoadBalancerPauseReconcile: "on",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	cloud := &fakeLoadBalancer{
+		status: &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.1.1.1"}}},
+	}
+	client := fake.NewSimpleClientset(svc)
+	con := &Controller{
+		cloud:    cloud,
+		client:   client,
+		local:    &Context{},
+		recorder: record.NewFakeRecorder(10),
+	}
+	if !isReconcilePaused(svc) {
+		t.Fatal("service should be paused")
+	}
+	if err := con.observe(svc); err != nil {
+		t.Fatalf("observe paused service: %s", err.Error())
+	}
+	if cloud.synced != 0 {
+		t.Fatal("paused service should not mutate loadbalancer")
+	}
+	updated, err := client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %s", err.Error())
+	}
+	state := &ObservedState{}
+	if err := json.Unmarshal([]byte(updated.Annotations[utils.ServiceAnnotationLoadBalancerObservedState]), state); err != nil {
+		t.Fatalf("unmarshal observed state: %s", err.Error())
+	}
+	if !state.Paused || !state.Exists || len(state.Ingress) != 1 || state.Ingress[0].IP != "1.1.1.1" {
+		t.Fatalf("unexpected observed state: %+v", state)
+	}
+}
+
+func TestIsProcessNeeded(t *testing.T) {
+	newService := func(class string) *v1.Service {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "basic-service",
+				Namespace:   "default",
+				Annotations: map[string]string{},
+			},
+		}
+		if class != "" {
+			svc.Annotations[CCM_CLASS] = class
+		}
+		return svc
+	}
+	cases := []struct {
+		owned  string
+		class  string
+		expect bool
+	}{
+		{owned: "", class: "", expect: true},
+		{owned: "", class: "metallb", expect: false},
+		{owned: "alibabacloud.com/slb", class: "", expect: true},
+		{owned: "alibabacloud.com/slb", class: "alibabacloud.com/slb", expect: true},
+		{owned: "alibabacloud.com/slb", class: "alibabacloud.com/nlb", expect: false},
+	}
+	for _, c := range cases {
+		con := &Controller{class: c.owned}
+		if con.isProcessNeeded(newService(c.class)) != c.expect {
+			t.Fatalf("owned class [%s], service class [%s]: expect process needed %t", c.owned, c.class, c.expect)
+		}
+	}
+}
+
+func TestUpdateManagedResources(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basic-service",
+			Namespace: "default",
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	hash, _ := utils.GetServiceHash(svc)
+	client := fake.NewSimpleClientset(svc)
+	con := &Controller{client: client, recorder: record.NewFakeRecorder(10)}
+
+	resources := &utils.ManagedResources{}
+	lb := resources.LoadBalancer("lb-1")
+	lb.Listeners = []utils.ListenerResource{{Port: 80, Protocol: "tcp"}}
+	lb.VServerGroups = []utils.VServerGroupResource{{VGroupId: "rsp-1", Name: "k8s/30080/basic-service/default/c1", Backends: 2}}
+	if resources.LoadBalancer("lb-1") != lb {
+		t.Fatal("expect the same loadbalancer record")
+	}
+	if err := con.updateManagedResources(svc, resources); err != nil {
+		t.Fatalf("update managed resources: %s", err.Error())
+	}
+	updated, err := client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %s", err.Error())
+	}
+	recorded := &utils.ManagedResources{}
+	if err := json.Unmarshal([]byte(updated.Annotations[utils.ServiceAnnotationLoadBalancerResources]), recorded); err != nil {
+		t.Fatalf("unmarshal managed resources: %s", err.Error())
+	}
+	if len(recorded.LoadBalancers) != 1 || recorded.LoadBalancers[0].LoadBalancerId != "lb-1" ||
+		recorded.LoadBalancers[0].VServerGroups[0].Backends != 2 {
+		t.Fatalf("unexpected managed resources: %s", updated.Annotations[utils.ServiceAnnotationLoadBalancerResources])
+	}
+	if h, _ := utils.GetServiceHash(updated); h != hash {
+		t.Fatal("resources annotation should not change service hash")
+	}
+
+	if err := con.updateManagedResources(updated, nil); err != nil {
+		t.Fatalf("remove managed resources: %s", err.Error())
+	}
+	updated, _ = client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if _, ok := updated.Annotations[utils.ServiceAnnotationLoadBalancerResources]; ok {
+		t.Fatal("resources annotation should be removed")
+	}
+}
+
+func TestUpdateConditions(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basic-service",
+			Namespace: "default",
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	client := fake.NewSimpleClientset(svc)
+	var patches []map[string]map[string][]ServiceCondition
+	client.PrependReactor("patch", "services",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patch := action.(k8stesting.PatchAction)
+			if patch.GetSubresource() != "status" {
+				t.Fatalf("expect status subresource patched, got %q", patch.GetSubresource())
+			}
+			data := map[string]map[string][]ServiceCondition{}
+			if err := json.Unmarshal(patch.GetPatch(), &data); err != nil {
+				t.Fatalf("unmarshal patch: %s", err.Error())
+			}
+			patches = append(patches, data)
+			return false, nil, nil
+		})
+	recorder := record.NewFakeRecorder(10)
+	con := &Controller{client: client, recorder: recorder}
+
+	// listeners failed, backends are not reached
+	conditions := &utils.SyncConditions{}
+	conditions.Set(utils.ConditionLoadBalancerProvisioned, "ProvisionFailed", nil)
+	conditions.Set(utils.ConditionListenersSynced, "ListenersSyncFailed", fmt.Errorf("listener 80 conflict"))
+	con.updateConditions(svc, conditions, fmt.Errorf("ensure listener error"), false)
+	if len(patches) != 1 {
+		t.Fatalf("expect 1 patch, got %d", len(patches))
+	}
+	got := patches[0]["status"]["conditions"]
+	expect := map[string]v1.ConditionStatus{
+		utils.ConditionLoadBalancerProvisioned: v1.ConditionTrue,
+		utils.ConditionListenersSynced:         v1.ConditionFalse,
+		utils.ConditionBackendsSynced:          v1.ConditionUnknown,
+		utils.ConditionDNSRecordSynced:         v1.ConditionUnknown,
+	}
+	for _, cond := range got {
+		if cond.Status != expect[cond.Type] {
+			t.Fatalf("expect %s %s, got %s", cond.Type, expect[cond.Type], cond.Status)
+		}
+		if cond.Type == utils.ConditionListenersSynced &&
+			(cond.Reason != "ListenersSyncFailed" || cond.Message != "listener 80 conflict") {
+			t.Fatalf("unexpected listener condition: %+v", cond)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expect 1 warning event, got %d", len(recorder.Events))
+	}
+	<-recorder.Events
+	transition := got[0].LastTransitionTime
+
+	// unchanged conditions are not patched again
+	con.updateConditions(svc, conditions, fmt.Errorf("ensure listener error"), false)
+	if len(patches) != 1 {
+		t.Fatalf("expect unchanged conditions not patched, got %d patches", len(patches))
+	}
+
+	// all phases succeeded, dns record is not required
+	conditions = &utils.SyncConditions{}
+	for _, ctype := range utils.ConditionTypes[:3] {
+		conditions.Set(ctype, "", nil)
+	}
+	conditions.Skip(utils.ConditionDNSRecordSynced, ConditionReasonNotRequired)
+	con.updateConditions(svc, conditions, nil, false)
+	if len(patches) != 2 {
+		t.Fatalf("expect 2 patches, got %d", len(patches))
+	}
+	for _, cond := range patches[1]["status"]["conditions"] {
+		if cond.Status != v1.ConditionTrue {
+			t.Fatalf("expect %s true, got %s", cond.Type, cond.Status)
+		}
+		if cond.Type == utils.ConditionLoadBalancerProvisioned &&
+			!cond.LastTransitionTime.Equal(&transition) {
+			t.Fatal("last transition time should be kept when status unchanged")
+		}
+	}
+	if e := <-recorder.Events; e != "Normal Synced ListenersSynced is recovered" {
+		t.Fatalf("unexpected event: %s", e)
+	}
+
+	// conditions are removed from the status on the api server after restart
+	status, _ := json.Marshal(
+		map[string]map[string][]ServiceCondition{
+			"status": {
+				"conditions": {
+					{Type: utils.ConditionLoadBalancerProvisioned, Status: v1.ConditionTrue},
+					{Type: "Other", Status: v1.ConditionTrue},
+				},
+			},
+		},
+	)
+	con = &Controller{
+		client:   client,
+		recorder: recorder,
+		rest: &fakerest.RESTClient{
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+			Client: fakerest.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{runtime.ContentTypeJSON}},
+					Body:       ioutil.NopCloser(bytes.NewReader(status)),
+				}, nil
+			}),
+		},
+	}
+	if err := con.removeConditions(svc); err != nil {
+		t.Fatalf("remove conditions: %s", err.Error())
+	}
+	if len(patches) != 3 {
+		t.Fatalf("expect conditions removed, got %d patches", len(patches))
+	}
+	removed := patches[2]["status"]["conditions"]
+	if len(removed) != 1 || removed[0].Type != utils.ConditionLoadBalancerProvisioned {
+		t.Fatalf("expect only conditions of ccm removed, got %+v", removed)
+	}
+
+	// nothing to remove
+	status = []byte(`{"status":{}}`)
+	if err := con.removeConditions(svc); err != nil {
+		t.Fatalf("remove conditions: %s", err.Error())
+	}
+	if len(patches) != 3 {
+		t.Fatalf("expect no patch without conditions, got %d patches", len(patches))
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
+	"strings"
+)
+
+// ObservedState loadbalancer state observed while reconcile is paused
+type ObservedState struct {
+	Paused  bool                     `json:"paused"`
+	Exists  bool                     `json:"exists"`
+	Ingress []v1.LoadBalancerIngress `json:"ingress,omitempty"`
+	Message string                   `json:"message,omitempty"`
+}
+
+func isReconcilePaused(svc *v1.Service) bool {
+	return strings.ToLower(svc.Annotations[utils.ServiceAnnotationLoadBalancerPauseReconcile]) == "on"
+}
+
+// observe skip all cloud mutations of a paused service,
+// only the observed loadbalancer state is recorded in service annotation.
+func (con *Controller) observe(svc *v1.Service) error {
+	utils.Logf(svc, "reconcile paused, skip cloud mutations")
+	state := &ObservedState{Paused: true}
+	if NeedLoadBalancer(svc) {
+		status, exists, err := con.cloud.GetLoadBalancer(context.Background(), con.clusterName, svc)
+		if err != nil {
+			state.Message = err.Error()
+		} else {
+			state.Exists = exists
+			if status != nil {
+				state.Ingress = status.Ingress
+			}
+		}
+	}
+	if err := con.updateObservedState(svc, state); err != nil {
+		return err
+	}
+	con.local.Set(key(svc), svc)
+	return nil
+}
+
+func (con *Controller) updateObservedState(svc *v1.Service, state *ObservedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal observed state: %s", err.Error())
+	}
+	if svc.Annotations[utils.ServiceAnnotationLoadBalancerObservedState] == string(data) {
+		return nil
+	}
+	con.recorder.Eventf(
+		svc,
+		v1.EventTypeNormal,
+		"ReconcilePaused",
+		"Reconcile paused, observed load balancer state: %s",
+		string(data),
+	)
+	updated := svc.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	updated.Annotations[utils.ServiceAnnotationLoadBalancerObservedState] = string(data)
+	if _, err := servicehelper.PatchService(con.client.CoreV1(), svc, updated); err != nil {
+		return fmt.Errorf("update observed state: %s", err.Error())
+	}
+	return nil
+}
+
+// removeObservedState observed state is meaningless once reconcile is resumed.
+func (con *Controller) removeObservedState(svc *v1.Service) error {
+	if _, ok := svc.Annotations[utils.ServiceAnnotationLoadBalancerObservedState]; !ok {
+		return nil
+	}
+	updated := svc.DeepCopy()
+	delete(updated.Annotations, utils.ServiceAnnotationLoadBalancerObservedState)
+	if _, err := servicehelper.PatchService(con.client.CoreV1(), svc, updated); err != nil {
+		return fmt.Errorf("remove observed state: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
+)
+
+// updateManagedResources record the cloud resources managed for the service
+// in resources annotation. The annotation is removed when resources is empty.
+func (con *Controller) updateManagedResources(svc *v1.Service, resources *utils.ManagedResources) error {
+	updated := svc.DeepCopy()
+	if resources == nil || len(resources.LoadBalancers) == 0 {
+		if _, ok := svc.Annotations[utils.ServiceAnnotationLoadBalancerResources]; !ok {
+			return nil
+		}
+		delete(updated.Annotations, utils.ServiceAnnotationLoadBalancerResources)
+	} else {
+		data, err := json.Marshal(resources)
+		if err != nil {
+			return fmt.Errorf("marshal managed resources: %s", err.Error())
+		}
+		if svc.Annotations[utils.ServiceAnnotationLoadBalancerResources] == string(data) {
+			return nil
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		updated.Annotations[utils.ServiceAnnotationLoadBalancerResources] = string(data)
+	}
+	if _, err := servicehelper.PatchService(con.client.CoreV1(), svc, updated); err != nil {
+		return fmt.Errorf("update managed resources: %s", err.Error())
+	}
+	return nil
+}
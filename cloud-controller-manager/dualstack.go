@@ -0,0 +1,129 @@
+package alicloud
+
+import (
+	"context"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"net"
+	"strings"
+)
+
+// Service.Spec.IPFamilyPolicy is not available in the vendored api version,
+// ip-family-policy annotation is used instead.
+const (
+	SingleStack      = "SingleStack"
+	PreferDualStack  = "PreferDualStack"
+	RequireDualStack = "RequireDualStack"
+)
+
+// dualStackIPv6Label in-memory marker of the ipv6 half of a dual stack service.
+// It is never persisted to apiserver.
+const dualStackIPv6Label = "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-dual-stack-ipv6"
+
+// IPV6_NAME_SUFFIX suffix of the name of the ipv6 slb of a dual stack service,
+// the slb is found by DUALSTACKIPV6KEY tag instead of the name.
+const IPV6_NAME_SUFFIX = "-ipv6"
+
+func ipFamilyPolicy(svc *v1.Service) string {
+	policy := serviceAnnotation(svc, ServiceAnnotationLoadBalancerIPFamilyPolicy)
+	if policy == "" {
+		return SingleStack
+	}
+	return policy
+}
+
+func isRequireDualStack(svc *v1.Service) bool {
+	return strings.EqualFold(ipFamilyPolicy(svc), RequireDualStack)
+}
+
+// isDualStack dual stack service is backed by an ipv4 slb and an ipv6 slb.
+// User assigned loadbalancer and shared loadbalancer are always single stack.
+func isDualStack(svc *v1.Service) bool {
+	policy := ipFamilyPolicy(svc)
+	if !strings.EqualFold(policy, PreferDualStack) &&
+		!strings.EqualFold(policy, RequireDualStack) {
+		return false
+	}
+	return !isUserDefinedLoadBalancer(svc) &&
+		serviceAnnotation(svc, ServiceAnnotationLoadBalancerSharedGroup) == ""
+}
+
+// isDualStackIPv6 whether the service is the ipv6 half of a dual stack service
+func isDualStackIPv6(svc *v1.Service) bool {
+	return svc.Labels[dualStackIPv6Label] == "true"
+}
+
+// dualStackIPv6Service return the ipv6 half of a dual stack service.
+// Only ipv6 ingress is kept, so that the ipv6 slb is treated as a new one
+// when the service turns into dual stack.
+func dualStackIPv6Service(svc *v1.Service) *v1.Service {
+	ipv6 := svc.DeepCopy()
+	if ipv6.Labels == nil {
+		ipv6.Labels = make(map[string]string)
+	}
+	ipv6.Labels[dualStackIPv6Label] = "true"
+	var ingress []v1.LoadBalancerIngress
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ingressIPVersion(ing) == slb.IPv6 {
+			ingress = append(ingress, ing)
+		}
+	}
+	ipv6.Status.LoadBalancer.Ingress = ingress
+	return ipv6
+}
+
+// hasDualStackIngress the service was published with both ipv4 and ipv6 address
+func hasDualStackIngress(svc *v1.Service) bool {
+	v4, v6 := false, false
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ingressIPVersion(ing) == slb.IPv6 {
+			v6 = true
+		} else {
+			v4 = true
+		}
+	}
+	return v4 && v6
+}
+
+func ingressIPVersion(ing v1.LoadBalancerIngress) slb.AddressIPVersionType {
+	ip := net.ParseIP(ing.IP)
+	if ip != nil && ip.To4() == nil {
+		return slb.IPv6
+	}
+	return slb.IPv4
+}
+
+// ensureDualStackIPv6Deleted delete the ipv6 slb which is left over
+// when a dual stack service turns into single stack.
+func (c *Cloud) ensureDualStackIPv6Deleted(ctx context.Context, regional *RegionalClient, service *v1.Service) error {
+	ipv6 := dualStackIPv6Service(service)
+	for _, ing := range ipv6.Status.LoadBalancer.Ingress {
+		if err := regional.PrivateZones().EnsurePrivateZoneRecordDeleted(ctx, ipv6, ing.IP, slb.IPv6); err != nil {
+			return err
+		}
+	}
+	return regional.LoadBalancers().EnsureLoadBalanceDeleted(ctx, ipv6)
+}
+
+// dualStackFailed ipv6 slb is optional for PreferDualStack service.
+func dualStackFailed(ctx context.Context, service *v1.Service, err error) error {
+	if isRequireDualStack(service) {
+		return err
+	}
+	record, rerr := utils.GetRecorderFromContext(ctx)
+	if rerr != nil {
+		klog.Warningf("get recorder error: %s", rerr.Error())
+		utils.Logf(service, "ensure ipv6 loadbalancer of dual stack service failed: %s", err.Error())
+		return nil
+	}
+	record.Eventf(
+		service,
+		v1.EventTypeWarning,
+		"DualStackDegraded",
+		"Error ensuring ipv6 load balancer, fall back to single stack: %s",
+		err.Error(),
+	)
+	return nil
+}
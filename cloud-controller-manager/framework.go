@@ -66,6 +66,7 @@ var (
 	// do not change LOADBALANCER_NAME unless needed
 	LOADBALANCER_NAME         = "ac83f8bed812e11e9a0ad00163e0a398"
 	LOADBALANCER_ADDRESS      = "47.97.241.114"
+	LOADBALANCER_IPV6_ADDRESS = "2408:4000:1ff::1"
 	LOADBALANCER_NETWORK_TYPE = "classic"
 	LOADBALANCER_SPEC         = slb.LoadBalancerSpecType(slb.S1Small)
 
@@ -413,7 +414,7 @@ func ExpectExistAndEqual(f *FrameWork) error {
 		found := false
 		for _, v := range mlb.ListenerPortsAndProtocol.ListenerPortAndProtocol {
 
-			proto, err := Protocol(serviceAnnotation(f.SVC, ServiceAnnotationLoadBalancerProtocolPort), p)
+			proto, err := serviceProtocol(f.SVC, p)
 			if err != nil {
 				return fmt.Errorf("proto transfor error")
 			}
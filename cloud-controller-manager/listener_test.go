@@ -23,6 +23,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"strings"
 	"testing"
 )
 
@@ -198,3 +200,260 @@ func TestStopLoadBalancerListener(t *testing.T) {
 		t.Fatalf("listener stop error.")
 	}
 }
+
+func TestSharedLoadBalancerPortConflict(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-service",
+			Namespace: "default",
+			UID:       types.UID(serviceUIDNoneExist),
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerSharedGroup: "group-a",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+			},
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	local := Listeners{
+		{
+			NamedKey:        &NamedKey{CID: CLUSTER_ID, Namespace: svc.Namespace, ServiceName: svc.Name, Port: listenPort1},
+			Port:            listenPort1,
+			TransforedProto: "tcp",
+			Service:         svc,
+		},
+	}
+	owner := &NamedKey{CID: CLUSTER_ID, Namespace: "other", ServiceName: "other-service", Port: listenPort1}
+	remote := Listeners{
+		{
+			Name:            owner.Key(),
+			NamedKey:        owner,
+			Port:            listenPort1,
+			TransforedProto: "tcp",
+			LoadBalancerID:  LOADBALANCER_ID,
+			Service:         svc,
+		},
+	}
+	_, err := BuildActionsForListeners(context.Background(), svc, local, remote)
+	if err == nil {
+		t.Fatalf("expected port conflict on shared loadbalancer")
+	}
+	if !strings.Contains(err.Error(), "other/other-service") {
+		t.Fatalf("conflict error should report the owner service, got: %s", err.Error())
+	}
+
+	// port owned by my service is updated as usual
+	remote[0].NamedKey = &NamedKey{CID: CLUSTER_ID, Namespace: svc.Namespace, ServiceName: svc.Name, Port: listenPort1}
+	updates, err := BuildActionsForListeners(context.Background(), svc, local, remote)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(updates) != 1 || updates[0].Action != ACTION_UPDATE {
+		t.Fatalf("expected one update action, got %d", len(updates))
+	}
+}
+
+func TestLocalServiceHealthCheckNodePort(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	f := NewDefaultFrameWork(nil)
+	f.WithService(
+		// initial service based on your definition
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: 31000},
+				},
+				Type:                  v1.ServiceTypeLoadBalancer,
+				SessionAffinity:       v1.ServiceAffinityNone,
+				ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+				HealthCheckNodePort:   32456,
+			},
+		},
+	).WithNodes(
+		// initial node based on your definition.
+		// backend of the created loadbalancer
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	f.RunDefault(t, "With Local TCP Listener")
+	ctx := context.Background()
+	_, lb, _ := f.LoadBalancer().FindLoadBalancer(ctx, f.SVC)
+	res, err := f.SLBSDK().DescribeLoadBalancerTCPListenerAttribute(ctx, lb.LoadBalancerId, int(listenPort1))
+	if err != nil {
+		t.Fatalf("DescribeLoadBalancerTCPListenerAttribute error: %s", err.Error())
+	}
+	if res.HealthCheckType != slb.HTTPHealthCheckType ||
+		res.HealthCheckURI != KUBE_PROXY_HEALTHZ_URI ||
+		res.HealthCheckConnectPort != 32456 {
+		t.Fatalf("expect health check on healthCheckNodePort, got type=%s, uri=%s, port=%d",
+			res.HealthCheckType, res.HealthCheckURI, res.HealthCheckConnectPort)
+	}
+
+	f.SVC.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	f.SVC.Spec.HealthCheckNodePort = 0
+	f.RunDefault(t, "Change to Cluster TCP Listener")
+	res, err = f.SLBSDK().DescribeLoadBalancerTCPListenerAttribute(ctx, lb.LoadBalancerId, int(listenPort1))
+	if err != nil {
+		t.Fatalf("DescribeLoadBalancerTCPListenerAttribute error: %s", err.Error())
+	}
+	if res.HealthCheckType != slb.TCPHealthCheckType || res.HealthCheckConnectPort != 31000 {
+		t.Fatalf("expect tcp health check on node port, got type=%s, port=%d",
+			res.HealthCheckType, res.HealthCheckConnectPort)
+	}
+
+	f.SVC.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	f.SVC.Spec.HealthCheckNodePort = 32456
+	f.RunDefault(t, "Change back to Local TCP Listener")
+
+	// annotated health check is restored
+	f.SVC.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	f.SVC.Spec.HealthCheckNodePort = 0
+	f.SVC.Annotations = map[string]string{
+		ServiceAnnotationLoadBalancerHealthCheckType: string(slb.HTTPHealthCheckType),
+		ServiceAnnotationLoadBalancerHealthCheckURI:  "/ready",
+	}
+	f.RunDefault(t, "Change to Cluster TCP Listener with annotated health check")
+	res, err = f.SLBSDK().DescribeLoadBalancerTCPListenerAttribute(ctx, lb.LoadBalancerId, int(listenPort1))
+	if err != nil {
+		t.Fatalf("DescribeLoadBalancerTCPListenerAttribute error: %s", err.Error())
+	}
+	if res.HealthCheckType != slb.HTTPHealthCheckType ||
+		res.HealthCheckURI != "/ready" ||
+		res.HealthCheckConnectPort != 31000 {
+		t.Fatalf("expect annotated health check restored, got type=%s, uri=%s, port=%d",
+			res.HealthCheckType, res.HealthCheckURI, res.HealthCheckConnectPort)
+	}
+}
+
+func TestProtocolFromPortNameAndAppProtocol(t *testing.T) {
+	appProto := func(p string) *string { return &p }
+	cases := []struct {
+		annotation string
+		port       v1.ServicePort
+		expect     string
+	}{
+		{annotation: "", port: v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP}, expect: "tcp"},
+		{annotation: "https:443,http:80", port: v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP}, expect: "http"},
+		{annotation: "https:web", port: v1.ServicePort{Name: "web", Port: 8080, Protocol: v1.ProtocolTCP}, expect: "https"},
+		{annotation: "https:web", port: v1.ServicePort{Name: "metrics", Port: 9090, Protocol: v1.ProtocolTCP}, expect: "tcp"},
+		{annotation: "", port: v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP, AppProtocol: appProto("HTTP")}, expect: "http"},
+		{annotation: "", port: v1.ServicePort{Port: 443, Protocol: v1.ProtocolTCP, AppProtocol: appProto("https")}, expect: "https"},
+		{annotation: "", port: v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP, AppProtocol: appProto("kubernetes.io/h2c")}, expect: "tcp"},
+		{annotation: "", port: v1.ServicePort{Port: 53, Protocol: v1.ProtocolUDP, AppProtocol: appProto("http")}, expect: "udp"},
+		{annotation: "tcp:web", port: v1.ServicePort{Name: "web", Port: 80, Protocol: v1.ProtocolTCP, AppProtocol: appProto("http")}, expect: "tcp"},
+	}
+	for _, c := range cases {
+		proto, err := Protocol(c.annotation, c.port)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if proto != c.expect {
+			t.Fatalf("annotation [%s], port %+v: expect %s, got %s", c.annotation, c.port, c.expect, proto)
+		}
+	}
+	// appProtocol requires annotation app-protocol on, https requires cert-id
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	port := v1.ServicePort{Port: 443, Protocol: v1.ProtocolTCP, AppProtocol: appProto("https")}
+	gated := []struct {
+		annotations map[string]string
+		expect      string
+	}{
+		{annotations: map[string]string{}, expect: "tcp"},
+		{annotations: map[string]string{ServiceAnnotationLoadBalancerAppProtocol: "on"}, expect: "tcp"},
+		{
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerAppProtocol: "on",
+				ServiceAnnotationLoadBalancerCertID:      "cert-1",
+			},
+			expect: "https",
+		},
+	}
+	for _, g := range gated {
+		svc.Annotations = g.annotations
+		proto, err := serviceProtocol(svc, port)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if proto != g.expect {
+			t.Fatalf("annotations %v: expect %s, got %s", g.annotations, g.expect, proto)
+		}
+	}
+}
+
+func TestSessionPersistenceSetInConsoleKept(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	f := NewDefaultFrameWork(nil)
+	f.WithService(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: 31000},
+				},
+				Type:            v1.ServiceTypeLoadBalancer,
+				SessionAffinity: v1.ServiceAffinityClientIP,
+			},
+		},
+	).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+	f.RunDefault(t, "With ClientIP TCP Listener")
+	ctx := context.Background()
+	_, lb, _ := f.LoadBalancer().FindLoadBalancer(ctx, f.SVC)
+	persistence := func() int {
+		res, err := f.SLBSDK().DescribeLoadBalancerTCPListenerAttribute(ctx, lb.LoadBalancerId, int(listenPort1))
+		if err != nil {
+			t.Fatalf("DescribeLoadBalancerTCPListenerAttribute error: %s", err.Error())
+		}
+		return *res.PersistenceTimeout
+	}
+	// default affinity timeout 10800s is capped
+	if persistence() != MAX_PERSISTENCE_TIMEOUT {
+		t.Fatalf("expect persistence derived from ClientIP, got %d", persistence())
+	}
+
+	// affinity removed, persistence derived before is cleared
+	f.SVC.Spec.SessionAffinity = v1.ServiceAffinityNone
+	f.SVC.Annotations = map[string]string{
+		utils.ServiceAnnotationLoadBalancerResources: `{"loadBalancers":[{"loadBalancerId":"` +
+			lb.LoadBalancerId + `","sessionPersistence":true}]}`,
+	}
+	f.RunDefault(t, "Remove ClientIP affinity")
+	if persistence() != 0 {
+		t.Fatalf("expect persistence derived from ClientIP cleared, got %d", persistence())
+	}
+
+	// persistence set in console without annotation is not updated
+	res, _ := f.SLBSDK().DescribeLoadBalancerTCPListenerAttribute(ctx, lb.LoadBalancerId, int(listenPort1))
+	console := 100
+	res.PersistenceTimeout = &console
+	f.SVC.Annotations = map[string]string{
+		utils.ServiceAnnotationLoadBalancerResources: `{"loadBalancers":[{"loadBalancerId":"` + lb.LoadBalancerId + `"}]}`,
+	}
+	f.RunDefault(t, "Persistence set in console")
+	if persistence() != console {
+		t.Fatalf("expect persistence set in console kept, got %d", persistence())
+	}
+}
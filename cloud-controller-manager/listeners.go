@@ -32,6 +32,9 @@ import (
 // DEFAULT_LISTENER_BANDWIDTH default listener bandwidth
 var DEFAULT_LISTENER_BANDWIDTH = -1
 
+// KUBE_PROXY_HEALTHZ_URI health check path served by kube-proxy on healthCheckNodePort
+const KUBE_PROXY_HEALTHZ_URI = "/healthz"
+
 /*
 	Author: @aoxn
 	Date:   2018-11-20
@@ -58,11 +61,13 @@ var DEFAULT_LISTENER_BANDWIDTH = -1
 */
 
 // Protocol for protocol transform
+// protocol-port annotation takes precedence, port is referenced by number or name.
+// ServicePort.AppProtocol is used when the port is not in the annotation.
 func Protocol(annotation string, port v1.ServicePort) (string, error) {
 
 	if annotation == "" {
 		klog.Infof("transfor protocol, empty annotation %d/%s", port.Port, port.Protocol)
-		return strings.ToLower(string(port.Protocol)), nil
+		return appProtocol(port), nil
 	}
 	for _, v := range strings.Split(annotation, ",") {
 		pp := strings.Split(v, ":")
@@ -79,12 +84,61 @@ func Protocol(annotation string, port v1.ServicePort) (string, error) {
 				" format must be either [http|https|tcp|udp], protocol not supported wit [%s]\n", pp[0])
 		}
 
-		if pp[1] == fmt.Sprintf("%d", port.Port) {
+		if pp[1] == fmt.Sprintf("%d", port.Port) ||
+			(port.Name != "" && pp[1] == port.Name) {
 			klog.Infof("transfor protocol from %s to %s", string(port.Protocol), pp[0])
 			return pp[0], nil
 		}
 	}
-	return strings.ToLower(string(port.Protocol)), nil
+	return appProtocol(port), nil
+}
+
+// serviceProtocol listener protocol of the service port. ServicePort.AppProtocol
+// is used only if annotation app-protocol is on, otherwise listeners of existing
+// services would be recreated as http or https. https derived from AppProtocol
+// falls back to tcp without cert-id, since https listener requires a certificate.
+func serviceProtocol(service *v1.Service, port v1.ServicePort) (string, error) {
+	annotation := serviceAnnotation(service, ServiceAnnotationLoadBalancerProtocolPort)
+	plain := port
+	plain.AppProtocol = nil
+	proto, err := Protocol(annotation, plain)
+	if err != nil || port.AppProtocol == nil ||
+		serviceAnnotation(service, ServiceAnnotationLoadBalancerAppProtocol) != string(slb.OnFlag) {
+		return proto, err
+	}
+	app, err := Protocol(annotation, port)
+	if err != nil {
+		return "", err
+	}
+	if app == "https" && proto != "https" &&
+		serviceAnnotation(service, ServiceAnnotationLoadBalancerCertID) == "" {
+		klog.Warningf("service %s/%s: appProtocol https of port %d requires annotation %s, "+
+			"fall back to %s", service.Namespace, service.Name, port.Port, ServiceAnnotationLoadBalancerCertID, proto)
+		return proto, nil
+	}
+	return app, nil
+}
+
+// appProtocol listener protocol derived from ServicePort.AppProtocol.
+// h2c is passed through by tcp listener, since http listener
+// talks HTTP/1.1 to the backend.
+func appProtocol(port v1.ServicePort) string {
+	proto := strings.ToLower(string(port.Protocol))
+	if port.AppProtocol == nil || port.Protocol != v1.ProtocolTCP {
+		return proto
+	}
+	switch strings.ToLower(*port.AppProtocol) {
+	case "http":
+		proto = "http"
+	case "https":
+		proto = "https"
+	case "kubernetes.io/h2c":
+		proto = "tcp"
+	default:
+		return proto
+	}
+	klog.Infof("transfor protocol from %s to %s by appProtocol %s", string(port.Protocol), proto, *port.AppProtocol)
+	return proto
 }
 
 // IListener listener interface
@@ -431,6 +485,10 @@ func BuildActionsForListeners(ctx context.Context, svc *v1.Service, service, con
 		for _, local := range service {
 			if remote.Port == local.Port {
 				found = true
+				// listener port of shared loadbalancer is owned by one service only.
+				if err := checkSharedListenerConflict(svc, remote); err != nil {
+					return nil, err
+				}
 				// port matched. that is where the conflict case begin.
 				// 1. check protocol match.
 				if isProtocolMatch(local, remote) {
@@ -518,7 +576,7 @@ func BuildListenersFromService(
 	listeners := Listeners{}
 
 	for _, port := range svc.Spec.Ports {
-		proto, err := Protocol(serviceAnnotation(svc, ServiceAnnotationLoadBalancerProtocolPort), port)
+		proto, err := serviceProtocol(svc, port)
 		if err != nil {
 			return nil, err
 		}
@@ -584,7 +642,8 @@ func BuildListenersFromAPI(
 type tcp struct{ *Listener }
 
 func (t *tcp) Add(ctx context.Context) error {
-	def, _ := ExtractAnnotationRequest(t.Service)
+	def, request := ExtractAnnotationRequest(t.Service)
+	setLocalHealthCheck(t.Service, "tcp", def, request)
 	return t.Client.CreateLoadBalancerTCPListener(
 		ctx,
 		&slb.CreateLoadBalancerTCPListenerArgs{
@@ -616,6 +675,7 @@ func (t *tcp) Add(ctx context.Context) error {
 
 func (t *tcp) Update(ctx context.Context) error {
 	def, request := ExtractAnnotationRequest(t.Service)
+	local := setLocalHealthCheck(t.Service, "tcp", def, request)
 
 	response, err := t.Client.DescribeLoadBalancerTCPListenerAttribute(ctx, t.LoadBalancerID, int(t.Port))
 	if err != nil {
@@ -682,6 +742,10 @@ func (t *tcp) Update(ctx context.Context) error {
 		config.Scheduler = slb.SchedulerType(def.Scheduler)
 	}
 
+	if restoreHealthCheck(local, def, t.NodePort, nil, &config.HealthCheckType,
+		&config.HealthCheckURI, &config.HealthCheckConnectPort) {
+		needUpdate = true
+	}
 	// todo: perform healthcheck update.
 	if request.HealthCheckType != "" &&
 		def.HealthCheckType != response.HealthCheckType {
@@ -985,6 +1049,7 @@ func (t *http) Describe(ctx context.Context) error {
 
 func (t *http) Add(ctx context.Context) error {
 	def, request := ExtractAnnotationRequest(t.Service)
+	setLocalHealthCheck(t.Service, "http", def, request)
 	httpc := &slb.CreateLoadBalancerHTTPListenerArgs{
 		LoadBalancerId:    t.LoadBalancerID,
 		ListenerPort:      int(t.Port),
@@ -1024,6 +1089,80 @@ func (t *http) Add(ctx context.Context) error {
 	return t.Client.CreateLoadBalancerHTTPListener(ctx, httpc)
 }
 
+// setLocalHealthCheck kube-proxy serves /healthz on spec.healthCheckNodePort for
+// Local services, which fails on nodes without local endpoints. Probe it by default,
+// so that slb fails over before the backends are reconciled.
+// Health check annotations take precedence. Return true if the probe is set.
+func setLocalHealthCheck(svc *v1.Service, proto string, def, request *AnnotationRequest) bool {
+	if svc.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal ||
+		svc.Spec.HealthCheckNodePort == 0 ||
+		IsENIBackendType(svc) {
+		return false
+	}
+	if request.HealthCheckType != "" ||
+		request.HealthCheckURI != "" ||
+		request.HealthCheckConnectPort != 0 {
+		return false
+	}
+	switch proto {
+	case "tcp":
+		request.HealthCheckType = slb.HTTPHealthCheckType
+		def.HealthCheckType = request.HealthCheckType
+	case "http", "https":
+		if request.HealthCheck != "" {
+			return false
+		}
+		request.HealthCheck = slb.OnFlag
+		def.HealthCheck = request.HealthCheck
+	default:
+		return false
+	}
+	request.HealthCheckURI = KUBE_PROXY_HEALTHZ_URI
+	def.HealthCheckURI = request.HealthCheckURI
+	request.HealthCheckConnectPort = int(svc.Spec.HealthCheckNodePort)
+	def.HealthCheckConnectPort = request.HealthCheckConnectPort
+	return true
+}
+
+// restoreHealthCheck kube-proxy stops serving healthCheckNodePort once the service
+// is no longer Local. Health check of the listener which still probes it is restored
+// to the annotated settings, or the defaults of the listener, flag is nil for tcp
+// listener and hcType is nil for http and https listeners.
+// Return true if any of the settings is changed.
+func restoreHealthCheck(
+	local bool,
+	def *AnnotationRequest,
+	backendPort int32,
+	flag *slb.FlagType,
+	hcType *slb.HealthCheckType,
+	uri *string,
+	port *int,
+) bool {
+	if local || *uri != KUBE_PROXY_HEALTHZ_URI || *port == 0 ||
+		(flag != nil && *flag != slb.OnFlag) ||
+		(hcType != nil && *hcType != slb.HTTPHealthCheckType) {
+		return false
+	}
+	restoredURI, restoredPort := def.HealthCheckURI, def.HealthCheckConnectPort
+	if restoredURI == "" {
+		restoredURI = "/"
+	}
+	if restoredPort == 0 {
+		restoredPort = int(backendPort)
+	}
+	changed := *uri != restoredURI || *port != restoredPort
+	*uri, *port = restoredURI, restoredPort
+	if flag != nil && *flag != def.HealthCheck {
+		changed = true
+		*flag = def.HealthCheck
+	}
+	if hcType != nil && *hcType != def.HealthCheckType {
+		changed = true
+		*hcType = def.HealthCheckType
+	}
+	return changed
+}
+
 func forwardPort(port string, target int32) int32 {
 	if port == "" {
 		return 0
@@ -1056,6 +1195,7 @@ func forwardPort(port string, target int32) int32 {
 func (t *http) Update(ctx context.Context) error {
 
 	def, request := ExtractAnnotationRequest(t.Service)
+	local := setLocalHealthCheck(t.Service, "http", def, request)
 	response, err := t.Client.DescribeLoadBalancerHTTPListenerAttribute(ctx, t.LoadBalancerID, int(t.Port))
 	if err != nil {
 		return err
@@ -1121,6 +1261,10 @@ func (t *http) Update(ctx context.Context) error {
 		needUpdate = true
 		config.Scheduler = slb.SchedulerType(def.Scheduler)
 	}
+	if restoreHealthCheck(local, def, t.NodePort, &config.HealthCheck, nil,
+		&config.HealthCheckURI, &config.HealthCheckConnectPort) {
+		needUpdate = true
+	}
 	// todo: perform healthcheck update.
 	if request.HealthCheck != "" &&
 		def.HealthCheck != response.HealthCheck {
@@ -1275,6 +1419,7 @@ func (t *https) Describe(ctx context.Context) error {
 func (t *https) Add(ctx context.Context) error {
 
 	def, request := ExtractAnnotationRequest(t.Service)
+	setLocalHealthCheck(t.Service, "https", def, request)
 	return t.Client.CreateLoadBalancerHTTPSListener(
 		ctx,
 		&slb.CreateLoadBalancerHTTPSListenerArgs{
@@ -1312,6 +1457,7 @@ func (t *https) Add(ctx context.Context) error {
 
 func (t *https) Update(ctx context.Context) error {
 	def, request := ExtractAnnotationRequest(t.Service)
+	local := setLocalHealthCheck(t.Service, "https", def, request)
 	response, err := t.Client.DescribeLoadBalancerHTTPSListenerAttribute(ctx, t.LoadBalancerID, int(t.Port))
 	if err != nil {
 		return err
@@ -1381,6 +1527,10 @@ func (t *https) Update(ctx context.Context) error {
 		needUpdate = true
 		config.Scheduler = slb.SchedulerType(def.Scheduler)
 	}
+	if restoreHealthCheck(local, def, t.NodePort, &config.HealthCheck, nil,
+		&config.HealthCheckURI, &config.HealthCheckConnectPort) {
+		needUpdate = true
+	}
 	if request.HealthCheck != "" &&
 		def.HealthCheck != response.HealthCheck {
 		needUpdate = true
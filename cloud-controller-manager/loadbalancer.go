@@ -49,9 +49,9 @@ type AnnotationRequest struct {
 	SLBNetworkType string
 
 	ChargeType slb.InternetChargeType
-	//Region     		common.Region
-	Bandwidth int
-	CertID    string
+	Region     common.Region
+	Bandwidth  int
+	CertID     string
 
 	MasterZoneID string
 	SlaveZoneID  string
@@ -78,13 +78,21 @@ type AnnotationRequest struct {
 	CookieTimeout      int
 	PersistenceTimeout *int
 	AddressIPVersion   slb.AddressIPVersionType
+	IPFamilyPolicy     string
 
 	OverrideListeners string
 
-	PrivateZoneName       string
-	PrivateZoneId         string
-	PrivateZoneRecordName string
-	PrivateZoneRecordTTL  int
+	PrivateZoneName         string
+	PrivateZoneId           string
+	PrivateZoneRecordName   string
+	PrivateZoneRecordTTL    int
+	PrivateZoneRecordCname  string
+	PrivateZoneRecordWeight int
+
+	PublicDNSDomain string
+	PublicDNSRR     string
+	PublicDNSTTL    int
+	PublicDNSLine   string
 
 	RemoveUnscheduledBackend string
 	ResourceGroupId          string
@@ -92,6 +100,8 @@ type AnnotationRequest struct {
 	DeleteProtection             slb.FlagType
 	ModificationProtectionStatus slb.ModificationProtectionType
 	ExternalIPType               string
+
+	SharedGroup string
 }
 
 // TAGKEY Default tag key.
@@ -99,6 +109,11 @@ const TAGKEY = "kubernetes.do.not.delete"
 const REUSEKEY = "kubernetes.reused.by.user"
 const ACKKEY = "ack.aliyun.com"
 const MDSKEY = "managed.by.ack"
+const SHAREDKEY = "kubernetes.shared.group"
+const NAMESPACEKEY = "kubernetes.namespace"
+const RELEASEDKEY = "kubernetes.released.by"
+const SHAREDOWNERKEY = "kubernetes.shared.owner"
+const DUALSTACKIPV6KEY = "kubernetes.dual.stack.ipv6"
 
 // ClientSLBSDK client sdk for slb
 type ClientSLBSDK interface {
@@ -134,6 +149,8 @@ type ClientSLBSDK interface {
 	RemoveTags(ctx context.Context, args *slb.RemoveTagsArgs) error
 	DescribeTags(ctx context.Context, args *slb.DescribeTagsArgs) (tags []slb.TagItemType, pagination *common.PaginationResult, err error)
 	AddTags(ctx context.Context, args *slb.AddTagsArgs) error
+	TagResourcesSDK
+	DescribeAvailableResource(ctx context.Context, args *DescribeAvailableResourceArgs) (resources []AvailableResourceType, err error)
 
 	CreateVServerGroup(ctx context.Context, args *slb.CreateVServerGroupArgs) (response *slb.CreateVServerGroupResponse, err error)
 	DescribeVServerGroups(ctx context.Context, args *slb.DescribeVServerGroupsArgs) (response *slb.DescribeVServerGroupsResponse, err error)
@@ -152,6 +169,20 @@ type LoadBalancerClient struct {
 	c      ClientSLBSDK
 	// known service resource version
 	ins ClientInstanceSDK
+	// candidate vswitches of intranet slb
+	vswitch *VSwitchSelector
+	// vpc client to tag eips of slb
+	eip EipSDK
+	// usage of namespace across regions, default to the region of the client
+	usage func(ctx context.Context, namespace string) (namespaceUsage, error)
+}
+
+// Region return the region of slb client, default to the cluster region.
+func (s *LoadBalancerClient) Region() common.Region {
+	if s.region == "" {
+		return DEFAULT_REGION
+	}
+	return common.Region(s.region)
 }
 
 func (s *LoadBalancerClient) FindLoadBalancer(ctx context.Context, service *v1.Service) (bool, *slb.LoadBalancerType, error) {
@@ -161,6 +192,10 @@ func (s *LoadBalancerClient) FindLoadBalancer(ctx context.Context, service *v1.S
 	if def.Loadbalancerid != "" {
 		return s.FindLoadBalancerByID(ctx, def.Loadbalancerid)
 	}
+	// shared loadbalancer is found by group tag
+	if def.SharedGroup != "" {
+		return s.FindLoadBalancerBySharedGroup(ctx, def.SharedGroup)
+	}
 	// if not, find by slb tags
 	return s.FindLoadBalancerByTags(ctx, service)
 }
@@ -179,14 +214,17 @@ func (s *LoadBalancerClient) FindLoadBalancerByTags(ctx context.Context, service
 		return false, nil, fmt.Errorf("unexpected empty service uid")
 	}
 	lbn := GetLoadBalancerName(service)
-	items, err := json.Marshal(
-		[]slb.TagItem{
-			{
-				TagKey:   TAGKEY,
-				TagValue: lbn,
-			},
+	filter := []slb.TagItem{
+		{
+			TagKey:   TAGKEY,
+			TagValue: lbn,
 		},
-	)
+	}
+	// ipv6 slb of dual stack service shares the tag of the ipv4 one
+	if isDualStackIPv6(service) {
+		filter = append(filter, slb.TagItem{TagKey: DUALSTACKIPV6KEY, TagValue: "true"})
+	}
+	items, err := json.Marshal(filter)
 	if err != nil {
 		return false, nil, err
 	}
@@ -194,13 +232,20 @@ func (s *LoadBalancerClient) FindLoadBalancerByTags(ctx context.Context, service
 		ctx,
 		&slb.DescribeLoadBalancersArgs{
 			Tags:     string(items),
-			RegionId: DEFAULT_REGION,
+			RegionId: s.Region(),
 		},
 	)
 	utils.Logf(service, "alicloud: fallback to find loadbalancer by tags [%s]", string(items))
 	if err != nil {
 		return false, nil, err
 	}
+	if isDualStackIPv6(service) {
+		if len(lbs) == 0 {
+			return false, nil, nil
+		}
+	} else if lbs, err = s.skipDualStackIPv6(ctx, lbs); err != nil {
+		return false, nil, err
+	}
 
 	if len(lbs) == 0 {
 		// here we need to fallback on finding by name for compatible reason
@@ -215,11 +260,45 @@ func (s *LoadBalancerClient) FindLoadBalancerByTags(ctx context.Context, service
 	return err == nil, lb, err
 }
 
+// skipDualStackIPv6 drop the ipv6 slb of dual stack services, which is
+// only found by the ipv6 half of the service.
+func (s *LoadBalancerClient) skipDualStackIPv6(ctx context.Context, lbs []slb.LoadBalancerType) ([]slb.LoadBalancerType, error) {
+	var result []slb.LoadBalancerType
+	for _, lb := range lbs {
+		if lb.AddressIPVersion == slb.IPv6 {
+			tags, _, err := s.c.DescribeTags(
+				ctx,
+				&slb.DescribeTagsArgs{
+					RegionId:       lb.RegionId,
+					LoadBalancerID: lb.LoadBalancerId,
+				})
+			if err != nil {
+				return nil, err
+			}
+			if hasTagKey(tags, DUALSTACKIPV6KEY) {
+				continue
+			}
+		}
+		result = append(result, lb)
+	}
+	return result, nil
+}
+
+// hasTagKey whether the tag key exists
+func hasTagKey(tags []slb.TagItemType, key string) bool {
+	for _, tag := range tags {
+		if tag.TagKey == key {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *LoadBalancerClient) FindLoadBalancerByName(ctx context.Context, name string) (bool, *slb.LoadBalancerType, error) {
 	lbs, err := s.c.DescribeLoadBalancers(
 		ctx,
 		&slb.DescribeLoadBalancersArgs{
-			RegionId:         DEFAULT_REGION,
+			RegionId:         s.Region(),
 			LoadBalancerName: name,
 		},
 	)
@@ -227,6 +306,10 @@ func (s *LoadBalancerClient) FindLoadBalancerByName(ctx context.Context, name st
 	if err != nil {
 		return false, nil, err
 	}
+	lbs, err = s.skipDualStackIPv6(ctx, lbs)
+	if err != nil {
+		return false, nil, err
+	}
 
 	if len(lbs) == 0 {
 		return false, nil, nil
@@ -282,10 +365,67 @@ func equalsAddressIPVersion(request, origined slb.AddressIPVersionType) bool {
 // EnsureLoadBalancer make sure slb is reconciled nodes []*v1.Node
 func (s *LoadBalancerClient) EnsureLoadBalancer(ctx context.Context, service *v1.Service, nodes *EndpointWithENI, vswitchid string) (*slb.LoadBalancerType, error) {
 	utils.Logf(service, "ensure loadbalancer with service details, \n%+v", PrettyJson(service))
+	if isSharedLoadBalancer(service) {
+		defer lockSharedGroup(serviceAnnotation(service, ServiceAnnotationLoadBalancerSharedGroup))()
+	}
+
+	origined, serviceHashChanged, err := s.ensureLoadBalancerInstance(ctx, service, nodes, vswitchid)
+	if err := utils.RecordCondition(ctx, utils.ConditionLoadBalancerProvisioned,
+		"ProvisionFailed", err); err != nil {
+		return origined, err
+	}
+	vgs := BuildVirtualGroupFromService(s, service, origined)
 
+	// Make sure virtual server backend group has been updated.
+	if err := EnsureVirtualGroups(ctx, vgs, nodes); err != nil {
+		err = fmt.Errorf("update backend servers: error %s", err.Error())
+		return origined, utils.RecordCondition(ctx, utils.ConditionBackendsSynced, "BackendsSyncFailed", err)
+	}
+	if serviceHashChanged {
+		// tags of related resources are best effort
+		if err := s.ensureRelatedResourceTags(ctx, service, origined, vgs); err != nil {
+			record, rerr := utils.GetRecorderFromContext(ctx)
+			if rerr != nil {
+				klog.Warningf("get recorder error: %s", rerr.Error())
+				utils.Logf(service, "ensure tags of related resources error: %s", err.Error())
+			} else {
+				record.Eventf(service, v1.EventTypeWarning, "TagResourcesFailed",
+					"Error tagging resources of load balancer %s: %s", origined.LoadBalancerId, err.Error())
+			}
+		}
+	}
+	// Apply listener when
+	//   1. user does not assign loadbalancer id by themselves.
+	//   2. force-override-listener annotation is set.
+	if serviceHashChanged {
+		if (!isUserDefinedLoadBalancer(service)) ||
+			(isUserDefinedLoadBalancer(service) && isOverrideListeners(service)) {
+			utils.Logf(service, "not user defined loadbalancer[%s], start to apply listener.", origined.LoadBalancerId)
+			// If listener update is needed. Switch to vserver group immediately.
+			// No longer update default backend servers.
+			if err := EnsureListeners(ctx, s, service, origined, vgs); err != nil {
+				err = fmt.Errorf("ensure listener error: %s", err.Error())
+				return origined, utils.RecordCondition(ctx, utils.ConditionListenersSynced, "ListenersSyncFailed", err)
+			}
+		}
+	}
+	utils.RecordCondition(ctx, utils.ConditionListenersSynced, "", nil)
+	recordLoadBalancerResources(ctx, service, origined, vgs)
+	err = s.UpdateLoadBalancer(ctx, service, nodes, false)
+	return origined, utils.RecordCondition(ctx, utils.ConditionBackendsSynced, "BackendsSyncFailed", err)
+}
+
+// ensureLoadBalancerInstance find or create the slb of service, and update
+// its attributes when service hash changed.
+func (s *LoadBalancerClient) ensureLoadBalancerInstance(
+	ctx context.Context,
+	service *v1.Service,
+	nodes *EndpointWithENI,
+	vswitchid string,
+) (*slb.LoadBalancerType, bool, error) {
 	exists, origined, err := s.FindLoadBalancer(ctx, service)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	utils.Logf(service, "find loadbalancer with result, exist=%v, %s\n", exists, PrettyJson(origined))
 	_, request := ExtractAnnotationRequest(service)
@@ -301,12 +441,12 @@ func (s *LoadBalancerClient) EnsureLoadBalancer(ctx context.Context, service *v1
 			os.Exit(1)
 		}
 		if isLoadbalancerOwnIngress(service) {
-			return nil, fmt.Errorf("alicloud: not able to find loadbalancer "+
+			return nil, false, fmt.Errorf("alicloud: not able to find loadbalancer "+
 				"named [%s] in openapi, but it's defined in service.loaderbalancer.ingress. "+
 				"this may happen when you removed loadbalancerid annotation", service.Name)
 		}
 		if request.Loadbalancerid != "" {
-			return nil, fmt.Errorf("alicloud: user specified "+
+			return nil, false, fmt.Errorf("alicloud: user specified "+
 				"loadbalancer[%s] does not exist. pls check", request.Loadbalancerid)
 		}
 
@@ -314,19 +454,28 @@ func (s *LoadBalancerClient) EnsureLoadBalancer(ctx context.Context, service *v1
 		klog.V(5).Infof("alicloud: can not find a "+
 			"loadbalancer with service name [%s/%s], creating a new one", service.Namespace, service.Name)
 		opts := s.getLoadBalancerOpts(service, vswitchid)
-		lbr, err := s.c.CreateLoadBalancer(ctx, opts)
-		if err != nil {
-			return nil, err
+		s.selectZones(ctx, service, nodes, opts)
+		if err := s.selectVSwitch(ctx, service, opts); err != nil {
+			return nil, false, err
 		}
-
 		//deal with loadBalancer tags
 		tags := getLoadBalancerAdditionalTags(getBackwardsCompatibleAnnotation(service.Annotations))
 		loadbalancerName := GetLoadBalancerName(service)
 		// Add default tags
 		tags[TAGKEY] = loadbalancerName
 		tags[ACKKEY] = CLUSTER_ID
-		if err := addSLBTag(s.c, ctx, tags, opts.RegionId, lbr.LoadBalancerId); err != nil {
-			return nil, err
+		tags[NAMESPACEKEY] = service.Namespace
+		if isSharedLoadBalancer(service) {
+			tags[TAGKEY] = getSharedGroupTagValue(request.SharedGroup)
+			tags[SHAREDKEY] = request.SharedGroup
+			tags[SHAREDOWNERKEY] = getSharedGroupMember(service)
+		}
+		if isDualStackIPv6(service) {
+			tags[DUALSTACKIPV6KEY] = "true"
+		}
+		lbr, err := s.createLoadBalancer(ctx, service, opts, tags)
+		if err != nil {
+			return nil, false, err
 		}
 
 		origined, derr = s.c.DescribeLoadBalancerAttribute(ctx, lbr.LoadBalancerId)
@@ -340,66 +489,70 @@ func (s *LoadBalancerClient) EnsureLoadBalancer(ctx context.Context, service *v1
 				LoadBalancerID: origined.LoadBalancerId,
 			})
 		if err != nil {
-			return origined, err
+			return origined, false, err
 		}
 		// add tag for reused slb
-		found := false
+		missing := map[string]string{REUSEKEY: "true"}
+		if isLoadBalancerHasTag(tags) {
+			// slb created before namespace quota is counted by NAMESPACEKEY
+			missing[NAMESPACEKEY] = service.Namespace
+		}
 		for _, tag := range tags {
-			if tag.TagKey == REUSEKEY {
-				found = true
-			}
+			delete(missing, tag.TagKey)
 		}
-		if !found {
+		if len(missing) > 0 {
 			if err := addSLBTag(s.c,
 				ctx,
-				map[string]string{REUSEKEY: "true"},
+				missing,
 				origined.RegionId,
 				origined.LoadBalancerId); err != nil {
-				return nil, err
+				return nil, false, err
 			}
 		}
 
 		if ok, reason := isLoadBalancerNonReusable(tags, service); ok {
-			return origined, fmt.Errorf("alicloud: the loadbalancer %s can not be reused, %s", origined.LoadBalancerId, reason)
+			return origined, false, fmt.Errorf("alicloud: the loadbalancer %s can not be reused, %s", origined.LoadBalancerId, reason)
+		}
+		if isUserDefinedLoadBalancer(service) {
+			if err := s.adoptReleasedLoadBalancer(ctx, service, origined, tags); err != nil {
+				return origined, false, err
+			}
 		}
 
 		serviceHashChanged, err = utils.IsServiceHashChanged(service)
 		if err != nil {
-			return origined, fmt.Errorf("compute svc hash error :%s", err.Error())
+			return origined, false, fmt.Errorf("compute svc hash error :%s", err.Error())
 		}
 		if serviceHashChanged {
-			if err := updateLoadBalancerByAnnotations(ctx, s.c, origined, service, request, tags); err != nil {
-				return origined, err
+			owned := true
+			if isSharedLoadBalancer(service) {
+				owned, err = s.ensureSharedGroupOwner(ctx, service, origined, tags)
+				if err != nil {
+					return origined, false, err
+				}
+				if !owned {
+					err = checkSharedGroupAnnotations(request, origined, getSharedGroupOwner(tags))
+					if err != nil {
+						return origined, false, err
+					}
+				}
+			}
+			if owned {
+				if err := s.updateLoadBalancer(ctx, service, origined, request, tags); err != nil {
+					return origined, false, err
+				}
+			}
+			if err := s.ensureLoadBalancerTags(ctx, service, origined, tags); err != nil {
+				return origined, false, err
 			}
 			origined, derr = s.c.DescribeLoadBalancerAttribute(ctx, origined.LoadBalancerId)
 		}
 	}
 	if derr != nil {
 		utils.Logf(service, "alicloud: can not get loadbalancer attribute. ")
-		return nil, derr
-	}
-	vgs := BuildVirtualGroupFromService(s, service, origined)
-
-	// Make sure virtual server backend group has been updated.
-	if err := EnsureVirtualGroups(ctx, vgs, nodes); err != nil {
-		return origined, fmt.Errorf("update backend servers: error %s", err.Error())
+		return nil, false, derr
 	}
-	// Apply listener when
-	//   1. user does not assign loadbalancer id by themselves.
-	//   2. force-override-listener annotation is set.
-	if serviceHashChanged {
-		if (!isUserDefinedLoadBalancer(service)) ||
-			(isUserDefinedLoadBalancer(service) && isOverrideListeners(service)) {
-			utils.Logf(service, "not user defined loadbalancer[%s], start to apply listener.", origined.LoadBalancerId)
-			// If listener update is needed. Switch to vserver group immediately.
-			// No longer update default backend servers.
-			if err := EnsureListeners(ctx, s, service, origined, vgs); err != nil {
-
-				return origined, fmt.Errorf("ensure listener error: %s", err.Error())
-			}
-		}
-	}
-	return origined, s.UpdateLoadBalancer(ctx, service, nodes, false)
+	return origined, serviceHashChanged, nil
 }
 
 func isLoadBalancerNonReusable(tags []slb.TagItemType, service *v1.Service) (bool, string) {
@@ -613,6 +766,9 @@ func (s *LoadBalancerClient) EnsureLoadBalanceDeleted(ctx context.Context, servi
 	if err != nil {
 		utils.Logf(service, "Warning: failed to save deleted service resourceVersion,due to [%s] ", err.Error())
 	}
+	if isSharedLoadBalancer(service) {
+		defer lockSharedGroup(serviceAnnotation(service, ServiceAnnotationLoadBalancerSharedGroup))()
+	}
 	exists, lb, err := s.FindLoadBalancer(ctx, service)
 	if err != nil {
 		return err
@@ -625,7 +781,22 @@ func (s *LoadBalancerClient) EnsureLoadBalanceDeleted(ctx context.Context, servi
 		utils.Logf(service, "user managed loadbalancer will not be deleted by cloudprovider.")
 		return EnsureListenersDeleted(ctx, s.c, service, lb, BuildVirtualGroupFromService(s, service, lb))
 	}
+	if isSharedLoadBalancer(service) {
+		return s.ensureSharedLoadBalancerDeleted(ctx, service, lb)
+	}
+	return s.deleteOrRetainLoadBalancer(ctx, service, lb)
+}
 
+// deleteOrRetainLoadBalancer delete the slb unless retain-on-delete is enabled.
+func (s *LoadBalancerClient) deleteOrRetainLoadBalancer(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
+	if isRetainLoadBalancer(service) {
+		return s.retainLoadBalancer(ctx, service, lb)
+	}
+	return s.deleteLoadBalancer(ctx, service, lb)
+}
+
+// deleteLoadBalancer turn off delete protection and delete the slb
+func (s *LoadBalancerClient) deleteLoadBalancer(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
 	// set delete protection off
 	if lb.DeleteProtection == slb.OnFlag {
 		if err := s.c.SetLoadBalancerDeleteProtection(
@@ -648,7 +819,7 @@ func (s *LoadBalancerClient) getLoadBalancerOpts(service *v1.Service, vswitchid
 	args = &slb.CreateLoadBalancerArgs{
 		AddressType:                  ar.AddressType,
 		InternetChargeType:           ar.ChargeType,
-		RegionId:                     DEFAULT_REGION,
+		RegionId:                     s.Region(),
 		LoadBalancerSpec:             ar.LoadBalancerSpec,
 		MasterZoneId:                 ar.MasterZoneID,
 		SlaveZoneId:                  ar.SlaveZoneID,
@@ -673,9 +844,18 @@ func (s *LoadBalancerClient) getLoadBalancerOpts(service *v1.Service, vswitchid
 	}
 	if req.LoadBalancerName == "" {
 		args.LoadBalancerName = GetLoadBalancerName(service)
+		if isSharedLoadBalancer(service) {
+			args.LoadBalancerName = getSharedLoadBalancerName(req.SharedGroup)
+		}
 	} else {
 		args.LoadBalancerName = req.LoadBalancerName
 	}
+	if isDualStackIPv6(service) {
+		if len(args.LoadBalancerName) > 80-len(IPV6_NAME_SUFFIX) {
+			args.LoadBalancerName = args.LoadBalancerName[:80-len(IPV6_NAME_SUFFIX)]
+		}
+		args.LoadBalancerName += IPV6_NAME_SUFFIX
+	}
 	return
 }
 
@@ -864,6 +1044,10 @@ func keepResourceVersion(service *v1.Service) error {
 		return fmt.Errorf("alicloud: failed to save deleted service resource version , for service is nil")
 	}
 
+	// the service is not deleted when only its ipv6 half is
+	if isDualStackIPv6(service) {
+		return nil
+	}
 	serviceUID := string(service.GetUID())
 	keeper := GetLocalService()
 	if !keeper.get(serviceUID) {
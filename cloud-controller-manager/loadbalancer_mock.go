@@ -93,6 +93,10 @@ type mockClientSLB struct {
 	removeTags                            func(args *slb.RemoveTagsArgs) error
 	describeTags                          func(args *slb.DescribeTagsArgs) (tags []slb.TagItemType, pagination *common.PaginationResult, err error)
 	addTags                               func(args *slb.AddTagsArgs) error
+	describeAvailableResource             func(args *DescribeAvailableResourceArgs) (resources []AvailableResourceType, err error)
+	tagResources                          func(args *TagResourcesArgs) error
+	untagResources                        func(args *UntagResourcesArgs) error
+	listTagResources                      func(args *ListTagResourcesArgs) (tags []TagResourceType, err error)
 
 	createVServerGroup               func(args *slb.CreateVServerGroupArgs) (response *slb.CreateVServerGroupResponse, err error)
 	describeVServerGroups            func(args *slb.DescribeVServerGroupsArgs) (response *slb.DescribeVServerGroupsResponse, err error)
@@ -109,6 +113,8 @@ type LBStore struct {
 	listeners    sync.Map
 	tags         sync.Map
 	vgroups      sync.Map
+	// string: map[string]string{}
+	resourceTags sync.Map
 }
 
 // LOADBALANCER slb cloud mock storage
@@ -145,13 +151,25 @@ func (c *mockClientSLB) DescribeLoadBalancers(ctx context.Context, args *slb.Des
 				return true
 			}
 			if args.Tags != "" {
+				var filter []slb.TagItem
+				if err := json.Unmarshal([]byte(args.Tags), &filter); err != nil {
+					return true
+				}
 				bytag := &slb.DescribeTagsArgs{
-					LoadBalancerID: args.LoadBalancerId,
-					Tags:           args.Tags,
+					LoadBalancerID: v.LoadBalancerId,
 				}
-				tag, _, _ := c.DescribeTags(ctx, bytag)
-				if len(tag) <= 0 {
-					return true
+				tags, _, _ := c.DescribeTags(ctx, bytag)
+				for _, f := range filter {
+					found := false
+					for _, tag := range tags {
+						if tag.TagKey == f.TagKey && tag.TagValue == f.TagValue {
+							found = true
+							break
+						}
+					}
+					if !found {
+						return true
+					}
 				}
 			}
 			results = append(results, v)
@@ -213,6 +231,10 @@ func (c *mockClientSLB) CreateLoadBalancer(ctx context.Context, args *slb.Create
 	if args.AddressIPVersion != "" {
 		ipver = args.AddressIPVersion
 	}
+	address := LOADBALANCER_ADDRESS
+	if ipver == slb.IPv6 {
+		address = LOADBALANCER_IPV6_ADDRESS
+	}
 	ins := slb.LoadBalancerType{
 		LoadBalancerId:               newid(),
 		LoadBalancerName:             args.LoadBalancerName,
@@ -220,7 +242,7 @@ func (c *mockClientSLB) CreateLoadBalancer(ctx context.Context, args *slb.Create
 		LoadBalancerSpec:             args.LoadBalancerSpec,
 		Bandwidth:                    args.Bandwidth,
 		InternetChargeType:           args.InternetChargeType,
-		Address:                      LOADBALANCER_ADDRESS,
+		Address:                      address,
 		AddressType:                  addrtype,
 		VSwitchId:                    args.VSwitchId,
 		VpcId:                        VPCID,
@@ -825,6 +847,7 @@ func (c *mockClientSLB) SetLoadBalancerTCPListenerAttribute(ctx context.Context,
 	lb.HealthCheckDomain = args.HealthCheckDomain
 	lb.HealthCheckConnectPort = args.HealthCheckConnectPort
 	lb.HealthCheckURI = args.HealthCheckURI
+	lb.HealthCheckType = args.HealthCheckType
 	lb.UnhealthyThreshold = args.UnhealthyThreshold
 	lb.ListenerPort = args.ListenerPort
 	lb.VServerGroup = args.VServerGroup
@@ -885,11 +908,11 @@ func (c *mockClientSLB) RemoveTags(ctx context.Context, args *slb.RemoveTagsArgs
 		return err
 	}
 
-	ins, ok := v.([]slb.TagItem)
+	ins, ok := v.([]slb.TagItemType)
 	if !ok {
 		return fmt.Errorf("not TagItem type %s", reflect.TypeOf(v))
 	}
-	var result []slb.TagItem
+	var result []slb.TagItemType
 	for _, t := range ins {
 		found := false
 		for _, m := range *tags {
@@ -922,6 +945,75 @@ func (c *mockClientSLB) DescribeTags(ctx context.Context, args *slb.DescribeTags
 
 	return ins, nil, nil
 }
+
+func (c *mockClientSLB) DescribeAvailableResource(ctx context.Context, args *DescribeAvailableResourceArgs) (resources []AvailableResourceType, err error) {
+	if c.describeAvailableResource != nil {
+		return c.describeAvailableResource(args)
+	}
+	return []AvailableResourceType{}, nil
+}
+
+func resourceTagKey(resourceType, id string) string {
+	return fmt.Sprintf("%s/%s", resourceType, id)
+}
+
+func (c *mockClientSLB) TagResources(ctx context.Context, args *TagResourcesArgs) error {
+	if c.tagResources != nil {
+		return c.tagResources(args)
+	}
+	for _, id := range args.ResourceId {
+		tags := map[string]string{}
+		if v, ok := LOADBALANCER.resourceTags.Load(resourceTagKey(args.ResourceType, id)); ok {
+			for k, val := range v.(map[string]string) {
+				tags[k] = val
+			}
+		}
+		for _, tag := range args.Tag {
+			tags[tag.Key] = tag.Value
+		}
+		LOADBALANCER.resourceTags.Store(resourceTagKey(args.ResourceType, id), tags)
+	}
+	return nil
+}
+
+func (c *mockClientSLB) UntagResources(ctx context.Context, args *UntagResourcesArgs) error {
+	if c.untagResources != nil {
+		return c.untagResources(args)
+	}
+	for _, id := range args.ResourceId {
+		v, ok := LOADBALANCER.resourceTags.Load(resourceTagKey(args.ResourceType, id))
+		if !ok {
+			continue
+		}
+		tags := map[string]string{}
+		for k, val := range v.(map[string]string) {
+			tags[k] = val
+		}
+		for _, key := range args.TagKey {
+			delete(tags, key)
+		}
+		LOADBALANCER.resourceTags.Store(resourceTagKey(args.ResourceType, id), tags)
+	}
+	return nil
+}
+
+func (c *mockClientSLB) ListTagResources(ctx context.Context, args *ListTagResourcesArgs) (tags []TagResourceType, err error) {
+	if c.listTagResources != nil {
+		return c.listTagResources(args)
+	}
+	for _, id := range args.ResourceId {
+		v, ok := LOADBALANCER.resourceTags.Load(resourceTagKey(args.ResourceType, id))
+		if !ok {
+			continue
+		}
+		for k, val := range v.(map[string]string) {
+			tags = append(tags,
+				TagResourceType{ResourceId: id, ResourceType: args.ResourceType, TagKey: k, TagValue: val})
+		}
+	}
+	return tags, nil
+}
+
 func (c *mockClientSLB) AddTags(ctx context.Context, args *slb.AddTagsArgs) error {
 	if c.addTags != nil {
 		return c.addTags(args)
@@ -18,15 +18,23 @@ package alicloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/ecs"
 	"github.com/denverdino/aliyungo/metadata"
 	"github.com/denverdino/aliyungo/slb"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -38,6 +46,62 @@ func TestNewClient(t *testing.T) {
 	//realSlbClient(keyid,keysecret)
 }
 
+func TestRegionalClient(t *testing.T) {
+	climgr, _ := NewMockClientMgr(&mockClientSLB{})
+	if climgr.Regional("").LoadBalancers() != climgr.LoadBalancers() {
+		t.Fatal("empty region should use the default loadbalancer client")
+	}
+	beijing := climgr.Regional(common.Beijing)
+	if beijing.LoadBalancers() == climgr.LoadBalancers() ||
+		beijing.LoadBalancers().Region() != common.Beijing {
+		t.Fatal("expect a loadbalancer client of region cn-beijing")
+	}
+	if beijing.PrivateZones() != climgr.Regional("").PrivateZones() {
+		t.Fatal("private zone client should be shared by all regions")
+	}
+	if climgr.Regional(common.Beijing) != beijing {
+		t.Fatal("regional client should be created only once")
+	}
+}
+
+func TestCheckRegionalLoadBalancer(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "service-test",
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerRegion: string(common.Beijing),
+			},
+		},
+	}
+	check := func() error {
+		defaulted, _ := ExtractAnnotationRequest(svc)
+		return checkRegionalLoadBalancer(svc, defaulted)
+	}
+	// neither ecs nor eni backends are reachable from other regions
+	for _, backend := range []string{utils.BACKEND_TYPE_ECS, utils.BACKEND_TYPE_ENI} {
+		svc.Annotations[utils.BACKEND_TYPE_LABEL] = backend
+		if err := check(); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("expect %s backends rejected in other region, got %v", backend, err)
+		}
+	}
+	svc.Annotations[ServiceAnnotationLoadBalancerRegion] = string(DEFAULT_REGION)
+	if err := check(); err != nil {
+		t.Fatalf("expect loadbalancer in cluster region allowed, got %s", err.Error())
+	}
+
+	// slb is looked up in the region it was created in
+	svc.Annotations = map[string]string{
+		utils.ServiceAnnotationLoadBalancerResources: `{"loadBalancers":[{"loadBalancerId":"lb-1","region":"cn-beijing"}]}`,
+	}
+	if err := check(); err == nil || !strings.Contains(err.Error(), "can not be changed") {
+		t.Fatalf("expect region change refused, got %v", err)
+	}
+	if region := getLoadBalancerRegion(svc); region != common.Beijing {
+		t.Fatalf("expect recorded region of loadbalancer, got %s", region)
+	}
+}
+
 func NewMockClientMgr(client ClientSLBSDK) (*ClientMgr, error) {
 	mgr := &ClientMgr{
 		stop: make(<-chan struct{}, 1),
@@ -299,3 +363,847 @@ func TestUpdateLoadBalancerWhenStartLoadBalancerFailed(t *testing.T) {
 		t.Fatalf("listener stop error.")
 	}
 }
+
+func TestNamespaceQuota(t *testing.T) {
+	origin := cfg.Global.NamespaceQuotas
+	defer func() { cfg.Global.NamespaceQuotas = origin }()
+	cfg.Global.NamespaceQuotas = map[string]NamespaceQuota{
+		"team-a":          {MaxLoadBalancers: 2, MaxInternetLoadBalancers: 1, MaxBandwidth: 100},
+		DEFAULT_QUOTA_KEY: {MaxLoadBalancers: 1},
+	}
+
+	quota, ok := getNamespaceQuota("team-b")
+	if !ok || quota.MaxLoadBalancers != 1 {
+		t.Fatalf("namespace without quota should fallback to default quota")
+	}
+
+	quota, ok = getNamespaceQuota("team-a")
+	if !ok {
+		t.Fatalf("quota of team-a not found")
+	}
+	used := namespaceUsage{}
+	used.add(slb.IntranetAddressType, slb.PayByTraffic, 0)
+	used.add(slb.InternetAddressType, slb.PayByBandwidth, 80)
+	if err := quota.check(used); err != nil {
+		t.Fatalf("expected usage within quota, got: %s", err.Error())
+	}
+	used.add(slb.InternetAddressType, slb.PayByTraffic, 0)
+	if err := quota.check(used); err == nil {
+		t.Fatalf("expected loadbalancer count exceeds quota")
+	}
+
+	used = namespaceUsage{}
+	used.add(slb.InternetAddressType, slb.PayByBandwidth, 120)
+	if err := quota.check(used); err == nil || !strings.Contains(err.Error(), "bandwidth") {
+		t.Fatalf("expected bandwidth exceeds quota")
+	}
+
+	// bandwidth increase on update is counted with usage of all regions
+	lbc := &LoadBalancerClient{
+		usage: func(ctx context.Context, namespace string) (namespaceUsage, error) {
+			used := namespaceUsage{}
+			used.add(slb.InternetAddressType, slb.PayByBandwidth, 50)
+			used.merge(namespaceUsage{LoadBalancers: 1})
+			return used, nil
+		},
+	}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "service-test"}}
+	lb := &slb.LoadBalancerType{
+		AddressType:        slb.InternetAddressType,
+		InternetChargeType: slb.PayByBandwidth,
+		Bandwidth:          50,
+	}
+	request := &AnnotationRequest{ChargeType: slb.PayByBandwidth, Bandwidth: 100}
+	if err := lbc.checkBandwidthQuota(context.Background(), svc, lb, request); err != nil {
+		t.Fatalf("expected bandwidth increase within quota, got: %s", err.Error())
+	}
+	request.Bandwidth = 120
+	if err := lbc.checkBandwidthQuota(context.Background(), svc, lb, request); err == nil {
+		t.Fatalf("expected bandwidth increase exceeds quota")
+	}
+	lb.InternetChargeType, request.ChargeType = slb.PayByTraffic, ""
+	if err := lbc.checkBandwidthQuota(context.Background(), svc, lb, request); err != nil {
+		t.Fatalf("bandwidth of slb charged by traffic should not be counted, got: %s", err.Error())
+	}
+}
+
+func TestNamespaceQuotaConcurrentCreation(t *testing.T) {
+	origin := cfg.Global.NamespaceQuotas
+	defer func() { cfg.Global.NamespaceQuotas = origin }()
+	cfg.Global.NamespaceQuotas = map[string]NamespaceQuota{"team-a": {MaxLoadBalancers: 1}}
+
+	var (
+		lock    sync.Mutex
+		created int
+	)
+	lbc := &LoadBalancerClient{
+		c: &mockClientSLB{
+			createLoadBalancer: func(args *slb.CreateLoadBalancerArgs) (*slb.CreateLoadBalancerResponse, error) {
+				// slow creation to overlap concurrent syncs
+				time.Sleep(20 * time.Millisecond)
+				return &slb.CreateLoadBalancerResponse{LoadBalancerId: newid()}, nil
+			},
+			addTags: func(args *slb.AddTagsArgs) error {
+				lock.Lock()
+				defer lock.Unlock()
+				created++
+				return nil
+			},
+		},
+		usage: func(ctx context.Context, namespace string) (namespaceUsage, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return namespaceUsage{LoadBalancers: created}, nil
+		},
+	}
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: fmt.Sprintf("service-%d", i)}}
+			_, err := lbc.createLoadBalancer(context.Background(), svc, &slb.CreateLoadBalancerArgs{}, map[string]string{})
+			if err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 || failed != 2 {
+		t.Fatalf("expect only one loadbalancer created within quota, created %d, failed %d", created, failed)
+	}
+}
+
+func TestRetainLoadBalancer(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "service-test",
+			Annotations: map[string]string{},
+		},
+	}
+	if isRetainLoadBalancer(svc) {
+		t.Fatal("loadbalancer should be deleted by default")
+	}
+	cfg.Global.RetainLoadBalancerOnDelete = true
+	defer func() { cfg.Global.RetainLoadBalancerOnDelete = false }()
+	if !isRetainLoadBalancer(svc) {
+		t.Fatal("cluster default should retain loadbalancer")
+	}
+	svc.Annotations[ServiceAnnotationLoadBalancerRetainOnDelete] = "off"
+	if isRetainLoadBalancer(svc) {
+		t.Fatal("annotation should override cluster default")
+	}
+
+	var removed, added []slb.TagItem
+	client := &mockClientSLB{
+		describeTags: func(args *slb.DescribeTagsArgs) ([]slb.TagItemType, *common.PaginationResult, error) {
+			return []slb.TagItemType{
+				{TagItem: slb.TagItem{TagKey: TAGKEY, TagValue: "service-test"}},
+				{TagItem: slb.TagItem{TagKey: ACKKEY, TagValue: CLUSTER_ID}},
+				{TagItem: slb.TagItem{TagKey: "user-tag", TagValue: "v"}},
+			}, nil, nil
+		},
+		removeTags: func(args *slb.RemoveTagsArgs) error {
+			return json.Unmarshal([]byte(args.Tags), &removed)
+		},
+		addTags: func(args *slb.AddTagsArgs) error {
+			return json.Unmarshal([]byte(args.Tags), &added)
+		},
+	}
+	lbc := &LoadBalancerClient{c: client}
+	lb := &slb.LoadBalancerType{LoadBalancerId: LOADBALANCER_ID}
+	if err := lbc.releaseLoadBalancerTags(context.Background(), svc, lb); err != nil {
+		t.Fatalf("release tags error: %s", err.Error())
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expect kubernetes tags to be removed, got %v", removed)
+	}
+	if len(added) != 1 || added[0].TagKey != RELEASEDKEY || added[0].TagValue != "default/service-test" {
+		t.Fatalf("expect released tag to be added, got %v", added)
+	}
+}
+
+func TestRetainAndAdoptLoadBalancer(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	f := NewDefaultFrameWork(nil)
+	f.WithService(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "retained-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist + "-retained"),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerRetainOnDelete: "on",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		},
+	).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	f.RunCustomized(t, "Retain and adopt loadbalancer",
+		func(f *FrameWork) error {
+			ctx := context.Background()
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes); err != nil {
+				return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+			}
+			_, lb, err := f.LoadBalancer().FindLoadBalancer(ctx, f.SVC)
+			if err != nil {
+				return fmt.Errorf("find loadbalancer: %v", err)
+			}
+			if err := f.CloudImpl().EnsureLoadBalancerDeleted(ctx, CLUSTER_ID, f.SVC); err != nil {
+				return fmt.Errorf("EnsureLoadBalancerDeleted error: %s", err.Error())
+			}
+			retained, err := f.SLBSDK().DescribeLoadBalancerAttribute(ctx, lb.LoadBalancerId)
+			if err != nil {
+				return fmt.Errorf("loadbalancer should be retained, %s", err.Error())
+			}
+			if len(retained.ListenerPortsAndProtocol.ListenerPortAndProtocol) != 0 {
+				return fmt.Errorf("listeners of retained loadbalancer should be removed")
+			}
+			tags, _, _ := f.SLBSDK().DescribeTags(ctx, &slb.DescribeTagsArgs{LoadBalancerID: lb.LoadBalancerId})
+			if !hasTagKey(tags, RELEASEDKEY) || hasTagKey(tags, TAGKEY) {
+				return fmt.Errorf("expect retained loadbalancer tagged as released, got %v", tags)
+			}
+
+			// released slb is adopted by another service
+			svc := f.SVC.DeepCopy()
+			svc.Name = "adopting-service"
+			svc.UID = types.UID(serviceUIDNoneExist + "-adopting")
+			svc.Annotations = map[string]string{
+				ServiceAnnotationLoadBalancerId:               lb.LoadBalancerId,
+				ServiceAnnotationLoadBalancerOverrideListener: "true",
+			}
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, svc, f.Nodes); err != nil {
+				return fmt.Errorf("adopt released loadbalancer error: %s", err.Error())
+			}
+			tags, _, _ = f.SLBSDK().DescribeTags(ctx, &slb.DescribeTagsArgs{LoadBalancerID: lb.LoadBalancerId})
+			if hasTagKey(tags, RELEASEDKEY) {
+				return fmt.Errorf("released tag should be removed on adoption, got %v", tags)
+			}
+			return nil
+		},
+	)
+}
+
+func TestDualStackLoadBalancer(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	f := NewDefaultFrameWork(nil)
+	f.WithService(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dual-stack-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerIPFamilyPolicy: PreferDualStack,
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		},
+	).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	f.RunCustomized(t, "Dual stack service",
+		func(f *FrameWork) error {
+			ctx := context.Background()
+			status, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes)
+			if err != nil {
+				return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+			}
+			if len(status.Ingress) != 2 ||
+				status.Ingress[0].IP != LOADBALANCER_ADDRESS ||
+				status.Ingress[1].IP != LOADBALANCER_IPV6_ADDRESS {
+				return fmt.Errorf("expect both ipv4 and ipv6 ingress, got %+v", status.Ingress)
+			}
+			ipv6 := dualStackIPv6Service(f.SVC)
+			exists, lb, err := f.LoadBalancer().FindLoadBalancer(ctx, ipv6)
+			if err != nil || !exists {
+				return fmt.Errorf("ipv6 loadbalancer not found: %v", err)
+			}
+			if lb.AddressIPVersion != slb.IPv6 || lb.LoadBalancerName != "dual-stack-service-ipv6" {
+				return fmt.Errorf("unexpected ipv6 loadbalancer %s, %s", lb.LoadBalancerName, lb.AddressIPVersion)
+			}
+			if len(lb.ListenerPortsAndProtocol.ListenerPortAndProtocol) != 1 {
+				return fmt.Errorf("ipv6 loadbalancer should have the same listeners")
+			}
+
+			// ipv6 slb is not found by a service named after it
+			other := f.SVC.DeepCopy()
+			other.Name, other.UID = "dual-stack-service-ipv6", types.UID("other-uid")
+			other.Annotations = nil
+			if exists, _, err := f.LoadBalancer().FindLoadBalancer(ctx, other); err != nil || exists {
+				return fmt.Errorf("ipv6 loadbalancer should not be found by other service, %v", err)
+			}
+			_, v4, err := f.LoadBalancer().FindLoadBalancer(ctx, f.SVC)
+			if err != nil || v4.AddressIPVersion != slb.IPv4 {
+				return fmt.Errorf("expect ipv4 loadbalancer found by the service, %v", err)
+			}
+
+			// dual stack is turned off and on again
+			f.SVC.Status.LoadBalancer = *status
+			delete(f.SVC.Annotations, ServiceAnnotationLoadBalancerIPFamilyPolicy)
+			status, err = f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes)
+			if err != nil || len(status.Ingress) != 1 {
+				return fmt.Errorf("expect single stack, got %v, %v", status, err)
+			}
+			if exists, _, err := f.LoadBalancer().FindLoadBalancer(ctx, ipv6); err != nil || exists {
+				return fmt.Errorf("ipv6 loadbalancer should be deleted, %v", err)
+			}
+			f.SVC.Status.LoadBalancer = *status
+			f.SVC.Annotations[ServiceAnnotationLoadBalancerIPFamilyPolicy] = PreferDualStack
+			status, err = f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes)
+			if err != nil || len(status.Ingress) != 2 {
+				return fmt.Errorf("expect dual stack again, got %v, %v", status, err)
+			}
+
+			f.SVC.Status.LoadBalancer = *status
+			if err := f.CloudImpl().EnsureLoadBalancerDeleted(ctx, CLUSTER_ID, f.SVC); err != nil {
+				return fmt.Errorf("EnsureLoadBalancerDeleted error: %s", err.Error())
+			}
+			for _, svc := range []*v1.Service{f.SVC, ipv6} {
+				exists, _, err := f.LoadBalancer().FindLoadBalancer(ctx, svc)
+				if err != nil || exists {
+					return fmt.Errorf("loadbalancer %s should be deleted", GetLoadBalancerName(svc))
+				}
+			}
+			return nil
+		},
+	)
+}
+
+func TestSharedLoadBalancer(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	member := func(name string, port int32) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(fmt.Sprintf("%s-%s", serviceUIDNoneExist, name)),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerSharedGroup: "group-a",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: port, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		}
+	}
+	svca, svcb := member("service-a", listenPort1), member("service-b", listenPort1+1)
+	svca.Annotations[ServiceAnnotationLoadBalancerSpec] = "slb.s2.small"
+	f := NewDefaultFrameWork(nil)
+	f.WithService(svca).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	f.RunCustomized(t, "Shared loadbalancer",
+		func(f *FrameWork) error {
+			ctx := context.Background()
+			for _, svc := range []*v1.Service{svca, svcb} {
+				if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, svc, f.Nodes); err != nil {
+					return fmt.Errorf("EnsureLoadBalancer %s error: %s", svc.Name, err.Error())
+				}
+			}
+			_, lba, err := f.LoadBalancer().FindLoadBalancer(ctx, svca)
+			if err != nil {
+				return fmt.Errorf("find loadbalancer of service-a: %v", err)
+			}
+			exists, lb, err := f.LoadBalancer().FindLoadBalancerBySharedGroup(ctx, "group-a")
+			if err != nil || !exists || lb.LoadBalancerId != lba.LoadBalancerId {
+				return fmt.Errorf("expect members found the same loadbalancer by group, %v", err)
+			}
+			if len(lb.ListenerPortsAndProtocol.ListenerPortAndProtocol) != 2 {
+				return fmt.Errorf("expect listeners of both members on the shared loadbalancer")
+			}
+			if exists, _, _ := f.LoadBalancer().FindLoadBalancerBySharedGroup(ctx, "group-b"); exists {
+				return fmt.Errorf("loadbalancer of other group should not be found")
+			}
+
+			// loadbalancer attributes are owned by the member created it
+			svcb.Annotations[ServiceAnnotationLoadBalancerSpec] = "slb.s3.small"
+			_, err = f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, svcb, f.Nodes)
+			if err == nil || !strings.Contains(err.Error(), "SharedGroupConflict") {
+				return fmt.Errorf("expect conflict of loadbalancer spec, got %v", err)
+			}
+
+			// slb is kept until the last member leaves, and owned by the rest
+			if err := f.CloudImpl().EnsureLoadBalancerDeleted(ctx, CLUSTER_ID, svca); err != nil {
+				return fmt.Errorf("EnsureLoadBalancerDeleted service-a error: %s", err.Error())
+			}
+			exists, lb, err = f.LoadBalancer().FindLoadBalancerBySharedGroup(ctx, "group-a")
+			if err != nil || !exists {
+				return fmt.Errorf("shared loadbalancer should be kept for service-b, %v", err)
+			}
+			if len(lb.ListenerPortsAndProtocol.ListenerPortAndProtocol) != 1 {
+				return fmt.Errorf("expect listener of service-a removed")
+			}
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, svcb, f.Nodes); err != nil {
+				return fmt.Errorf("EnsureLoadBalancer service-b error: %s", err.Error())
+			}
+			_, lb, _ = f.LoadBalancer().FindLoadBalancerBySharedGroup(ctx, "group-a")
+			if lb.LoadBalancerSpec != "slb.s3.small" {
+				return fmt.Errorf("expect spec applied by the new owner, got %s", lb.LoadBalancerSpec)
+			}
+
+			if err := f.CloudImpl().EnsureLoadBalancerDeleted(ctx, CLUSTER_ID, svcb); err != nil {
+				return fmt.Errorf("EnsureLoadBalancerDeleted service-b error: %s", err.Error())
+			}
+			exists, _, err = f.LoadBalancer().FindLoadBalancerBySharedGroup(ctx, "group-a")
+			if err != nil || exists {
+				return fmt.Errorf("shared loadbalancer should be deleted with the last member, %v", err)
+			}
+			return nil
+		},
+	)
+}
+
+func TestSelectZones(t *testing.T) {
+	node := func(name, zone string, ready v1.ConditionStatus) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{v1.LabelZoneFailureDomain: zone},
+			},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	nodes := &EndpointWithENI{
+		Nodes: []*v1.Node{
+			node("n1", "cn-hangzhou-a", v1.ConditionTrue),
+			node("n2", "cn-hangzhou-b", v1.ConditionTrue),
+			node("n3", "cn-hangzhou-b", v1.ConditionTrue),
+			node("n4", "cn-hangzhou-c", v1.ConditionTrue),
+			node("n5", "cn-hangzhou-c", v1.ConditionTrue),
+			node("n6", "cn-hangzhou-c", v1.ConditionFalse),
+			node("n7", "cn-hangzhou-c", v1.ConditionFalse),
+		},
+	}
+	resource := func(master, slave string) AvailableResourceType {
+		res := AvailableResourceType{MasterZoneId: master, SlaveZoneId: slave}
+		res.SupportResources.SupportResource = []SupportResourceType{
+			{AddressType: string(slb.InternetAddressType), AddressIPVersion: string(slb.IPv4)},
+		}
+		return res
+	}
+	client := &mockClientSLB{
+		describeAvailableResource: func(args *DescribeAvailableResourceArgs) ([]AvailableResourceType, error) {
+			// zone b has no stock as master zone
+			return []AvailableResourceType{
+				resource("cn-hangzhou-a", "cn-hangzhou-b"),
+				resource("cn-hangzhou-c", "cn-hangzhou-d"),
+				resource("cn-hangzhou-c", "cn-hangzhou-a"),
+			}, nil
+		},
+	}
+	lbc := &LoadBalancerClient{c: client}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "service-test", Namespace: "default"}}
+
+	args := &slb.CreateLoadBalancerArgs{}
+	lbc.selectZones(context.Background(), svc, nodes, args)
+	if args.MasterZoneId != "cn-hangzhou-c" || args.SlaveZoneId != "cn-hangzhou-a" {
+		t.Fatalf("expect zone pair cn-hangzhou-c/cn-hangzhou-a, got %s/%s", args.MasterZoneId, args.SlaveZoneId)
+	}
+
+	args = &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-b"}
+	lbc.selectZones(context.Background(), svc, nodes, args)
+	if args.MasterZoneId != "cn-hangzhou-b" || args.SlaveZoneId != "" {
+		t.Fatalf("user specified zone should not be changed, got %s/%s", args.MasterZoneId, args.SlaveZoneId)
+	}
+
+	args = &slb.CreateLoadBalancerArgs{AddressIPVersion: slb.IPv6}
+	lbc.selectZones(context.Background(), svc, nodes, args)
+	if args.MasterZoneId != "" || args.SlaveZoneId != "" {
+		t.Fatalf("zones without ipv6 stock should not be selected, got %s/%s", args.MasterZoneId, args.SlaveZoneId)
+	}
+}
+
+func TestSelectVSwitch(t *testing.T) {
+	vswitches := []ecs.VSwitchSetType{
+		{VSwitchId: "vsw-a1", ZoneId: "cn-hangzhou-a", AvailableIpAddressCount: 10, Status: ecs.VSwitchStatusAvailable},
+		{VSwitchId: "vsw-a2", ZoneId: "cn-hangzhou-a", AvailableIpAddressCount: 20, Status: ecs.VSwitchStatusAvailable},
+		{VSwitchId: "vsw-b1", ZoneId: "cn-hangzhou-b", AvailableIpAddressCount: 100, Status: ecs.VSwitchStatusAvailable},
+		{VSwitchId: "vsw-other", ZoneId: "cn-hangzhou-b", AvailableIpAddressCount: 200, Status: ecs.VSwitchStatusAvailable},
+	}
+	vpc := &mockRouteSDK{
+		describeVSwitches: func(args *DescribeVSwitchesArgs) ([]ecs.VSwitchSetType, *common.PaginationResult, error) {
+			return vswitches, nil, nil
+		},
+	}
+	var stock []AvailableResourceType
+	lbc := &LoadBalancerClient{
+		c: &mockClientSLB{
+			describeAvailableResource: func(args *DescribeAvailableResourceArgs) ([]AvailableResourceType, error) {
+				return stock, nil
+			},
+		},
+		vpcid: VPCID,
+		vswitch: &VSwitchSelector{
+			c:   vpc,
+			ids: []string{"vsw-a1", "vsw-a2", "vsw-b1"},
+		},
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-test",
+			Namespace: "default",
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerAddressType: string(slb.IntranetAddressType),
+			},
+		},
+	}
+
+	args := &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-a", SlaveZoneId: "cn-hangzhou-b"}
+	if err := lbc.selectVSwitch(context.Background(), svc, args); err != nil {
+		t.Fatalf("select vswitch error: %s", err.Error())
+	}
+	if args.VSwitchId != "vsw-a2" || args.MasterZoneId != "cn-hangzhou-a" || args.SlaveZoneId != "cn-hangzhou-b" {
+		t.Fatalf("expect vsw-a2 in the selected zone, got %s in %s", args.VSwitchId, args.MasterZoneId)
+	}
+
+	// zone a is exhausted, slave zone b becomes the master zone, zone a is
+	// kept as slave zone only if the reversed pair has stock
+	vswitches[0].AvailableIpAddressCount = 0
+	vswitches[1].AvailableIpAddressCount = 0
+	args = &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-a", SlaveZoneId: "cn-hangzhou-b"}
+	if err := lbc.selectVSwitch(context.Background(), svc, args); err != nil {
+		t.Fatalf("select vswitch error: %s", err.Error())
+	}
+	if args.VSwitchId != "vsw-b1" || args.MasterZoneId != "cn-hangzhou-b" || args.SlaveZoneId != "" {
+		t.Fatalf("expect vsw-b1 in zone b without slave zone, got %s in %s/%s",
+			args.VSwitchId, args.MasterZoneId, args.SlaveZoneId)
+	}
+	stock = []AvailableResourceType{{MasterZoneId: "cn-hangzhou-b", SlaveZoneId: "cn-hangzhou-a"}}
+	args = &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-a", SlaveZoneId: "cn-hangzhou-b"}
+	if err := lbc.selectVSwitch(context.Background(), svc, args); err != nil {
+		t.Fatalf("select vswitch error: %s", err.Error())
+	}
+	if args.VSwitchId != "vsw-b1" || args.MasterZoneId != "cn-hangzhou-b" || args.SlaveZoneId != "cn-hangzhou-a" {
+		t.Fatalf("expect vsw-b1 in zone b, got %s in %s/%s", args.VSwitchId, args.MasterZoneId, args.SlaveZoneId)
+	}
+
+	// no vswitch in the selected zones, fall back to other zones
+	args = &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-a", SlaveZoneId: "cn-hangzhou-c"}
+	if err := lbc.selectVSwitch(context.Background(), svc, args); err != nil {
+		t.Fatalf("select vswitch error: %s", err.Error())
+	}
+	if args.VSwitchId != "vsw-b1" || args.MasterZoneId != "cn-hangzhou-b" || args.SlaveZoneId != "" {
+		t.Fatalf("expect vsw-b1 in zone b, got %s in %s/%s", args.VSwitchId, args.MasterZoneId, args.SlaveZoneId)
+	}
+
+	// master zone specified by user must be respected
+	svc.Annotations[ServiceAnnotationLoadBalancerMasterZoneID] = "cn-hangzhou-a"
+	args = &slb.CreateLoadBalancerArgs{MasterZoneId: "cn-hangzhou-a"}
+	if err := lbc.selectVSwitch(context.Background(), svc, args); err == nil {
+		t.Fatalf("expect error when master zone has no available vswitch, got %s", args.VSwitchId)
+	}
+	delete(svc.Annotations, ServiceAnnotationLoadBalancerMasterZoneID)
+
+	vswitches[2].AvailableIpAddressCount = 0
+	args = &slb.CreateLoadBalancerArgs{}
+	err := lbc.selectVSwitch(context.Background(), svc, args)
+	if err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Fatalf("expect exhausted error, got %v", err)
+	}
+}
+
+func TestEnsureLoadBalancerTags(t *testing.T) {
+	PreSetCloudData(WithNewLoadBalancerStore())
+	client := &mockClientSLB{}
+	lbc := &LoadBalancerClient{c: client}
+	lb := &slb.LoadBalancerType{LoadBalancerId: LOADBALANCER_ID, RegionId: REGION}
+	ctx := context.Background()
+	if err := addSLBTag(client, ctx, map[string]string{
+		TAGKEY:    "service-test",
+		ACKKEY:    CLUSTER_ID,
+		"team":    "a",
+		"removed": "v",
+		"console": "v",
+	}, REGION, LOADBALANCER_ID); err != nil {
+		t.Fatalf("add tags error: %s", err.Error())
+	}
+	// only tags applied by ccm are pruned, tags added on console are kept
+	applied, _ := json.Marshal(&utils.ManagedResources{
+		LoadBalancers: []*utils.LoadBalancerResource{
+			{LoadBalancerId: LOADBALANCER_ID, Tags: map[string]string{"team": "a", "removed": "v"}},
+		},
+	})
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-test",
+			Namespace: "default",
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerAdditionalTags:  "team=b,cost=c1," + ACKKEY + "=other",
+				utils.ServiceAnnotationLoadBalancerResources: string(applied),
+			},
+		},
+	}
+	tags, _, _ := client.DescribeTags(ctx, &slb.DescribeTagsArgs{LoadBalancerID: LOADBALANCER_ID})
+	if err := lbc.ensureLoadBalancerTags(ctx, svc, lb, tags); err != nil {
+		t.Fatalf("ensure tags error: %s", err.Error())
+	}
+	tags, _, _ = client.DescribeTags(ctx, &slb.DescribeTagsArgs{LoadBalancerID: LOADBALANCER_ID})
+	result := map[string]string{}
+	for _, tag := range tags {
+		if _, ok := result[tag.TagKey]; ok {
+			t.Fatalf("duplicated tag %s", tag.TagKey)
+		}
+		result[tag.TagKey] = tag.TagValue
+	}
+	expect := map[string]string{TAGKEY: "service-test", ACKKEY: CLUSTER_ID, "team": "b", "cost": "c1", "console": "v"}
+	if !reflect.DeepEqual(result, expect) {
+		t.Fatalf("expect tags %v, got %v", expect, result)
+	}
+
+	// user tags of acl are never pruned
+	if err := client.TagResources(ctx, &TagResourcesArgs{
+		ResourceType: TagResourceACL,
+		ResourceId:   []string{"acl-1"},
+		Tag:          []ResourceTag{{Key: "owner", Value: "user"}},
+	}); err != nil {
+		t.Fatalf("tag acl error: %s", err.Error())
+	}
+	svc.Annotations[ServiceAnnotationLoadBalancerAclID] = "acl-1"
+	vgs := &vgroups{&vgroup{VGroupId: "rsp-1"}}
+	if err := lbc.ensureRelatedResourceTags(ctx, svc, lb, vgs); err != nil {
+		t.Fatalf("ensure related resource tags error: %s", err.Error())
+	}
+	for _, res := range []struct {
+		rtype  string
+		id     string
+		expect int
+	}{
+		{TagResourceVServerGroup, "rsp-1", 2},
+		{TagResourceACL, "acl-1", 3},
+	} {
+		tags, _ := client.ListTagResources(ctx, &ListTagResourcesArgs{ResourceType: res.rtype, ResourceId: []string{res.id}})
+		if len(tags) != res.expect {
+			t.Fatalf("expect %d tags on %s, got %v", res.expect, res.id, tags)
+		}
+	}
+
+	// tags applied to the recorded acl and eips are pruned, eips associated
+	// later are only tagged
+	applied, _ = json.Marshal(&utils.ManagedResources{
+		LoadBalancers: []*utils.LoadBalancerResource{
+			{
+				LoadBalancerId: LOADBALANCER_ID,
+				AclId:          "acl-1",
+				EipIds:         []string{"eip-1"},
+				Tags:           map[string]string{"team": "b", "cost": "c1", "removed": "v"},
+			},
+		},
+	})
+	svc.Annotations[utils.ServiceAnnotationLoadBalancerResources] = string(applied)
+	for _, res := range []struct {
+		rtype string
+		id    string
+	}{
+		{TagResourceACL, "acl-1"},
+		{TagResourceEIP, "eip-1"},
+		{TagResourceEIP, "eip-2"},
+	} {
+		if err := client.TagResources(ctx, &TagResourcesArgs{
+			ResourceType: res.rtype,
+			ResourceId:   []string{res.id},
+			Tag:          []ResourceTag{{Key: "removed", Value: "v"}},
+		}); err != nil {
+			t.Fatalf("tag %s error: %s", res.id, err.Error())
+		}
+	}
+	lbc.eip = &mockEipSDK{
+		mockClientSLB: client,
+		eips:          []ecs.EipAddressSetType{{AllocationId: "eip-1"}, {AllocationId: "eip-2"}},
+	}
+	if err := lbc.ensureRelatedResourceTags(ctx, svc, lb, vgs); err != nil {
+		t.Fatalf("ensure related resource tags error: %s", err.Error())
+	}
+	for _, res := range []struct {
+		rtype  string
+		id     string
+		expect map[string]string
+	}{
+		{TagResourceACL, "acl-1", map[string]string{"owner": "user", "team": "b", "cost": "c1"}},
+		{TagResourceEIP, "eip-1", map[string]string{"team": "b", "cost": "c1"}},
+		{TagResourceEIP, "eip-2", map[string]string{"team": "b", "cost": "c1", "removed": "v"}},
+	} {
+		tags, _ := client.ListTagResources(ctx, &ListTagResourcesArgs{ResourceType: res.rtype, ResourceId: []string{res.id}})
+		result := map[string]string{}
+		for _, tag := range tags {
+			result[tag.TagKey] = tag.TagValue
+		}
+		if !reflect.DeepEqual(result, res.expect) {
+			t.Fatalf("expect tags %v on %s, got %v", res.expect, res.id, result)
+		}
+	}
+}
+
+type mockEipSDK struct {
+	*mockClientSLB
+	eips []ecs.EipAddressSetType
+}
+
+func (m *mockEipSDK) DescribeEipAddresses(
+	ctx context.Context,
+	args *ecs.DescribeEipAddressesArgs,
+) ([]ecs.EipAddressSetType, *common.PaginationResult, error) {
+	return m.eips, nil, nil
+}
+
+func TestRecordManagedResources(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	f := NewDefaultFrameWork(nil)
+	f.WithService(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "resources-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerAclID: "acl-1",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		},
+	).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	f.RunCustomized(t, "Record managed resources",
+		func(f *FrameWork) error {
+			resources := &utils.ManagedResources{}
+			ctx := context.WithValue(context.Background(), utils.ContextResources, resources)
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes); err != nil {
+				return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+			}
+			if len(resources.LoadBalancers) != 1 {
+				return fmt.Errorf("expect one loadbalancer recorded, got %d", len(resources.LoadBalancers))
+			}
+			lb := resources.LoadBalancers[0]
+			if lb.LoadBalancerId == "" || lb.AclId != "acl-1" {
+				return fmt.Errorf("unexpected loadbalancer record %+v", lb)
+			}
+			if len(lb.Listeners) != 1 || lb.Listeners[0].Port != int(listenPort1) || lb.Listeners[0].Protocol != "tcp" {
+				return fmt.Errorf("unexpected listeners %+v", lb.Listeners)
+			}
+			if len(lb.VServerGroups) != 1 || lb.VServerGroups[0].VGroupId == "" ||
+				!strings.Contains(lb.VServerGroups[0].Name, "resources-service") {
+				return fmt.Errorf("unexpected vserver groups %+v", lb.VServerGroups)
+			}
+			return nil
+		},
+	)
+}
+
+func TestRecordEipsBestEffort(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	described := 0
+	ins := &mockClientInstanceSDK{
+		describeEipAddresses: func(args *ecs.DescribeEipAddressesArgs) ([]ecs.EipAddressSetType, *common.PaginationResult, error) {
+			described++
+			return nil, nil, fmt.Errorf("Throttling: request was denied due to flow control")
+		},
+	}
+	DefaultPreset()
+	cloud, err := newMockCloudWithSDK(&mockClientSLB{}, &mockRouteSDK{}, ins, nil)
+	if err != nil {
+		t.Fatalf("new mock cloud: %s", err.Error())
+	}
+	f := NewFrameWork(cloud,
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "eip-service",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		},
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+		nil, nil,
+	)
+
+	f.RunCustomized(t, "Record eips best effort",
+		func(f *FrameWork) error {
+			ctx := context.WithValue(context.Background(), utils.ContextResources, &utils.ManagedResources{})
+			// internet slb has no eip
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes); err != nil {
+				return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+			}
+			if described != 0 {
+				return fmt.Errorf("expect eips of internet loadbalancer not described")
+			}
+			if err := f.CloudImpl().EnsureLoadBalancerDeleted(ctx, CLUSTER_ID, f.SVC); err != nil {
+				return fmt.Errorf("EnsureLoadBalancerDeleted error: %s", err.Error())
+			}
+
+			// failure of describing eips does not fail the service
+			svc := f.SVC.DeepCopy()
+			svc.Name, svc.UID = "eip-intranet-service", types.UID("eip-intranet-uid")
+			svc.Annotations = map[string]string{
+				ServiceAnnotationLoadBalancerAddressType: string(slb.IntranetAddressType),
+			}
+			if _, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, svc, f.Nodes); err != nil {
+				return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+			}
+			if described == 0 {
+				return fmt.Errorf("expect eips of intranet loadbalancer described")
+			}
+			return nil
+		},
+	)
+}
@@ -26,6 +26,7 @@ import (
 
 	"bytes"
 	"encoding/json"
+	"github.com/denverdino/aliyungo/common"
 	"github.com/denverdino/aliyungo/slb"
 	"k8s.io/api/core/v1"
 )
@@ -43,6 +44,9 @@ const (
 	// ServiceAnnotationPrivateZonePrefix private zone prefix
 	ServiceAnnotationPrivateZonePrefix = ServiceAnnotationPrefix + "private-zone-"
 
+	// ServiceAnnotationPublicDNSPrefix public dns prefix
+	ServiceAnnotationPublicDNSPrefix = ServiceAnnotationPrefix + "public-dns-"
+
 	// ServiceAnnotationLoadBalancerAclStatus enable or disable acl on all listener
 	ServiceAnnotationLoadBalancerAclStatus = ServiceAnnotationLoadBalancerPrefix + "acl-status"
 
@@ -55,6 +59,9 @@ const (
 	// ServiceAnnotationLoadBalancerProtocolPort protocol port
 	ServiceAnnotationLoadBalancerProtocolPort = ServiceAnnotationLoadBalancerPrefix + "protocol-port"
 
+	// ServiceAnnotationLoadBalancerAppProtocol whether spec.ports[].appProtocol decides listener protocol, on or off
+	ServiceAnnotationLoadBalancerAppProtocol = ServiceAnnotationLoadBalancerPrefix + "app-protocol"
+
 	// ServiceAnnotationLoadBalancerAddressType loadbalancer address type
 	ServiceAnnotationLoadBalancerAddressType = ServiceAnnotationLoadBalancerPrefix + "address-type"
 
@@ -167,11 +174,36 @@ const (
 	ServiceAnnotationLoadBalancerPrivateZoneId = ServiceAnnotationPrivateZonePrefix + "id"
 
 	// ServiceAnnotationLoadBalancerPrivateZoneRecordName private zone record name
-	ServiceAnnotationLoadBalancerPrivateZoneRecordName = ServiceAnnotationPrivateZonePrefix + "record-name"
+	ServiceAnnotationLoadBalancerPrivateZoneRecordName = utils.ServiceAnnotationPrivateZoneRecordName
 
 	// ServiceAnnotationLoadBalancerPrivateZoneRecordTTL private zone record ttl
 	ServiceAnnotationLoadBalancerPrivateZoneRecordTTL = ServiceAnnotationPrivateZonePrefix + "record-ttl"
 
+	// ServiceAnnotationLoadBalancerPrivateZoneRecordCname hostname which the
+	// records are CNAME to, instead of A or AAAA records of the slb address
+	ServiceAnnotationLoadBalancerPrivateZoneRecordCname = ServiceAnnotationPrivateZonePrefix + "record-cname"
+
+	// ServiceAnnotationLoadBalancerPrivateZoneRecordWeight weight of the records,
+	// records of the same name are shared with other services, 1 to 100
+	ServiceAnnotationLoadBalancerPrivateZoneRecordWeight = ServiceAnnotationPrivateZonePrefix + "record-weight"
+
+	// ServiceAnnotationPublicDNSDomain domain of the public dns records, which
+	// must be hosted in alidns
+	ServiceAnnotationPublicDNSDomain = ServiceAnnotationPublicDNSPrefix + "domain"
+
+	// ServiceAnnotationPublicDNSRR rr of the public dns records, eg. www or @
+	ServiceAnnotationPublicDNSRR = ServiceAnnotationPublicDNSPrefix + "rr"
+
+	// ServiceAnnotationPublicDNSTTL ttl of the public dns records
+	ServiceAnnotationPublicDNSTTL = ServiceAnnotationPublicDNSPrefix + "ttl"
+
+	// ServiceAnnotationPublicDNSLine resolution line of the public dns records
+	ServiceAnnotationPublicDNSLine = ServiceAnnotationPublicDNSPrefix + "line"
+
+	// ServiceAnnotationLoadBalancerPrivateZoneAutoCreate create the private zone named by private-zone-name
+	// when it does not exist, on or off
+	ServiceAnnotationLoadBalancerPrivateZoneAutoCreate = ServiceAnnotationPrivateZonePrefix + "auto-create"
+
 	// ServiceAnnotationLoadBalancerBackendType backend type
 	ServiceAnnotationLoadBalancerBackendType = utils.BACKEND_TYPE_LABEL
 
@@ -186,6 +218,15 @@ const (
 
 	// ServiceAnnotationLoadBalancerBackendType external ip type
 	ServiceAnnotationLoadBalancerExternalIPType = ServiceAnnotationLoadBalancerPrefix + "external-ip-type"
+
+	// ServiceAnnotationLoadBalancerSharedGroup services in the same shared group are packed onto one slb
+	ServiceAnnotationLoadBalancerSharedGroup = ServiceAnnotationLoadBalancerPrefix + "shared-group"
+
+	// ServiceAnnotationLoadBalancerRetainOnDelete keep the slb when service is deleted, on or off
+	ServiceAnnotationLoadBalancerRetainOnDelete = ServiceAnnotationLoadBalancerPrefix + "retain-on-delete"
+
+	// ServiceAnnotationLoadBalancerIPFamilyPolicy ip family policy, SingleStack, PreferDualStack or RequireDualStack
+	ServiceAnnotationLoadBalancerIPFamilyPolicy = ServiceAnnotationLoadBalancerPrefix + "ip-family-policy"
 )
 
 type ExternalIPType string
@@ -194,6 +235,13 @@ const (
 	EIPExternalIPType = ExternalIPType("eip")
 )
 
+const (
+	// MAX_PERSISTENCE_TIMEOUT max session persistence timeout of tcp and udp listener
+	MAX_PERSISTENCE_TIMEOUT = 3600
+	// MAX_COOKIE_TIMEOUT max insert cookie timeout of http and https listener
+	MAX_COOKIE_TIMEOUT = 86400
+)
+
 //compatible to old camel annotation
 //If the old and new annotation coexist, the new version will take effect
 func getBackwardsCompatibleAnnotation(annotations map[string]string) map[string]string {
@@ -511,12 +559,30 @@ func ExtractAnnotationRequest(service *v1.Service) (*AnnotationRequest, *Annotat
 		defaulted.Cookie = request.Cookie
 	}
 
+	setSessionAffinity(service, annotation, defaulted, request)
+
 	ipVersion, ok := annotation[ServiceAnnotationLoadBalancerIPVersion]
 	if ok {
 		request.AddressIPVersion = slb.AddressIPVersionType(ipVersion)
 		defaulted.AddressIPVersion = request.AddressIPVersion
 	}
 
+	ipFamilyPolicy, ok := annotation[ServiceAnnotationLoadBalancerIPFamilyPolicy]
+	if ok {
+		request.IPFamilyPolicy = ipFamilyPolicy
+		defaulted.IPFamilyPolicy = request.IPFamilyPolicy
+	} else {
+		defaulted.IPFamilyPolicy = SingleStack
+	}
+	// dual stack service is backed by an ipv4 slb and an ipv6 slb
+	if isDualStack(service) {
+		request.AddressIPVersion = slb.IPv4
+		if isDualStackIPv6(service) {
+			request.AddressIPVersion = slb.IPv6
+		}
+		defaulted.AddressIPVersion = request.AddressIPVersion
+	}
+
 	privateZoneName, ok := annotation[ServiceAnnotationLoadBalancerPrivateZoneName]
 	if ok {
 		request.PrivateZoneName = privateZoneName
@@ -549,6 +615,61 @@ func ExtractAnnotationRequest(service *v1.Service) (*AnnotationRequest, *Annotat
 		}
 	}
 
+	privateZoneRecordCname, ok := annotation[ServiceAnnotationLoadBalancerPrivateZoneRecordCname]
+	if ok {
+		request.PrivateZoneRecordCname = privateZoneRecordCname
+		defaulted.PrivateZoneRecordCname = request.PrivateZoneRecordCname
+	}
+
+	privateZoneRecordWeight, ok := annotation[ServiceAnnotationLoadBalancerPrivateZoneRecordWeight]
+	if ok {
+		weight, err := strconv.Atoi(privateZoneRecordWeight)
+		if err != nil || weight < 1 || weight > 100 {
+			klog.Warningf("annotation "+ServiceAnnotationLoadBalancerPrivateZoneRecordWeight+
+				" must be integer between 1 and 100, but got [%s], use default weight 1.\n",
+				privateZoneRecordWeight)
+			weight = 1
+		}
+		request.PrivateZoneRecordWeight = weight
+		defaulted.PrivateZoneRecordWeight = request.PrivateZoneRecordWeight
+	}
+
+	publicDNSDomain, ok := annotation[ServiceAnnotationPublicDNSDomain]
+	if ok {
+		request.PublicDNSDomain = publicDNSDomain
+		defaulted.PublicDNSDomain = request.PublicDNSDomain
+	}
+
+	publicDNSRR, ok := annotation[ServiceAnnotationPublicDNSRR]
+	if ok {
+		request.PublicDNSRR = publicDNSRR
+		defaulted.PublicDNSRR = request.PublicDNSRR
+	}
+
+	publicDNSTTL, ok := annotation[ServiceAnnotationPublicDNSTTL]
+	if ok {
+		ttl, err := strconv.Atoi(publicDNSTTL)
+		if err != nil {
+			klog.Warningf("annotation "+ServiceAnnotationPublicDNSTTL+
+				" must be integer, but got [%s], use default ttl %d.\n",
+				publicDNSTTL, DEFAULT_PUBLIC_DNS_TTL)
+		} else {
+			request.PublicDNSTTL = ttl
+		}
+	}
+	defaulted.PublicDNSTTL = request.PublicDNSTTL
+	if defaulted.PublicDNSTTL == 0 {
+		defaulted.PublicDNSTTL = DEFAULT_PUBLIC_DNS_TTL
+	}
+
+	publicDNSLine, ok := annotation[ServiceAnnotationPublicDNSLine]
+	if ok {
+		request.PublicDNSLine = publicDNSLine
+		defaulted.PublicDNSLine = request.PublicDNSLine
+	} else {
+		defaulted.PublicDNSLine = DEFAULT_PUBLIC_DNS_LINE
+	}
+
 	backendType, ok := annotation[ServiceAnnotationLoadBalancerBackendType]
 	if ok {
 		request.BackendType = backendType
@@ -595,6 +716,20 @@ func ExtractAnnotationRequest(service *v1.Service) (*AnnotationRequest, *Annotat
 		defaulted.ExternalIPType = request.ExternalIPType
 	}
 
+	region, ok := annotation[ServiceAnnotationLoadBalancerRegion]
+	if ok {
+		request.Region = common.Region(region)
+		defaulted.Region = request.Region
+	} else {
+		defaulted.Region = DEFAULT_REGION
+	}
+
+	sharedGroup, ok := annotation[ServiceAnnotationLoadBalancerSharedGroup]
+	if ok {
+		request.SharedGroup = sharedGroup
+		defaulted.SharedGroup = request.SharedGroup
+	}
+
 	return defaulted, request
 }
 
@@ -692,3 +827,58 @@ func PrettyJson(obj interface{}) string {
 	}
 	return pretty.String()
 }
+
+// setSessionAffinity map sessionAffinity ClientIP to tcp/udp session persistence
+// and http/https insert cookie. Session annotations take precedence.
+// Without ClientIP, persistence derived from ClientIP before is cleared and
+// sticky session is off by default.
+func setSessionAffinity(service *v1.Service, annotation map[string]string, defaulted, request *AnnotationRequest) {
+	if service.Spec.SessionAffinity != v1.ServiceAffinityClientIP {
+		// only persistence derived from affinity before is cleared, persistence
+		// set in console is left as is
+		if _, ok := annotation[ServiceAnnotationLoadBalancerPersistenceTimeout]; !ok &&
+			isSessionPersistenceRecorded(service) {
+			persistence := 0
+			defaulted.PersistenceTimeout = &persistence
+			request.PersistenceTimeout = defaulted.PersistenceTimeout
+		}
+		return
+	}
+	timeout := int(v1.DefaultClientIPServiceAffinitySeconds)
+	if cfg := service.Spec.SessionAffinityConfig; cfg != nil &&
+		cfg.ClientIP != nil && cfg.ClientIP.TimeoutSeconds != nil {
+		timeout = int(*cfg.ClientIP.TimeoutSeconds)
+	}
+	if _, ok := annotation[ServiceAnnotationLoadBalancerPersistenceTimeout]; !ok {
+		persistence := timeout
+		if persistence > MAX_PERSISTENCE_TIMEOUT {
+			persistence = MAX_PERSISTENCE_TIMEOUT
+		}
+		defaulted.PersistenceTimeout = &persistence
+		request.PersistenceTimeout = defaulted.PersistenceTimeout
+	}
+	if _, ok := annotation[ServiceAnnotationLoadBalancerSessionStick]; ok {
+		return
+	}
+	// server sticky session requires the cookie of the backend
+	if defaulted.StickySessionType == slb.ServerStickySessionType && defaulted.Cookie == "" {
+		klog.Warningf("service %s/%s: sticky session type server without annotation %s, "+
+			"sticky session is left off", service.Namespace, service.Name, ServiceAnnotationLoadBalancerCookie)
+		return
+	}
+	request.StickySession = slb.OnFlag
+	defaulted.StickySession = request.StickySession
+	if _, ok := annotation[ServiceAnnotationLoadBalancerSessionStickType]; !ok {
+		request.StickySessionType = slb.InsertStickySessionType
+		defaulted.StickySessionType = request.StickySessionType
+	}
+	if _, ok := annotation[ServiceAnnotationLoadBalancerCookieTimeout]; !ok &&
+		defaulted.StickySessionType == slb.InsertStickySessionType {
+		cookie := timeout
+		if cookie > MAX_COOKIE_TIMEOUT {
+			cookie = MAX_COOKIE_TIMEOUT
+		}
+		defaulted.CookieTimeout = cookie
+		request.CookieTimeout = defaulted.CookieTimeout
+	}
+}
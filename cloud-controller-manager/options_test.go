@@ -1,8 +1,10 @@
 package alicloud
 
 import (
+	"github.com/denverdino/aliyungo/slb"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
 	"testing"
 )
 
@@ -29,3 +31,74 @@ func TestExtractAnnotationRequest(t *testing.T) {
 	}
 
 }
+
+func TestSessionAffinityClientIP(t *testing.T) {
+	timeout := int32(600)
+	svc := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{},
+		},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityClientIP,
+			SessionAffinityConfig: &v1.SessionAffinityConfig{
+				ClientIP: &v1.ClientIPConfig{TimeoutSeconds: &timeout},
+			},
+		},
+	}
+	def, request := ExtractAnnotationRequest(&svc)
+	if request.PersistenceTimeout == nil || *def.PersistenceTimeout != 600 {
+		t.Fatal("persistence timeout should follow sessionAffinityConfig")
+	}
+	if request.StickySession != slb.OnFlag ||
+		def.StickySessionType != slb.InsertStickySessionType ||
+		request.CookieTimeout != 600 {
+		t.Fatalf("expect insert cookie sticky session, got %+v", def)
+	}
+
+	// default timeout exceeds the max persistence timeout of slb
+	svc.Spec.SessionAffinityConfig = nil
+	def, _ = ExtractAnnotationRequest(&svc)
+	if *def.PersistenceTimeout != MAX_PERSISTENCE_TIMEOUT || def.CookieTimeout != 10800 {
+		t.Fatalf("unexpected default timeout, persistence=%d, cookie=%d",
+			*def.PersistenceTimeout, def.CookieTimeout)
+	}
+
+	// annotations take precedence
+	svc.Annotations[ServiceAnnotationLoadBalancerPersistenceTimeout] = "60"
+	svc.Annotations[ServiceAnnotationLoadBalancerSessionStick] = "off"
+	def, _ = ExtractAnnotationRequest(&svc)
+	if *def.PersistenceTimeout != 60 || def.StickySession != slb.OffFlag {
+		t.Fatalf("annotation should override session affinity, got %+v", def)
+	}
+
+	// server sticky session without cookie is left off
+	delete(svc.Annotations, ServiceAnnotationLoadBalancerSessionStick)
+	svc.Annotations[ServiceAnnotationLoadBalancerSessionStickType] = string(slb.ServerStickySessionType)
+	def, _ = ExtractAnnotationRequest(&svc)
+	if def.StickySession != slb.OffFlag {
+		t.Fatalf("expect sticky session off without cookie, got %+v", def)
+	}
+	svc.Annotations[ServiceAnnotationLoadBalancerCookie] = "session"
+	def, _ = ExtractAnnotationRequest(&svc)
+	if def.StickySession != slb.OnFlag || def.Cookie != "session" {
+		t.Fatalf("expect server sticky session with cookie, got %+v", def)
+	}
+
+	// persistence not derived from ClientIP is left as is
+	svc.Annotations = map[string]string{}
+	svc.Spec.SessionAffinity = v1.ServiceAffinityNone
+	_, request = ExtractAnnotationRequest(&svc)
+	if request.PersistenceTimeout != nil {
+		t.Fatalf("expect persistence untouched, got %d", *request.PersistenceTimeout)
+	}
+
+	// ClientIP to None clears persistence and sticky session
+	svc.Annotations = map[string]string{
+		utils.ServiceAnnotationLoadBalancerResources: `{"loadBalancers":[{"loadBalancerId":"lb-1","sessionPersistence":true}]}`,
+	}
+	def, request = ExtractAnnotationRequest(&svc)
+	if request.PersistenceTimeout == nil || *def.PersistenceTimeout != 0 ||
+		request.StickySession != slb.OffFlag {
+		t.Fatalf("expect persistence and sticky session cleared, got %+v", def)
+	}
+}
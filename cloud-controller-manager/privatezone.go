@@ -3,11 +3,14 @@ package alicloud
 import (
 	"context"
 	"fmt"
+	"github.com/denverdino/aliyungo/common"
 	"github.com/denverdino/aliyungo/pvtz"
 	"github.com/denverdino/aliyungo/slb"
 	"k8s.io/api/core/v1"
 	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
 	"k8s.io/klog"
+	"sort"
+	"strings"
 )
 
 // DEFAULT_LANG default lang
@@ -30,12 +33,40 @@ type ClientPVTZSDK interface {
 	UpdateZoneRecord(ctx context.Context, args *pvtz.UpdateZoneRecordArgs) (err error)
 	DeleteZoneRecord(ctx context.Context, args *pvtz.DeleteZoneRecordArgs) (err error)
 	SetZoneRecordStatus(ctx context.Context, args *pvtz.SetZoneRecordStatusArgs) (err error)
+	UpdateZoneRecordWeight(ctx context.Context, args *UpdateZoneRecordWeightArgs) (err error)
+	DescribeZoneRecordWeights(ctx context.Context, zoneId string, rr string) (weights map[int64]int, err error)
+}
+
+// UpdateZoneRecordWeightArgs UpdateZoneRecord with the Weight parameter,
+// which is not provided by the pvtz sdk. Weighted records of the same rr are
+// resolved in proportion to their weights.
+type UpdateZoneRecordWeightArgs struct {
+	pvtz.UpdateZoneRecordArgs
+	Weight int
+}
+
+// WeightedZoneRecordType record of DescribeZoneRecords with the Weight field,
+// which is not provided by the pvtz sdk.
+type WeightedZoneRecordType struct {
+	RecordId int64
+	Rr       string
+	Weight   int
+}
+
+// DescribeWeightedZoneRecordsResponse response of DescribeZoneRecords with weights
+type DescribeWeightedZoneRecordsResponse struct {
+	common.Response
+	common.PaginationResult
+	Records struct {
+		Record []WeightedZoneRecordType
+	}
 }
 
 // PrivateZoneClient private zone client wrapper
 type PrivateZoneClient struct {
 	c ClientPVTZSDK
-	// known service resource version
+	// vpc cluster vpc, which private zones created by ccm are bound to
+	vpc pvtz.VPCType
 }
 
 func (s *PrivateZoneClient) findPrivateZone(ctx context.Context, service *v1.Service) (bool, *pvtz.DescribeZoneInfoResponse, error) {
@@ -54,6 +85,163 @@ func (s *PrivateZoneClient) findPrivateZone(ctx context.Context, service *v1.Ser
 	return false, nil, nil
 }
 
+// isPrivateZoneAutoCreate the private zone named by private-zone-name is
+// created when private-zone-auto-create annotation is on. Cluster default is
+// used when the annotation is absent.
+func isPrivateZoneAutoCreate(svc *v1.Service) bool {
+	switch strings.ToLower(serviceAnnotation(svc, ServiceAnnotationLoadBalancerPrivateZoneAutoCreate)) {
+	case string(slb.OnFlag):
+		return true
+	case string(slb.OffFlag):
+		return false
+	}
+	return cfg.Global.PrivateZoneAutoCreate
+}
+
+// privateZoneRemark remark of the private zones created by ccm
+func privateZoneRemark() string {
+	return fmt.Sprintf("created by kubernetes cluster %s", CLUSTER_ID)
+}
+
+// ensurePrivateZone find the private zone of service. The zone named by
+// private-zone-name is created when auto create is enabled, and bound to the
+// cluster vpc and the vpcs in cloud config.
+func (s *PrivateZoneClient) ensurePrivateZone(ctx context.Context, service *v1.Service) (bool, *pvtz.DescribeZoneInfoResponse, error) {
+	exists, zone, err := s.findPrivateZone(ctx, service)
+	if err != nil {
+		return false, nil, err
+	}
+	def, _ := ExtractAnnotationRequest(service)
+	if def.PrivateZoneId != "" || def.PrivateZoneName == "" || !isPrivateZoneAutoCreate(service) {
+		return exists, zone, nil
+	}
+	// zone which does not match the name exactly is not reused
+	if !exists || zone.ZoneName != def.PrivateZoneName {
+		utils.Logf(service, "create private zone %s", def.PrivateZoneName)
+		resp, err := s.c.AddZone(
+			ctx,
+			&pvtz.AddZoneArgs{
+				ZoneName: def.PrivateZoneName,
+				Lang:     DEFAULT_LANG,
+			},
+		)
+		if err != nil {
+			return false, nil, fmt.Errorf("alicloud: create private zone %s: %s", def.PrivateZoneName, err.Error())
+		}
+		err = s.c.UpdateZoneRemark(
+			ctx,
+			&pvtz.UpdateZoneRemarkArgs{
+				ZoneId: resp.ZoneId,
+				Remark: privateZoneRemark(),
+				Lang:   DEFAULT_LANG,
+			},
+		)
+		if err != nil {
+			return false, nil, fmt.Errorf("alicloud: update remark of private zone %s: %s", resp.ZoneId, err.Error())
+		}
+		exists, zone, err = s.findPrivateZoneById(ctx, resp.ZoneId)
+		if err != nil || !exists {
+			return false, nil, fmt.Errorf("alicloud: find created private zone %s: %v", resp.ZoneId, err)
+		}
+	}
+	if err := s.ensureZoneVpcs(ctx, service, zone); err != nil {
+		return false, nil, err
+	}
+	return true, zone, nil
+}
+
+// ensureZoneVpcs reconcile vpc bindings of the private zone. Zone created by
+// ccm is bound to exactly the cluster vpc and the vpcs in cloud config, vpcs
+// are only added to the zone created by user.
+func (s *PrivateZoneClient) ensureZoneVpcs(ctx context.Context, service *v1.Service, zone *pvtz.DescribeZoneInfoResponse) error {
+	desired, err := privateZoneVpcs(s.vpc, cfg.Global.PrivateZoneVpcIDs)
+	if err != nil {
+		return err
+	}
+	if len(desired) == 0 {
+		// cluster vpc is unknown, leave bindings untouched
+		return nil
+	}
+	current := zone.BindVpcs.VPC
+	if zone.Remark != privateZoneRemark() {
+		desired = append(desired, current...)
+	}
+	desired = uniqueVpcs(desired)
+	if vpcsEqual(uniqueVpcs(current), desired) {
+		return nil
+	}
+	utils.Logf(service, "bind private zone %s to vpcs %v", zone.ZoneId, desired)
+	err = s.c.BindZoneVpc(
+		ctx,
+		&pvtz.BindZoneVpcArgs{
+			ZoneId: zone.ZoneId,
+			Vpcs:   desired,
+			Lang:   DEFAULT_LANG,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("alicloud: bind private zone %s to vpcs: %s", zone.ZoneId, err.Error())
+	}
+	zone.BindVpcs.VPC = desired
+	return nil
+}
+
+// privateZoneVpcs the cluster vpc and vpcs in the format of vpcid or region:vpcid.
+// Region of the cluster is used when region is omitted.
+func privateZoneVpcs(cluster pvtz.VPCType, ids []string) ([]pvtz.VPCType, error) {
+	var vpcs []pvtz.VPCType
+	if cluster.VpcId != "" {
+		vpcs = append(vpcs, cluster)
+	}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		vpc := pvtz.VPCType{RegionId: cluster.RegionId, VpcId: id}
+		if parts := strings.Split(id, ":"); len(parts) == 2 {
+			vpc = pvtz.VPCType{RegionId: common.Region(parts[0]), VpcId: parts[1]}
+		}
+		if vpc.RegionId == "" || vpc.VpcId == "" {
+			return nil, fmt.Errorf("alicloud: invalid private zone vpc %q, expect vpcid or region:vpcid", id)
+		}
+		vpcs = append(vpcs, vpc)
+	}
+	return vpcs, nil
+}
+
+// uniqueVpcs sorted vpcs without duplication
+func uniqueVpcs(vpcs []pvtz.VPCType) []pvtz.VPCType {
+	found := make(map[pvtz.VPCType]bool)
+	var result []pvtz.VPCType
+	for _, vpc := range vpcs {
+		vpc = pvtz.VPCType{RegionId: vpc.RegionId, VpcId: vpc.VpcId}
+		if !found[vpc] {
+			found[vpc] = true
+			result = append(result, vpc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].RegionId != result[j].RegionId {
+			return result[i].RegionId < result[j].RegionId
+		}
+		return result[i].VpcId < result[j].VpcId
+	})
+	return result
+}
+
+func vpcsEqual(a, b []pvtz.VPCType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *PrivateZoneClient) findPrivateZoneById(ctx context.Context, id string) (bool, *pvtz.DescribeZoneInfoResponse, error) {
 	zone, err := s.c.DescribeZoneInfo(
 		ctx,
@@ -115,11 +303,18 @@ func (s *PrivateZoneClient) findPrivateZoneByName(ctx context.Context, name stri
 	return s.findPrivateZoneById(ctx, selectedZoneId)
 }
 
-func (s *PrivateZoneClient) findRecordByRr(ctx context.Context, zone *pvtz.DescribeZoneInfoResponse, rr string) (*pvtz.ZoneRecordType, error) {
-	records, err := s.c.DescribeZoneRecordsByRR(ctx, zone.ZoneId, rr)
+// findRecordByRr find the record of rr, records of other type are ignored unless recordType is empty.
+func (s *PrivateZoneClient) findRecordByRr(ctx context.Context, zone *pvtz.DescribeZoneInfoResponse, rr string, recordType string) (*pvtz.ZoneRecordType, error) {
+	all, err := s.c.DescribeZoneRecordsByRR(ctx, zone.ZoneId, rr)
 	if err != nil {
 		return nil, err
 	}
+	var records []pvtz.ZoneRecordType
+	for _, record := range all {
+		if recordType == "" || record.Type == recordType {
+			records = append(records, record)
+		}
+	}
 
 	switch len(records) {
 	case 0:
@@ -147,7 +342,7 @@ func (s *PrivateZoneClient) findRecordByService(ctx context.Context, service *v1
 		return nil, nil, err
 	}
 
-	record, err := s.findRecordByRr(ctx, zone, request.PrivateZoneRecordName)
+	record, err := s.findRecordByRr(ctx, zone, request.PrivateZoneRecordName, dualStackRecordType(service))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -185,7 +380,7 @@ func (s *PrivateZoneClient) updateRecordCache(ctx context.Context, service *v1.S
 	kv := GetPrivateZoneRecordCache()
 
 	var recordId int64 = -1
-	previousId, found := kv.get(string(service.GetUID()))
+	previousId, found := kv.get(recordCacheKey(service))
 
 	if record != nil {
 		recordId = record.RecordId
@@ -204,32 +399,65 @@ func (s *PrivateZoneClient) updateRecordCache(ctx context.Context, service *v1.S
 
 	// update new record id to cache or delete cache
 	if record != nil {
-		kv.set(string(service.GetUID()), recordId)
+		kv.set(recordCacheKey(service), recordId)
+		kv.setZone(string(service.UID), zone.ZoneId)
 	} else {
-		kv.remove(string(service.GetUID()))
+		kv.remove(recordCacheKey(service))
 	}
+	kv.persist(ctx, service)
 
 	return zone, record, err
 }
 
 // EnsurePrivateZoneRecord make sure private zone record is reconciled
 func (s *PrivateZoneClient) EnsurePrivateZoneRecord(ctx context.Context, service *v1.Service, ip string, ipVersion slb.AddressIPVersionType) (zone *pvtz.DescribeZoneInfoResponse, record *pvtz.ZoneRecordType, err error) {
+	return s.ensurePrivateZoneRecord(ctx, service, ip, ipVersion, nil)
+}
+
+// ReconcilePrivateZoneRecord repair the private zone records of the slb which
+// drift from the service, e.g. deleted, modified or disabled by others. The
+// drifts repaired are returned.
+func (s *PrivateZoneClient) ReconcilePrivateZoneRecord(ctx context.Context, service *v1.Service, ip string, ipVersion slb.AddressIPVersionType) ([]string, error) {
+	repairs := &recordRepairs{}
+	_, _, err := s.ensurePrivateZoneRecord(ctx, service, ip, ipVersion, repairs)
+	return repairs.drifts, err
+}
+
+func (s *PrivateZoneClient) ensurePrivateZoneRecord(ctx context.Context, service *v1.Service, ip string, ipVersion slb.AddressIPVersionType, repairs *recordRepairs) (zone *pvtz.DescribeZoneInfoResponse, record *pvtz.ZoneRecordType, err error) {
 	klog.V(4).Infof("alicloud: ensure private zone record for ip(%s) with service details, \n%+v", ip, PrettyJson(service))
 
+	if isRecordSet(service) {
+		return s.ensureRecordSet(ctx, service, ip, ipVersion, repairs)
+	}
+
 	// update record cache after ensure
 	defer func() {
 		zone, record, err = s.updateRecordCache(ctx, service, zone, record, err)
 	}()
 
 	recordType := getRecordType(ipVersion)
-	_, request := ExtractAnnotationRequest(service)
+	defaulted, request := ExtractAnnotationRequest(service)
+
+	if request.PrivateZoneRecordName != "" {
+		exists, zone, err := s.ensurePrivateZone(ctx, service)
+		if err != nil {
+			return nil, nil, err
+		}
+		// records created before the service turns from record set into single record
+		if exists {
+			err = s.deleteCachedRecords(ctx, service, zone, recordSetCachePrefix(service), nil)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
 
 	zone, record, err = s.findRecordByService(ctx, service)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// we will not create private zone, and user must to create it manually
+	// private zone is not created unless auto create is enabled
 	if zone == nil {
 		utils.Logf(service, "config or private zone not found, "+
 			"we will skip to configure private zone")
@@ -251,13 +479,18 @@ func (s *PrivateZoneClient) EnsurePrivateZoneRecord(ctx context.Context, service
 				Rr:     request.PrivateZoneRecordName,
 				Type:   recordType,
 				Value:  ip,
+				Ttl:    defaulted.PrivateZoneRecordTTL,
 			})
 		if err != nil {
 			return nil, nil, err
 		}
+		if _, found := GetPrivateZoneRecordCache().get(recordCacheKey(service)); found {
+			repairs.add("[%s.%s] %s %s: deleted, recreated",
+				request.PrivateZoneRecordName, zone.ZoneName, recordType, ip)
+		}
 
 		// ensure the record has been created
-		record, err = s.findRecordByRr(ctx, zone, request.PrivateZoneRecordName)
+		record, err = s.findRecordByRr(ctx, zone, request.PrivateZoneRecordName, dualStackRecordType(service))
 		if err != nil {
 			return nil, nil, err
 		}
@@ -265,22 +498,14 @@ func (s *PrivateZoneClient) EnsurePrivateZoneRecord(ctx context.Context, service
 		if record == nil {
 			return nil, nil, fmt.Errorf("alicloud: unknown error on creating private zone record, it shouldn't be happened. ")
 		}
-	} else if record.Type != recordType || record.Value != ip {
-		utils.Logf(service, "update private zone record [%s.%s] bind to ip [%s]",
-			request.PrivateZoneRecordName,
-			zone.ZoneName,
-			ip)
-
-		err = s.c.UpdateZoneRecord(
-			ctx,
-			&pvtz.UpdateZoneRecordArgs{
-				RecordId: record.RecordId,
-				Rr:       request.PrivateZoneRecordName,
-				Type:     recordType,
-				Value:    ip,
-				Lang:     DEFAULT_LANG,
-			})
-		if err != nil {
+	} else {
+		desired := pvtz.ZoneRecordType{
+			Rr:    request.PrivateZoneRecordName,
+			Type:  recordType,
+			Value: ip,
+			Ttl:   defaulted.PrivateZoneRecordTTL,
+		}
+		if err := s.repairRecord(ctx, service, zone, *record, desired, repairs); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -297,6 +522,27 @@ func (s *PrivateZoneClient) EnsurePrivateZoneRecordDeleted(ctx context.Context,
 			"deleted service resourceVersion, [%s] due to [%s] ", service.Name, err.Error())
 	}
 
+	if isRecordSet(service) {
+		return s.ensureRecordSetDeleted(ctx, service, ip, ipVersion)
+	}
+
+	// record created by ccm is deleted precisely by id
+	kv := GetPrivateZoneRecordCache()
+	if id, found := kv.get(recordCacheKey(service)); found {
+		_, request := ExtractAnnotationRequest(service)
+		_, zone, err := s.findPrivateZone(ctx, service)
+		if err != nil {
+			utils.Logf(service, "find private zone error: %s", err.Error())
+		}
+		utils.Logf(service, "delete private zone record %d created by cloudprovider", id)
+		if err := s.deleteRecord(ctx, zone, request.PrivateZoneRecordName, id); err != nil {
+			return err
+		}
+		kv.remove(recordCacheKey(service))
+		kv.persist(ctx, service)
+		return nil
+	}
+
 	zoneInfo, record, exactMatch, err := s.findExactRecordByService(ctx, service, ip, ipVersion)
 	if err != nil {
 		return err
@@ -311,6 +557,16 @@ func (s *PrivateZoneClient) EnsurePrivateZoneRecordDeleted(ctx context.Context,
 
 	if zoneInfo != nil && record != nil {
 		utils.Logf(service, "private zone record deleted by cloudprovider. service [%s]", service.Name)
+		if dualStackRecordType(service) != "" {
+			// A and AAAA records of dual stack service share the same rr
+			return s.c.DeleteZoneRecord(
+				ctx,
+				&pvtz.DeleteZoneRecordArgs{
+					RecordId: record.RecordId,
+					Lang:     DEFAULT_LANG,
+				},
+			)
+		}
 		return s.c.DeleteZoneRecordsByRR(ctx, zoneInfo.ZoneId, record.Rr)
 	}
 
@@ -331,3 +587,545 @@ func getRecordType(ipVersion slb.AddressIPVersionType) string {
 	}
 	return "A"
 }
+
+// dualStackRecordType A and AAAA records of dual stack service share the same rr,
+// each half of the service only sees the record of its own type.
+func dualStackRecordType(service *v1.Service) string {
+	if isDualStackIPv6(service) {
+		return getRecordType(slb.IPv6)
+	}
+	if isDualStack(service) {
+		return getRecordType(slb.IPv4)
+	}
+	return ""
+}
+
+// recordCacheKey key of the record created for the service
+func recordCacheKey(service *v1.Service) string {
+	if isDualStackIPv6(service) {
+		return string(service.GetUID()) + IPV6_NAME_SUFFIX
+	}
+	return string(service.GetUID())
+}
+
+// EnsureServiceRecords make sure records of a service which is not of
+// LoadBalancer type are published in the private zone. records are ips keyed
+// by host, host "" is the service itself, other hosts are published as
+// <host>.<record-name>. Records created before and no longer desired are deleted.
+func (s *PrivateZoneClient) EnsureServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	return s.ensureServiceRecords(ctx, service, records, nil)
+}
+
+// ReconcileServiceRecords repair the records of a service which is not of
+// LoadBalancer type which drift from the service, e.g. deleted, modified or
+// disabled by others. The drifts repaired are returned.
+func (s *PrivateZoneClient) ReconcileServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string) ([]string, error) {
+	repairs := &recordRepairs{}
+	err := s.ensureServiceRecords(ctx, service, records, repairs)
+	return repairs.drifts, err
+}
+
+func (s *PrivateZoneClient) ensureServiceRecords(ctx context.Context, service *v1.Service, records map[string][]string, repairs *recordRepairs) error {
+	defaulted, request := ExtractAnnotationRequest(service)
+	if request.PrivateZoneRecordName == "" {
+		return fmt.Errorf("alicloud: annotation %s must be specified for private zone record",
+			ServiceAnnotationLoadBalancerPrivateZoneRecordName)
+	}
+	exists, zone, err := s.ensurePrivateZone(ctx, service)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("alicloud: private zone not found, it must be specified by annotation %s or %s",
+			ServiceAnnotationLoadBalancerPrivateZoneId, ServiceAnnotationLoadBalancerPrivateZoneName)
+	}
+
+	kv := GetPrivateZoneRecordCache()
+	kv.setZone(string(service.UID), zone.ZoneId)
+	defer kv.persist(ctx, service)
+	_, err = s.ensureRecords(
+		ctx, service, zone,
+		serviceRecordCachePrefix(service),
+		serviceRecordSpecs(request.PrivateZoneRecordName, records),
+		defaulted.PrivateZoneRecordTTL,
+		defaulted.PrivateZoneRecordWeight,
+		repairs,
+	)
+	return err
+}
+
+// EnsureServiceRecordsDeleted delete the records created for a service which
+// is not of LoadBalancer type. Only the records cached for the service are
+// deleted, records of the same name created by others are kept.
+func (s *PrivateZoneClient) EnsureServiceRecordsDeleted(ctx context.Context, service *v1.Service, records map[string][]string) error {
+	_, zone, err := s.findPrivateZone(ctx, service)
+	if err != nil {
+		// cached records are deleted by id anyway
+		utils.Logf(service, "find private zone error: %s", err.Error())
+	}
+
+	kv := GetPrivateZoneRecordCache()
+	defer kv.persist(ctx, service)
+	return s.ensureRecordsDeleted(ctx, service, zone, serviceRecordCachePrefix(service))
+}
+
+// isRecordSet records of the slb are managed as a set when multiple record
+// names, CNAME or weight is specified. Records of the same name created by
+// others are kept, so that a name can be shared by several services.
+func isRecordSet(service *v1.Service) bool {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return len(privateZoneRecordNames(defaulted.PrivateZoneRecordName)) > 1 ||
+		defaulted.PrivateZoneRecordCname != "" ||
+		defaulted.PrivateZoneRecordWeight != 0
+}
+
+// recordSetSpecs records of the slb, A or AAAA records of the ip for each
+// record name, or CNAME records to the hostname when specified.
+func recordSetSpecs(service *v1.Service, ip string, ipVersion slb.AddressIPVersionType) []recordSpec {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	var specs []recordSpec
+	for _, name := range privateZoneRecordNames(defaulted.PrivateZoneRecordName) {
+		if defaulted.PrivateZoneRecordCname == "" {
+			specs = append(specs, recordSpec{rr: name, recordType: getRecordType(ipVersion), value: ip})
+			continue
+		}
+		// CNAME records are published by the ipv4 half of dual stack service
+		if !isDualStackIPv6(service) {
+			specs = append(specs, recordSpec{rr: name, recordType: "CNAME", value: defaulted.PrivateZoneRecordCname})
+		}
+	}
+	return specs
+}
+
+// ensureRecordSet make sure the record set of the slb is published. The
+// first record is returned as the record of the service.
+func (s *PrivateZoneClient) ensureRecordSet(ctx context.Context, service *v1.Service, ip string, ipVersion slb.AddressIPVersionType, repairs *recordRepairs) (*pvtz.DescribeZoneInfoResponse, *pvtz.ZoneRecordType, error) {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	exists, zone, err := s.ensurePrivateZone(ctx, service)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		utils.Logf(service, "config or private zone not found, "+
+			"we will skip to configure private zone")
+		return nil, nil, nil
+	}
+
+	kv := GetPrivateZoneRecordCache()
+	kv.setZone(string(service.UID), zone.ZoneId)
+	defer kv.persist(ctx, service)
+	records, err := s.ensureRecords(
+		ctx, service, zone,
+		recordSetCachePrefix(service),
+		recordSetSpecs(service, ip, ipVersion),
+		defaulted.PrivateZoneRecordTTL,
+		defaulted.PrivateZoneRecordWeight,
+		repairs,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	// record created before the service turns into record set
+	if id, found := kv.get(recordCacheKey(service)); found {
+		if !hasRecordId(records, id) {
+			utils.Logf(service, "delete private zone record %d created by cloudprovider", id)
+			if err := s.deleteRecord(ctx, zone, "", id); err != nil {
+				return nil, nil, err
+			}
+		}
+		kv.remove(recordCacheKey(service))
+	}
+	if len(records) == 0 {
+		return zone, nil, nil
+	}
+	return zone, &records[0], nil
+}
+
+// ensureRecordSetDeleted delete the record set of the slb
+func (s *PrivateZoneClient) ensureRecordSetDeleted(ctx context.Context, service *v1.Service, ip string, ipVersion slb.AddressIPVersionType) error {
+	_, zone, err := s.findPrivateZone(ctx, service)
+	if err != nil {
+		// cached records are deleted by id anyway
+		utils.Logf(service, "find private zone error: %s", err.Error())
+	}
+	kv := GetPrivateZoneRecordCache()
+	defer kv.persist(ctx, service)
+	if id, found := kv.get(recordCacheKey(service)); found {
+		if err := s.deleteRecord(ctx, zone, "", id); err != nil {
+			return err
+		}
+		kv.remove(recordCacheKey(service))
+	}
+	return s.ensureRecordsDeleted(ctx, service, zone, recordSetCachePrefix(service))
+}
+
+// recordSpec a record desired for the service
+type recordSpec struct {
+	rr         string
+	recordType string
+	value      string
+}
+
+// ensureRecords make sure the records are published in the zone. Ids of the
+// records are cached with the prefix, and cached records which are no longer
+// desired are deleted. Only records created for the service are adopted,
+// records of the same rr created by others are left untouched. Weight is
+// applied to the records unless it is 0. Cached records which drift are
+// repaired in place.
+func (s *PrivateZoneClient) ensureRecords(
+	ctx context.Context,
+	service *v1.Service,
+	zone *pvtz.DescribeZoneInfoResponse,
+	prefix string,
+	specs []recordSpec,
+	ttl, weight int,
+	repairs *recordRepairs,
+) ([]pvtz.ZoneRecordType, error) {
+	kv := GetPrivateZoneRecordCache()
+	desired := make(map[string]bool)
+	// records of the zone by rr
+	current := make(map[string][]pvtz.ZoneRecordType)
+	// weights of the records of the zone by rr
+	weights := make(map[string]map[int64]int)
+	// records created for the service under any key, e.g. the single record
+	// created before the service turns into record set
+	owned := kv.ids(string(service.UID))
+	var ensured []pvtz.ZoneRecordType
+	for _, spec := range specs {
+		if _, ok := current[spec.rr]; !ok {
+			records, err := s.c.DescribeZoneRecordsByRR(ctx, zone.ZoneId, spec.rr)
+			if err != nil {
+				return nil, err
+			}
+			current[spec.rr] = records
+			if weight != 0 {
+				weights[spec.rr], err = s.c.DescribeZoneRecordWeights(ctx, zone.ZoneId, spec.rr)
+				if err != nil {
+					return nil, fmt.Errorf("alicloud: describe weights of private zone records [%s.%s]: %s",
+						spec.rr, zone.ZoneName, err.Error())
+				}
+			}
+		}
+		key := recordSetCacheKey(prefix, spec)
+		desired[key] = true
+		record := pvtz.ZoneRecordType{Rr: spec.rr, Type: spec.recordType, Value: spec.value, Ttl: ttl}
+		cachedId, cached := kv.get(key)
+		if observed := findRecordById(current[spec.rr], cachedId); cached && observed != nil {
+			record.RecordId = observed.RecordId
+			if err := s.repairRecord(ctx, service, zone, *observed, record, repairs); err != nil {
+				return nil, err
+			}
+		} else if id := findRecordId(current[spec.rr], spec.recordType, spec.value); id != 0 && owned[id] {
+			record.RecordId = id
+		} else {
+			utils.Logf(service, "create private zone record [%s.%s] %s %s", spec.rr, zone.ZoneName, spec.recordType, spec.value)
+			resp, err := s.c.AddZoneRecord(
+				ctx,
+				&pvtz.AddZoneRecordArgs{
+					ZoneId: zone.ZoneId,
+					Rr:     spec.rr,
+					Type:   spec.recordType,
+					Value:  spec.value,
+					Ttl:    ttl,
+					Lang:   DEFAULT_LANG,
+				})
+			if err != nil {
+				return nil, fmt.Errorf("alicloud: add private zone record [%s.%s] %s: %s", spec.rr, zone.ZoneName, spec.value, err.Error())
+			}
+			record.RecordId = resp.RecordId
+			if cached {
+				repairs.add("[%s.%s] %s %s: deleted, recreated", spec.rr, zone.ZoneName, spec.recordType, spec.value)
+			}
+		}
+		kv.set(key, record.RecordId)
+		applied, ok := weights[spec.rr][record.RecordId]
+		if weight != 0 && (!ok || applied != weight) {
+			if err := s.updateRecordWeight(ctx, service, record, weight); err != nil {
+				return nil, err
+			}
+		}
+		ensured = append(ensured, record)
+	}
+	if err := s.deleteCachedRecords(ctx, service, zone, prefix, desired); err != nil {
+		return nil, err
+	}
+	return ensured, nil
+}
+
+// updateRecordWeight apply the weight to the record. Weight is read back
+// from the zone on each reconcile, and applied again when it drifts.
+func (s *PrivateZoneClient) updateRecordWeight(ctx context.Context, service *v1.Service, record pvtz.ZoneRecordType, weight int) error {
+	utils.Logf(service, "update weight of private zone record %d to %d", record.RecordId, weight)
+	err := s.c.UpdateZoneRecordWeight(
+		ctx,
+		&UpdateZoneRecordWeightArgs{
+			UpdateZoneRecordArgs: pvtz.UpdateZoneRecordArgs{
+				RecordId: record.RecordId,
+				Rr:       record.Rr,
+				Type:     record.Type,
+				Value:    record.Value,
+				Ttl:      record.Ttl,
+				Lang:     DEFAULT_LANG,
+			},
+			Weight: weight,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("alicloud: update weight of private zone record %d: %s", record.RecordId, err.Error())
+	}
+	return nil
+}
+
+// recordRepairs drifts of the records repaired in a reconcile
+type recordRepairs struct {
+	drifts []string
+}
+
+// add record a drift repaired, drifts are not recorded on nil repairs
+func (r *recordRepairs) add(format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.drifts = append(r.drifts, fmt.Sprintf(format, args...))
+}
+
+// repairRecord make the observed record match the desired one. Type, value
+// and ttl are updated in place, ttl is left untouched if not specified.
+// Disabled record is enabled again.
+func (s *PrivateZoneClient) repairRecord(
+	ctx context.Context,
+	service *v1.Service,
+	zone *pvtz.DescribeZoneInfoResponse,
+	observed, desired pvtz.ZoneRecordType,
+	repairs *recordRepairs,
+) error {
+	name := fmt.Sprintf("[%s.%s]", desired.Rr, zone.ZoneName)
+	ttl := desired.Ttl
+	if ttl == 0 {
+		ttl = observed.Ttl
+	}
+	if observed.Type != desired.Type || observed.Value != desired.Value || observed.Ttl != ttl {
+		utils.Logf(service, "update private zone record %s %d from %s %s ttl %d to %s %s ttl %d",
+			name, observed.RecordId, observed.Type, observed.Value, observed.Ttl, desired.Type, desired.Value, ttl)
+		err := s.c.UpdateZoneRecord(
+			ctx,
+			&pvtz.UpdateZoneRecordArgs{
+				RecordId: observed.RecordId,
+				Rr:       desired.Rr,
+				Type:     desired.Type,
+				Value:    desired.Value,
+				Ttl:      ttl,
+				Lang:     DEFAULT_LANG,
+			})
+		if err != nil {
+			return fmt.Errorf("alicloud: update private zone record %s %d: %s", name, observed.RecordId, err.Error())
+		}
+		repairs.add("%s %s %s ttl %d: restored to %s %s ttl %d",
+			name, observed.Type, observed.Value, observed.Ttl, desired.Type, desired.Value, ttl)
+	}
+	if observed.Status == pvtz.DisableStatus {
+		utils.Logf(service, "enable private zone record %s %d", name, observed.RecordId)
+		err := s.c.SetZoneRecordStatus(
+			ctx,
+			&pvtz.SetZoneRecordStatusArgs{
+				RecordId: observed.RecordId,
+				Status:   pvtz.EnableStatus,
+				Lang:     DEFAULT_LANG,
+			})
+		if err != nil {
+			return fmt.Errorf("alicloud: enable private zone record %s %d: %s", name, observed.RecordId, err.Error())
+		}
+		repairs.add("%s %s %s: disabled, enabled", name, desired.Type, desired.Value)
+	}
+	return nil
+}
+
+// ensureRecordsDeleted delete the records cached with the prefix. Records
+// which are not cached are not created for the service, and are kept.
+func (s *PrivateZoneClient) ensureRecordsDeleted(
+	ctx context.Context,
+	service *v1.Service,
+	zone *pvtz.DescribeZoneInfoResponse,
+	prefix string,
+) error {
+	return s.deleteCachedRecords(ctx, service, zone, prefix, nil)
+}
+
+// deleteCachedRecords delete the records cached with the prefix except the
+// ones to keep.
+func (s *PrivateZoneClient) deleteCachedRecords(
+	ctx context.Context,
+	service *v1.Service,
+	zone *pvtz.DescribeZoneInfoResponse,
+	prefix string,
+	keep map[string]bool,
+) error {
+	kv := GetPrivateZoneRecordCache()
+	for key, id := range kv.list(prefix) {
+		if keep[key] {
+			continue
+		}
+		utils.Logf(service, "delete private zone record %d, %s", id, key)
+		if err := s.deleteRecord(ctx, zone, recordRrOfKey(prefix, key), id); err != nil {
+			return err
+		}
+		kv.remove(key)
+	}
+	return nil
+}
+
+// deleteRecord delete a record created for service, record which has
+// already been removed from the zone is ignored. All records of the zone
+// are checked if rr is unknown.
+func (s *PrivateZoneClient) deleteRecord(ctx context.Context, zone *pvtz.DescribeZoneInfoResponse, rr string, id int64) error {
+	err := s.c.DeleteZoneRecord(
+		ctx,
+		&pvtz.DeleteZoneRecordArgs{
+			RecordId: id,
+			Lang:     DEFAULT_LANG,
+		},
+	)
+	if err == nil {
+		return nil
+	}
+	if zone != nil {
+		var records []pvtz.ZoneRecordType
+		var lerr error
+		if rr == "" {
+			records, lerr = s.c.DescribeZoneRecords(
+				ctx,
+				&pvtz.DescribeZoneRecordsArgs{
+					ZoneId: zone.ZoneId,
+					Lang:   DEFAULT_LANG,
+				},
+			)
+		} else {
+			records, lerr = s.c.DescribeZoneRecordsByRR(ctx, zone.ZoneId, rr)
+		}
+		if lerr == nil && !hasRecordId(records, id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("alicloud: delete private zone record %d: %s", id, err.Error())
+}
+
+// collectRecordGarbage delete the cached records of services which are not
+// alive. Record which has already been removed from its zone is ignored.
+func (s *PrivateZoneClient) collectRecordGarbage(ctx context.Context, entries map[string]int64, alive map[string]bool) error {
+	kv := GetPrivateZoneRecordCache()
+	collected := make(map[string]bool)
+	var errs []string
+	for key, id := range entries {
+		uid := recordCacheUID(key)
+		if alive[uid] {
+			continue
+		}
+		klog.Infof("alicloud: collect private zone record %d of deleted service %s", id, uid)
+		var zone *pvtz.DescribeZoneInfoResponse
+		if zoneId := kv.zone(uid); zoneId != "" {
+			zone = &pvtz.DescribeZoneInfoResponse{ZoneId: zoneId}
+		}
+		if err := s.deleteRecord(ctx, zone, "", id); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		kv.remove(key)
+		collected[uid] = true
+	}
+	// records of deleted services are only kept in memory
+	for uid := range collected {
+		kv.removeZone(uid)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("alicloud: collect private zone records: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func hasRecordId(records []pvtz.ZoneRecordType, id int64) bool {
+	for _, record := range records {
+		if record.RecordId == id {
+			return true
+		}
+	}
+	return false
+}
+
+func findRecordById(records []pvtz.ZoneRecordType, id int64) *pvtz.ZoneRecordType {
+	for i := range records {
+		if records[i].RecordId == id {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+func findRecordId(records []pvtz.ZoneRecordType, recordType, value string) int64 {
+	for _, record := range records {
+		if record.Type == recordType && record.Value == value {
+			return record.RecordId
+		}
+	}
+	return 0
+}
+
+func getRecordTypeOfIP(ip string) string {
+	if strings.Contains(ip, ":") {
+		return getRecordType(slb.IPv6)
+	}
+	return getRecordType(slb.IPv4)
+}
+
+// privateZoneRecordNames record names separated by comma
+func privateZoneRecordNames(name string) []string {
+	var names []string
+	for _, n := range strings.Split(name, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// serviceRecordRr rr of a host of the service
+func serviceRecordRr(name, host string) string {
+	if host == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", host, name)
+}
+
+// serviceRecordSpecs records of a service which is not of LoadBalancer type
+// for each record name, see EnsureServiceRecords
+func serviceRecordSpecs(name string, records map[string][]string) []recordSpec {
+	var specs []recordSpec
+	for _, n := range privateZoneRecordNames(name) {
+		for host, ips := range records {
+			for _, ip := range ips {
+				specs = append(specs, recordSpec{rr: serviceRecordRr(n, host), recordType: getRecordTypeOfIP(ip), value: ip})
+			}
+		}
+	}
+	return specs
+}
+
+// serviceRecordCachePrefix prefix of the keys of records created for a
+// service which is not of LoadBalancer type.
+func serviceRecordCachePrefix(service *v1.Service) string {
+	return string(service.GetUID()) + "/"
+}
+
+// recordSetCachePrefix prefix of the keys of the record set of slb, each half
+// of dual stack service has its own records.
+func recordSetCachePrefix(service *v1.Service) string {
+	return recordCacheKey(service) + "/"
+}
+
+// recordRrOfKey rr of the record cache key, see recordSetCacheKey
+func recordRrOfKey(prefix, key string) string {
+	return strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+}
+
+func recordSetCacheKey(prefix string, spec recordSpec) string {
+	return fmt.Sprintf("%s%s/%s/%s", prefix, spec.rr, spec.recordType, spec.value)
+}
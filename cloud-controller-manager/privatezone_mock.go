@@ -0,0 +1,256 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	"github.com/denverdino/aliyungo/pvtz"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mockClientPVTZ private zone sdk backed by an in memory store
+type mockClientPVTZ struct {
+	lock    sync.Mutex
+	nextId  int64
+	zones   map[string]*pvtz.DescribeZoneInfoResponse
+	records map[string][]pvtz.ZoneRecordType
+	weights map[int64]int
+
+	addZoneRecord    func(args *pvtz.AddZoneRecordArgs) (*pvtz.AddZoneRecordResponse, error)
+	deleteZoneRecord func(args *pvtz.DeleteZoneRecordArgs) error
+}
+
+func newMockClientPVTZ(zones ...pvtz.DescribeZoneInfoResponse) *mockClientPVTZ {
+	c := &mockClientPVTZ{
+		nextId:  1000,
+		zones:   make(map[string]*pvtz.DescribeZoneInfoResponse),
+		records: make(map[string][]pvtz.ZoneRecordType),
+		weights: make(map[int64]int),
+	}
+	for i := range zones {
+		zone := zones[i]
+		c.zones[zone.ZoneId] = &zone
+	}
+	return c
+}
+
+// allRecords records of the zone sorted by rr, type and value
+func (c *mockClientPVTZ) allRecords(zoneId string) []pvtz.ZoneRecordType {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	records := append([]pvtz.ZoneRecordType{}, c.records[zoneId]...)
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Rr != b.Rr {
+			return a.Rr < b.Rr
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+	return records
+}
+
+func (c *mockClientPVTZ) DescribeZones(ctx context.Context, args *pvtz.DescribeZonesArgs) (zones []pvtz.ZoneType, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, zone := range c.zones {
+		if strings.Contains(zone.ZoneName, args.Keyword) {
+			zones = append(zones, pvtz.ZoneType{ZoneId: zone.ZoneId, ZoneName: zone.ZoneName})
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ZoneId < zones[j].ZoneId })
+	return zones, nil
+}
+
+func (c *mockClientPVTZ) AddZone(ctx context.Context, args *pvtz.AddZoneArgs) (response *pvtz.AddZoneResponse, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.nextId++
+	id := fmt.Sprintf("zone-%d", c.nextId)
+	c.zones[id] = &pvtz.DescribeZoneInfoResponse{ZoneId: id, ZoneName: args.ZoneName}
+	return &pvtz.AddZoneResponse{Success: true, ZoneId: id, ZoneName: args.ZoneName}, nil
+}
+
+func (c *mockClientPVTZ) DeleteZone(ctx context.Context, args *pvtz.DeleteZoneArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.zones, args.ZoneId)
+	delete(c.records, args.ZoneId)
+	return nil
+}
+
+func (c *mockClientPVTZ) CheckZoneName(ctx context.Context, args *pvtz.CheckZoneNameArgs) (bool, error) {
+	return true, nil
+}
+
+func (c *mockClientPVTZ) UpdateZoneRemark(ctx context.Context, args *pvtz.UpdateZoneRemarkArgs) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zone, ok := c.zones[args.ZoneId]
+	if !ok {
+		return fmt.Errorf("Zone.Invalid.Id: zone %s not found", args.ZoneId)
+	}
+	zone.Remark = args.Remark
+	return nil
+}
+
+func (c *mockClientPVTZ) DescribeZoneInfo(ctx context.Context, args *pvtz.DescribeZoneInfoArgs) (response *pvtz.DescribeZoneInfoResponse, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zone, ok := c.zones[args.ZoneId]
+	if !ok {
+		return nil, fmt.Errorf("Zone.Invalid.Id: zone %s not found", args.ZoneId)
+	}
+	info := *zone
+	return &info, nil
+}
+
+func (c *mockClientPVTZ) BindZoneVpc(ctx context.Context, args *pvtz.BindZoneVpcArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zone, ok := c.zones[args.ZoneId]
+	if !ok {
+		return fmt.Errorf("Zone.Invalid.Id: zone %s not found", args.ZoneId)
+	}
+	zone.BindVpcs.VPC = append([]pvtz.VPCType{}, args.Vpcs...)
+	return nil
+}
+
+func (c *mockClientPVTZ) DescribeRegions(ctx context.Context) (regions []pvtz.RegionType, err error) {
+	return []pvtz.RegionType{{RegionId: REGION}}, nil
+}
+
+func (c *mockClientPVTZ) DescribeZoneRecords(ctx context.Context, args *pvtz.DescribeZoneRecordsArgs) (records []pvtz.ZoneRecordType, err error) {
+	for _, record := range c.allRecords(args.ZoneId) {
+		if strings.Contains(record.Rr, args.Keyword) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (c *mockClientPVTZ) DescribeZoneRecordsByRR(ctx context.Context, zoneId string, rr string) (records []pvtz.ZoneRecordType, err error) {
+	for _, record := range c.allRecords(zoneId) {
+		if record.Rr == rr {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (c *mockClientPVTZ) DeleteZoneRecordsByRR(ctx context.Context, zoneId string, rr string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var records []pvtz.ZoneRecordType
+	for _, record := range c.records[zoneId] {
+		if record.Rr != rr {
+			records = append(records, record)
+		}
+	}
+	c.records[zoneId] = records
+	return nil
+}
+
+func (c *mockClientPVTZ) AddZoneRecord(ctx context.Context, args *pvtz.AddZoneRecordArgs) (response *pvtz.AddZoneRecordResponse, err error) {
+	if c.addZoneRecord != nil {
+		return c.addZoneRecord(args)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.zones[args.ZoneId]; !ok {
+		return nil, fmt.Errorf("Zone.Invalid.Id: zone %s not found", args.ZoneId)
+	}
+	for _, record := range c.records[args.ZoneId] {
+		if record.Rr == args.Rr && record.Type == args.Type && record.Value == args.Value {
+			return nil, fmt.Errorf("Record.Invalid.Conflict: record [%s] %s %s exists", args.Rr, args.Type, args.Value)
+		}
+	}
+	c.nextId++
+	c.records[args.ZoneId] = append(c.records[args.ZoneId],
+		pvtz.ZoneRecordType{
+			RecordId: c.nextId,
+			Rr:       args.Rr,
+			Type:     args.Type,
+			Value:    args.Value,
+			Ttl:      args.Ttl,
+			Priority: args.Priority,
+			Status:   pvtz.EnableStatus,
+		})
+	return &pvtz.AddZoneRecordResponse{Success: true, RecordId: c.nextId}, nil
+}
+
+// record find the record by id, lock must be held by caller
+func (c *mockClientPVTZ) record(id int64) (string, int, bool) {
+	for zoneId, records := range c.records {
+		for i, record := range records {
+			if record.RecordId == id {
+				return zoneId, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+func (c *mockClientPVTZ) UpdateZoneRecord(ctx context.Context, args *pvtz.UpdateZoneRecordArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zoneId, i, ok := c.record(args.RecordId)
+	if !ok {
+		return fmt.Errorf("Record.Invalid.Id: record %d not found", args.RecordId)
+	}
+	record := &c.records[zoneId][i]
+	record.Rr, record.Type, record.Value = args.Rr, args.Type, args.Value
+	record.Ttl, record.Priority = args.Ttl, args.Priority
+	return nil
+}
+
+func (c *mockClientPVTZ) DeleteZoneRecord(ctx context.Context, args *pvtz.DeleteZoneRecordArgs) (err error) {
+	if c.deleteZoneRecord != nil {
+		return c.deleteZoneRecord(args)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zoneId, i, ok := c.record(args.RecordId)
+	if !ok {
+		return fmt.Errorf("Record.Invalid.Id: record %d not found", args.RecordId)
+	}
+	records := c.records[zoneId]
+	c.records[zoneId] = append(records[:i:i], records[i+1:]...)
+	return nil
+}
+
+func (c *mockClientPVTZ) SetZoneRecordStatus(ctx context.Context, args *pvtz.SetZoneRecordStatusArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zoneId, i, ok := c.record(args.RecordId)
+	if !ok {
+		return fmt.Errorf("Record.Invalid.Id: record %d not found", args.RecordId)
+	}
+	c.records[zoneId][i].Status = args.Status
+	return nil
+}
+
+func (c *mockClientPVTZ) DescribeZoneRecordWeights(ctx context.Context, zoneId string, rr string) (weights map[int64]int, err error) {
+	weights = make(map[int64]int)
+	for _, record := range c.allRecords(zoneId) {
+		if record.Rr == rr {
+			c.lock.Lock()
+			weights[record.RecordId] = c.weights[record.RecordId]
+			c.lock.Unlock()
+		}
+	}
+	return weights, nil
+}
+
+func (c *mockClientPVTZ) UpdateZoneRecordWeight(ctx context.Context, args *UpdateZoneRecordWeightArgs) (err error) {
+	if err := c.UpdateZoneRecord(ctx, &args.UpdateZoneRecordArgs); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.weights[args.RecordId] = args.Weight
+	return nil
+}
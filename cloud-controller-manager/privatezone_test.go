@@ -0,0 +1,524 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/pvtz"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"strings"
+	"testing"
+)
+
+func recordsString(records []pvtz.ZoneRecordType) string {
+	var result []string
+	for _, record := range records {
+		result = append(result, fmt.Sprintf("%s %s %s", record.Rr, record.Type, record.Value))
+	}
+	return strings.Join(result, ",")
+}
+
+func TestEnsureServiceRecords(t *testing.T) {
+	mock := newMockClientPVTZ(pvtz.DescribeZoneInfoResponse{ZoneId: "zone-1", ZoneName: "example.com"})
+	client := &PrivateZoneClient{c: mock}
+	ctx := context.Background()
+	// record managed by user
+	_, _ = mock.AddZoneRecord(ctx, &pvtz.AddZoneRecordArgs{ZoneId: "zone-1", Rr: "web", Type: "A", Value: "10.0.0.9"})
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			UID:       types.UID("uid-pvtz-records"),
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerPrivateZoneId:         "zone-1",
+				ServiceAnnotationLoadBalancerPrivateZoneRecordName: "web",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeClusterIP,
+			ClusterIP: v1.ClusterIPNone,
+		},
+	}
+	records := map[string][]string{
+		"":      {"10.0.0.1", "10.0.0.2", "fd00::1"},
+		"web-0": {"10.0.0.1"},
+		"web-1": {"10.0.0.2"},
+	}
+	if err := client.EnsureServiceRecords(ctx, svc, records); err != nil {
+		t.Fatalf("ensure service records: %s", err.Error())
+	}
+	expect := "web A 10.0.0.1,web A 10.0.0.2,web A 10.0.0.9,web AAAA fd00::1,web-0.web A 10.0.0.1,web-1.web A 10.0.0.2"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+
+	// scale down, records of removed pod are deleted
+	records = map[string][]string{
+		"":      {"10.0.0.1"},
+		"web-0": {"10.0.0.1"},
+	}
+	if err := client.EnsureServiceRecords(ctx, svc, records); err != nil {
+		t.Fatalf("ensure service records: %s", err.Error())
+	}
+	expect = "web A 10.0.0.1,web A 10.0.0.9,web-0.web A 10.0.0.1"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+
+	// record removed out of band is ignored on deletion
+	for _, record := range mock.allRecords("zone-1") {
+		if record.Rr == "web-0.web" {
+			_ = mock.DeleteZoneRecord(ctx, &pvtz.DeleteZoneRecordArgs{RecordId: record.RecordId})
+		}
+	}
+	if err := client.EnsureServiceRecordsDeleted(ctx, svc, nil); err != nil {
+		t.Fatalf("delete service records: %s", err.Error())
+	}
+	expect = "web A 10.0.0.9"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if len(GetPrivateZoneRecordCache().list(serviceRecordCachePrefix(svc))) != 0 {
+		t.Fatal("expect record cache of service removed")
+	}
+
+	// records which are not cached for the service are neither adopted nor
+	// deleted, even with the same value
+	_, _ = mock.AddZoneRecord(ctx, &pvtz.AddZoneRecordArgs{ZoneId: "zone-1", Rr: "web", Type: "A", Value: "172.16.0.10"})
+	if err := client.EnsureServiceRecordsDeleted(ctx, svc, map[string][]string{"": {"172.16.0.10"}}); err != nil {
+		t.Fatalf("delete service records: %s", err.Error())
+	}
+	expect = "web A 10.0.0.9,web A 172.16.0.10"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if err := client.EnsureServiceRecords(ctx, svc, map[string][]string{"": {"172.16.0.10"}}); err == nil {
+		t.Fatal("expect record of others not adopted")
+	}
+	if len(GetPrivateZoneRecordCache().list(serviceRecordCachePrefix(svc))) != 0 {
+		t.Fatal("expect record of others not cached")
+	}
+}
+
+func TestEnsurePrivateZone(t *testing.T) {
+	origin := cfg.Global.PrivateZoneVpcIDs
+	defer func() { cfg.Global.PrivateZoneVpcIDs = origin }()
+	cfg.Global.PrivateZoneVpcIDs = []string{"vpc-extra", "cn-beijing:vpc-remote"}
+
+	mock := newMockClientPVTZ(pvtz.DescribeZoneInfoResponse{ZoneId: "zone-user", ZoneName: "user.example.com"})
+	mock.zones["zone-user"].BindVpcs.VPC = []pvtz.VPCType{{RegionId: "cn-shanghai", VpcId: "vpc-user"}}
+	cluster := pvtz.VPCType{RegionId: "cn-hangzhou", VpcId: "vpc-cluster"}
+	client := &PrivateZoneClient{c: mock, vpc: cluster}
+	ctx := context.Background()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			UID:       types.UID("uid-pvtz-auto-create"),
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerPrivateZoneName:       "example.com",
+				ServiceAnnotationLoadBalancerPrivateZoneRecordName: "web",
+				ServiceAnnotationLoadBalancerPrivateZoneAutoCreate: "on",
+			},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "172.16.0.10"},
+	}
+	vpcsString := func(zone *pvtz.DescribeZoneInfoResponse) string {
+		var result []string
+		for _, vpc := range uniqueVpcs(zone.BindVpcs.VPC) {
+			result = append(result, fmt.Sprintf("%s:%s", vpc.RegionId, vpc.VpcId))
+		}
+		return strings.Join(result, ",")
+	}
+
+	// zone which does not match the name exactly is not reused
+	exists, zone, err := client.ensurePrivateZone(ctx, svc)
+	if err != nil || !exists {
+		t.Fatalf("ensure private zone: %v", err)
+	}
+	if zone.ZoneId == "zone-user" || zone.ZoneName != "example.com" || zone.Remark != privateZoneRemark() {
+		t.Fatalf("expect private zone created, got %+v", zone)
+	}
+	expect := "cn-beijing:vpc-remote,cn-hangzhou:vpc-cluster,cn-hangzhou:vpc-extra"
+	if got := vpcsString(mock.zones[zone.ZoneId]); got != expect {
+		t.Fatalf("expect vpcs %s, got %s", expect, got)
+	}
+
+	// created zone is reused, and its bindings follow cloud config
+	cfg.Global.PrivateZoneVpcIDs = []string{"vpc-extra"}
+	_, again, err := client.ensurePrivateZone(ctx, svc)
+	if err != nil || again.ZoneId != zone.ZoneId {
+		t.Fatalf("expect private zone %s reused, got %+v, %v", zone.ZoneId, again, err)
+	}
+	expect = "cn-hangzhou:vpc-cluster,cn-hangzhou:vpc-extra"
+	if got := vpcsString(mock.zones[zone.ZoneId]); got != expect {
+		t.Fatalf("expect vpcs %s, got %s", expect, got)
+	}
+
+	// vpcs are only added to zone created by user
+	svc.Annotations[ServiceAnnotationLoadBalancerPrivateZoneName] = "user.example.com"
+	if _, _, err := client.ensurePrivateZone(ctx, svc); err != nil {
+		t.Fatalf("ensure private zone: %s", err.Error())
+	}
+	expect = "cn-hangzhou:vpc-cluster,cn-hangzhou:vpc-extra,cn-shanghai:vpc-user"
+	if got := vpcsString(mock.zones["zone-user"]); got != expect {
+		t.Fatalf("expect vpcs %s, got %s", expect, got)
+	}
+
+	// nothing is created when auto create is off
+	svc.Annotations[ServiceAnnotationLoadBalancerPrivateZoneName] = "other.example.com"
+	svc.Annotations[ServiceAnnotationLoadBalancerPrivateZoneAutoCreate] = "off"
+	if exists, _, err := client.ensurePrivateZone(ctx, svc); err != nil || exists {
+		t.Fatalf("expect private zone not created, got %v, %v", exists, err)
+	}
+	if _, err := privateZoneVpcs(cluster, []string{"cn-hangzhou:"}); err == nil {
+		t.Fatal("expect invalid vpc rejected")
+	}
+}
+
+func TestPersistPrivateZoneRecords(t *testing.T) {
+	defer InitCache()
+	mock := newMockClientPVTZ(pvtz.DescribeZoneInfoResponse{ZoneId: "zone-1", ZoneName: "example.com"})
+	client := &PrivateZoneClient{c: mock}
+	ctx := context.Background()
+
+	newService := func(name string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID("uid-" + name),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerPrivateZoneId:         "zone-1",
+					ServiceAnnotationLoadBalancerPrivateZoneRecordName: name,
+				},
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: v1.ClusterIPNone},
+		}
+	}
+	alive, deleted := newService("alive"), newService("deleted")
+	kube := fake.NewSimpleClientset(alive, deleted)
+	if err := GetPrivateZoneRecordCache().restore(ctx, newServiceRecordBackend(kube)); err != nil {
+		t.Fatalf("restore records: %s", err.Error())
+	}
+	for _, svc := range []*v1.Service{alive, deleted} {
+		records := map[string][]string{"": {"10.0.0.1"}, "pod-0": {"10.0.0.1"}}
+		if err := client.EnsureServiceRecords(ctx, svc, records); err != nil {
+			t.Fatalf("ensure service records: %s", err.Error())
+		}
+	}
+	persisted := func(svc *v1.Service) *persistedRecords {
+		latest, err := kube.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service: %s", err.Error())
+		}
+		data, ok := latest.Annotations[utils.ServiceAnnotationPrivateZoneRecords]
+		if !ok {
+			return nil
+		}
+		records := &persistedRecords{}
+		if err := json.Unmarshal([]byte(data), records); err != nil {
+			t.Fatalf("unmarshal records: %s", err.Error())
+		}
+		return records
+	}
+	for _, svc := range []*v1.Service{alive, deleted} {
+		if records := persisted(svc); records == nil || len(records.Records) != 2 || records.ZoneId != "zone-1" {
+			t.Fatalf("expect records of %s persisted on the service, got %+v", svc.Name, records)
+		}
+	}
+
+	// records are restored after restart
+	InitCache()
+	kv := GetPrivateZoneRecordCache()
+	if err := kv.restore(ctx, newServiceRecordBackend(kube)); err != nil {
+		t.Fatalf("restore records: %s", err.Error())
+	}
+	if len(kv.list(serviceRecordCachePrefix(deleted))) != 2 || kv.zone("uid-deleted") != "zone-1" {
+		t.Fatalf("expect records restored, got %v", kv.list(""))
+	}
+
+	// records of deleted service are collected, record which has already
+	// been removed is ignored
+	if err := kube.CoreV1().Services(deleted.Namespace).Delete(ctx, deleted.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete service: %s", err.Error())
+	}
+	for _, record := range mock.allRecords("zone-1") {
+		if record.Rr == "pod-0.deleted" {
+			_ = mock.DeleteZoneRecord(ctx, &pvtz.DeleteZoneRecordArgs{RecordId: record.RecordId})
+		}
+	}
+	err := client.collectRecordGarbage(ctx, kv.list(""), map[string]bool{string(alive.UID): true})
+	if err != nil {
+		t.Fatalf("collect records: %s", err.Error())
+	}
+	expect := "alive A 10.0.0.1,pod-0.alive A 10.0.0.1"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if len(kv.list(serviceRecordCachePrefix(deleted))) != 0 || kv.zone("uid-deleted") != "" {
+		t.Fatalf("expect records of deleted service removed, got %v", kv.list(""))
+	}
+
+	// records are updated by the restored ids
+	if err := client.EnsureServiceRecords(ctx, alive, map[string][]string{"": {"10.0.0.1"}}); err != nil {
+		t.Fatalf("ensure service records: %s", err.Error())
+	}
+	expect = "alive A 10.0.0.1"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if records := persisted(alive); records == nil || len(records.Records) != 1 {
+		t.Fatalf("expect one record persisted, got %+v", records)
+	}
+
+	// annotation is removed with the records
+	if err := client.EnsureServiceRecordsDeleted(ctx, alive, map[string][]string{"": {"10.0.0.1"}}); err != nil {
+		t.Fatalf("delete service records: %s", err.Error())
+	}
+	if records := persisted(alive); records != nil {
+		t.Fatalf("expect records annotation removed, got %+v", records)
+	}
+}
+
+func TestEnsureRecordSet(t *testing.T) {
+	mock := newMockClientPVTZ(pvtz.DescribeZoneInfoResponse{ZoneId: "zone-1", ZoneName: "example.com"})
+	client := &PrivateZoneClient{c: mock}
+	ctx := context.Background()
+
+	newService := func(name, records string, weight string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID("uid-record-set-" + name),
+				Annotations: map[string]string{
+					ServiceAnnotationLoadBalancerPrivateZoneId:           "zone-1",
+					ServiceAnnotationLoadBalancerPrivateZoneRecordName:   records,
+					ServiceAnnotationLoadBalancerPrivateZoneRecordWeight: weight,
+				},
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		}
+	}
+	weightOf := func(rr, value string) int {
+		for _, record := range mock.allRecords("zone-1") {
+			if record.Rr == rr && record.Value == value {
+				return mock.weights[record.RecordId]
+			}
+		}
+		return -1
+	}
+
+	// blue and green share the record name with weights
+	blue := newService("blue", "web,www", "80")
+	green := newService("green", "web", "20")
+	if _, _, err := client.EnsurePrivateZoneRecord(ctx, blue, "10.0.0.1", slb.IPv4); err != nil {
+		t.Fatalf("ensure records of blue: %s", err.Error())
+	}
+	zone, record, err := client.EnsurePrivateZoneRecord(ctx, green, "10.0.0.2", slb.IPv4)
+	if err != nil {
+		t.Fatalf("ensure records of green: %s", err.Error())
+	}
+	if getHostName(zone, record) != "web.example.com" {
+		t.Fatalf("unexpected hostname %s", getHostName(zone, record))
+	}
+	expect := "web A 10.0.0.1,web A 10.0.0.2,www A 10.0.0.1"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if weightOf("web", "10.0.0.1") != 80 || weightOf("www", "10.0.0.1") != 80 || weightOf("web", "10.0.0.2") != 20 {
+		t.Fatalf("unexpected weights %v", mock.weights)
+	}
+
+	// traffic is shifted by updating the weights
+	blue.Annotations[ServiceAnnotationLoadBalancerPrivateZoneRecordWeight] = "50"
+	if _, _, err := client.EnsurePrivateZoneRecord(ctx, blue, "10.0.0.1", slb.IPv4); err != nil {
+		t.Fatalf("ensure records of blue: %s", err.Error())
+	}
+	if weightOf("web", "10.0.0.1") != 50 || weightOf("web", "10.0.0.2") != 20 {
+		t.Fatalf("unexpected weights %v", mock.weights)
+	}
+
+	// weight is read back from the zone, drift is repaired and unchanged
+	// weight is not updated again
+	for _, record := range mock.allRecords("zone-1") {
+		if record.Rr == "web" && record.Value == "10.0.0.1" {
+			mock.weights[record.RecordId] = 1
+		}
+	}
+	counted := &countedClientPVTZ{mockClientPVTZ: mock}
+	if _, _, err := (&PrivateZoneClient{c: counted}).EnsurePrivateZoneRecord(ctx, blue, "10.0.0.1", slb.IPv4); err != nil {
+		t.Fatalf("ensure records of blue: %s", err.Error())
+	}
+	if weightOf("web", "10.0.0.1") != 50 || counted.updates != 1 {
+		t.Fatalf("expect drifted weight repaired by 1 update, got %v after %d updates", mock.weights, counted.updates)
+	}
+
+	// CNAME records replace the A records
+	delete(blue.Annotations, ServiceAnnotationLoadBalancerPrivateZoneRecordWeight)
+	blue.Annotations[ServiceAnnotationLoadBalancerPrivateZoneRecordName] = "www"
+	blue.Annotations[ServiceAnnotationLoadBalancerPrivateZoneRecordCname] = "blue.example.net"
+	if _, _, err := client.EnsurePrivateZoneRecord(ctx, blue, "10.0.0.1", slb.IPv4); err != nil {
+		t.Fatalf("ensure records of blue: %s", err.Error())
+	}
+	expect = "web A 10.0.0.2,www CNAME blue.example.net"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+
+	// records shared with other services are kept on deletion
+	if err := client.EnsurePrivateZoneRecordDeleted(ctx, blue, "10.0.0.1", slb.IPv4); err != nil {
+		t.Fatalf("delete records of blue: %s", err.Error())
+	}
+	expect = "web A 10.0.0.2"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+
+	// single record is reused when the service turns into record set
+	api := newService("api", "api", "")
+	delete(api.Annotations, ServiceAnnotationLoadBalancerPrivateZoneRecordWeight)
+	if _, _, err := client.EnsurePrivateZoneRecord(ctx, api, "10.0.0.3", slb.IPv4); err != nil {
+		t.Fatalf("ensure record of api: %s", err.Error())
+	}
+	api.Annotations[ServiceAnnotationLoadBalancerPrivateZoneRecordName] = "api,api-internal"
+	if _, _, err := client.EnsurePrivateZoneRecord(ctx, api, "10.0.0.3", slb.IPv4); err != nil {
+		t.Fatalf("ensure records of api: %s", err.Error())
+	}
+	expect = "api A 10.0.0.3,api-internal A 10.0.0.3,web A 10.0.0.2"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+	if _, found := GetPrivateZoneRecordCache().get(recordCacheKey(api)); found {
+		t.Fatal("expect single record cache removed")
+	}
+}
+
+// countedClientPVTZ count the weight updates
+type countedClientPVTZ struct {
+	*mockClientPVTZ
+	updates int
+}
+
+func (c *countedClientPVTZ) UpdateZoneRecordWeight(ctx context.Context, args *UpdateZoneRecordWeightArgs) error {
+	c.updates++
+	return c.mockClientPVTZ.UpdateZoneRecordWeight(ctx, args)
+}
+
+func TestReconcilePrivateZoneRecords(t *testing.T) {
+	mock := newMockClientPVTZ(pvtz.DescribeZoneInfoResponse{ZoneId: "zone-1", ZoneName: "example.com"})
+	client := &PrivateZoneClient{c: mock}
+	ctx := context.Background()
+	newService := func(name string, annotations map[string]string) *v1.Service {
+		annotations[ServiceAnnotationLoadBalancerPrivateZoneId] = "zone-1"
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				UID:         types.UID("uid-reconcile-" + name),
+				Annotations: annotations,
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		}
+	}
+	recordOf := func(rr string) pvtz.ZoneRecordType {
+		for _, record := range mock.allRecords("zone-1") {
+			if record.Rr == rr {
+				return record
+			}
+		}
+		return pvtz.ZoneRecordType{}
+	}
+	modify := func(rr string, modify func(record *pvtz.ZoneRecordType)) {
+		mock.lock.Lock()
+		defer mock.lock.Unlock()
+		for i := range mock.records["zone-1"] {
+			if mock.records["zone-1"][i].Rr == rr {
+				modify(&mock.records["zone-1"][i])
+			}
+		}
+	}
+
+	single := newService("single", map[string]string{
+		ServiceAnnotationLoadBalancerPrivateZoneRecordName: "single",
+		ServiceAnnotationLoadBalancerPrivateZoneRecordTTL:  "30",
+	})
+	set := newService("set", map[string]string{
+		ServiceAnnotationLoadBalancerPrivateZoneRecordName: "set,www",
+	})
+	for _, svc := range []*v1.Service{single, set} {
+		if _, _, err := client.EnsurePrivateZoneRecord(ctx, svc, "10.0.0.1", slb.IPv4); err != nil {
+			t.Fatalf("ensure records of %s: %s", svc.Name, err.Error())
+		}
+	}
+	drifts, err := client.ReconcilePrivateZoneRecord(ctx, single, "10.0.0.1", slb.IPv4)
+	if err != nil || len(drifts) != 0 {
+		t.Fatalf("expect no drift, got %v, %v", drifts, err)
+	}
+
+	// value and ttl modified, record disabled
+	modify("single", func(record *pvtz.ZoneRecordType) {
+		record.Value, record.Ttl, record.Status = "10.0.0.9", 600, pvtz.DisableStatus
+	})
+	drifts, err = client.ReconcilePrivateZoneRecord(ctx, single, "10.0.0.1", slb.IPv4)
+	if err != nil {
+		t.Fatalf("reconcile records of single: %s", err.Error())
+	}
+	if len(drifts) != 2 {
+		t.Fatalf("expect value and status repaired, got %v", drifts)
+	}
+	if r := recordOf("single"); r.Value != "10.0.0.1" || r.Ttl != 30 || r.Status != pvtz.EnableStatus {
+		t.Fatalf("unexpected record after repair %+v", r)
+	}
+
+	// record of the set modified and deleted
+	id := recordOf("www").RecordId
+	modify("set", func(record *pvtz.ZoneRecordType) { record.Value = "10.0.0.9" })
+	if err := mock.DeleteZoneRecord(ctx, &pvtz.DeleteZoneRecordArgs{RecordId: id}); err != nil {
+		t.Fatalf("delete record: %s", err.Error())
+	}
+	drifts, err = client.ReconcilePrivateZoneRecord(ctx, set, "10.0.0.1", slb.IPv4)
+	if err != nil {
+		t.Fatalf("reconcile records of set: %s", err.Error())
+	}
+	if len(drifts) != 2 || !strings.Contains(strings.Join(drifts, ";"), "deleted, recreated") {
+		t.Fatalf("expect modified and deleted records repaired, got %v", drifts)
+	}
+	expect := "set A 10.0.0.1,single A 10.0.0.1,www A 10.0.0.1"
+	if got := recordsString(mock.allRecords("zone-1")); got != expect {
+		t.Fatalf("expect records %s, got %s", expect, got)
+	}
+}
+
+func TestReconcileLoadBalancerRecordsOfChangedService(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "changed",
+			Namespace:       "default",
+			UID:             "uid-changed",
+			ResourceVersion: "2",
+			Annotations:     map[string]string{ServiceAnnotationLoadBalancerPrivateZoneRecordName: "changed"},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	// records are left to the running sync, regional clients are never touched
+	cloud := &Cloud{kclient: fake.NewSimpleClientset(svc)}
+	listed := svc.DeepCopy()
+	listed.ResourceVersion = "1"
+	deleted := svc.DeepCopy()
+	deleted.Name = "deleted"
+	for _, s := range []*v1.Service{listed, deleted} {
+		drifts, err := cloud.ReconcileLoadBalancerRecords(context.Background(), s)
+		if err != nil || len(drifts) != 0 {
+			t.Fatalf("expect records of %s not repaired, got %v, %v", s.Name, drifts, err)
+		}
+	}
+}
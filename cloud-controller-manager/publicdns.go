@@ -0,0 +1,209 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	"github.com/denverdino/aliyungo/dns"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+)
+
+const (
+	// DEFAULT_PUBLIC_DNS_TTL default ttl of public dns records
+	DEFAULT_PUBLIC_DNS_TTL = 600
+	// DEFAULT_PUBLIC_DNS_LINE default resolution line of public dns records
+	DEFAULT_PUBLIC_DNS_LINE = "default"
+)
+
+// ClientDNSSDK alidns sdk interface
+type ClientDNSSDK interface {
+	DescribeSubDomainRecords(ctx context.Context, args *dns.DescribeSubDomainRecordsArgs) (records []dns.RecordType, err error)
+	AddDomainRecord(ctx context.Context, args *dns.AddDomainRecordArgs) (response *dns.AddDomainRecordResponse, err error)
+	UpdateDomainRecord(ctx context.Context, args *dns.UpdateDomainRecordArgs) (err error)
+	DeleteDomainRecord(ctx context.Context, args *dns.DeleteDomainRecordArgs) (err error)
+}
+
+// PublicDNSClient public dns client wrapper
+type PublicDNSClient struct {
+	c ClientDNSSDK
+}
+
+// isPublicDNSEnabled public dns records are published when domain is specified
+func isPublicDNSEnabled(service *v1.Service) bool {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	return defaulted.PublicDNSDomain != ""
+}
+
+// publicIPs addresses of the service which are reachable from internet, the
+// internet slb address or the eips.
+func publicIPs(service *v1.Service, status *v1.LoadBalancerStatus) []string {
+	if status == nil {
+		return nil
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	if defaulted.ExternalIPType != string(EIPExternalIPType) &&
+		defaulted.AddressType != slb.InternetAddressType {
+		return nil
+	}
+	return ingressIPs(status)
+}
+
+// EnsurePublicDNSRecords make sure the ips of the service are published in
+// public dns. Records of the previous ips of the service are deleted, records
+// of the same rr with other values are left untouched.
+func (d *PublicDNSClient) EnsurePublicDNSRecords(ctx context.Context, service *v1.Service, ips, previous []string) error {
+	defaulted, _ := ExtractAnnotationRequest(service)
+	if defaulted.PublicDNSRR == "" {
+		return fmt.Errorf("alicloud: annotation %s must be specified for public dns record",
+			ServiceAnnotationPublicDNSRR)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("alicloud: no internet address for public dns record, " +
+			"public dns record requires an internet loadbalancer or eip")
+	}
+	current, err := d.c.DescribeSubDomainRecords(
+		ctx,
+		&dns.DescribeSubDomainRecordsArgs{
+			SubDomain: subDomain(defaulted.PublicDNSRR, defaulted.PublicDNSDomain),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("alicloud: describe public dns records: %s", err.Error())
+	}
+	desired := make(map[string]bool)
+	for _, ip := range ips {
+		desired[ip] = true
+		recordType := getRecordTypeOfIP(ip)
+		record := findDomainRecord(current, recordType, ip)
+		if record == nil {
+			utils.Logf(service, "create public dns record [%s] %s %s",
+				subDomain(defaulted.PublicDNSRR, defaulted.PublicDNSDomain), recordType, ip)
+			_, err := d.c.AddDomainRecord(
+				ctx,
+				&dns.AddDomainRecordArgs{
+					DomainName: defaulted.PublicDNSDomain,
+					RR:         defaulted.PublicDNSRR,
+					Type:       recordType,
+					Value:      ip,
+					TTL:        int32(defaulted.PublicDNSTTL),
+					Line:       defaulted.PublicDNSLine,
+				},
+			)
+			if err != nil {
+				return fmt.Errorf("alicloud: add public dns record %s: %s", ip, err.Error())
+			}
+			continue
+		}
+		if int(record.TTL) == defaulted.PublicDNSTTL && record.Line == defaulted.PublicDNSLine {
+			continue
+		}
+		utils.Logf(service, "update public dns record %s, ttl %d, line %s",
+			record.RecordId, defaulted.PublicDNSTTL, defaulted.PublicDNSLine)
+		err := d.c.UpdateDomainRecord(
+			ctx,
+			&dns.UpdateDomainRecordArgs{
+				RecordId: record.RecordId,
+				RR:       record.RR,
+				Type:     record.Type,
+				Value:    record.Value,
+				TTL:      int32(defaulted.PublicDNSTTL),
+				Line:     defaulted.PublicDNSLine,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("alicloud: update public dns record %s: %s", record.RecordId, err.Error())
+		}
+	}
+	for _, ip := range previous {
+		if desired[ip] {
+			continue
+		}
+		if err := d.deleteRecord(ctx, service, current, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsurePublicDNSRecordsDeleted delete the public dns records of the ips in
+// the domain, only records with exactly the same value are deleted.
+func (d *PublicDNSClient) EnsurePublicDNSRecordsDeleted(ctx context.Context, service *v1.Service, domain, rr string, ips []string) error {
+	if domain == "" || rr == "" || len(ips) == 0 {
+		return nil
+	}
+	current, err := d.c.DescribeSubDomainRecords(
+		ctx,
+		&dns.DescribeSubDomainRecordsArgs{
+			SubDomain: subDomain(rr, domain),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("alicloud: describe public dns records: %s", err.Error())
+	}
+	for _, ip := range ips {
+		if err := d.deleteRecord(ctx, service, current, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPublishedDNS public dns records published by the last successful
+// reconcile, nil if not recorded.
+func getPublishedDNS(service *v1.Service) *utils.PublicDNSResource {
+	resources := getManagedResources(service)
+	if resources == nil {
+		return nil
+	}
+	return resources.PublicDNS
+}
+
+// recordPublishedDNS record the published public dns records in context
+func recordPublishedDNS(ctx context.Context, published *utils.PublicDNSResource) {
+	resources, err := utils.GetResourcesFromContext(ctx)
+	if err != nil {
+		return
+	}
+	resources.SetPublicDNS(published)
+}
+
+func (d *PublicDNSClient) deleteRecord(ctx context.Context, service *v1.Service, current []dns.RecordType, ip string) error {
+	record := findDomainRecord(current, getRecordTypeOfIP(ip), ip)
+	if record == nil {
+		return nil
+	}
+	utils.Logf(service, "delete public dns record %s, %s", record.RecordId, ip)
+	err := d.c.DeleteDomainRecord(ctx, &dns.DeleteDomainRecordArgs{RecordId: record.RecordId})
+	if err != nil {
+		return fmt.Errorf("alicloud: delete public dns record %s: %s", record.RecordId, err.Error())
+	}
+	return nil
+}
+
+func findDomainRecord(records []dns.RecordType, recordType, value string) *dns.RecordType {
+	for i := range records {
+		if records[i].Type == recordType && records[i].Value == value {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// subDomain full name of the rr, @ is the domain itself
+func subDomain(rr, domain string) string {
+	if rr == "@" {
+		return domain
+	}
+	return fmt.Sprintf("%s.%s", rr, domain)
+}
+
+func ingressIPs(status *v1.LoadBalancerStatus) []string {
+	var ips []string
+	for _, ing := range status.Ingress {
+		if ing.IP != "" {
+			ips = append(ips, ing.IP)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,88 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	"github.com/denverdino/aliyungo/dns"
+	"sync"
+)
+
+// mockClientDNS alidns sdk backed by an in memory store
+type mockClientDNS struct {
+	lock    sync.Mutex
+	nextId  int64
+	records []dns.RecordType
+}
+
+func newMockClientDNS(records ...dns.RecordType) *mockClientDNS {
+	return &mockClientDNS{nextId: 2000, records: records}
+}
+
+// allRecords records of the domain
+func (c *mockClientDNS) allRecords() []dns.RecordType {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]dns.RecordType{}, c.records...)
+}
+
+func (c *mockClientDNS) DescribeSubDomainRecords(ctx context.Context, args *dns.DescribeSubDomainRecordsArgs) (records []dns.RecordType, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, record := range c.records {
+		if subDomain(record.RR, record.DomainName) == args.SubDomain {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (c *mockClientDNS) AddDomainRecord(ctx context.Context, args *dns.AddDomainRecordArgs) (response *dns.AddDomainRecordResponse, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, record := range c.records {
+		if record.DomainName == args.DomainName && record.RR == args.RR &&
+			record.Type == args.Type && record.Value == args.Value {
+			return nil, fmt.Errorf("DomainRecordDuplicate")
+		}
+	}
+	c.nextId++
+	id := fmt.Sprintf("%d", c.nextId)
+	c.records = append(c.records, dns.RecordType{
+		DomainName: args.DomainName,
+		RecordId:   id,
+		RR:         args.RR,
+		Type:       args.Type,
+		Value:      args.Value,
+		TTL:        args.TTL,
+		Line:       args.Line,
+	})
+	return &dns.AddDomainRecordResponse{RecordId: id}, nil
+}
+
+func (c *mockClientDNS) UpdateDomainRecord(ctx context.Context, args *dns.UpdateDomainRecordArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i := range c.records {
+		if c.records[i].RecordId == args.RecordId {
+			c.records[i].RR = args.RR
+			c.records[i].Type = args.Type
+			c.records[i].Value = args.Value
+			c.records[i].TTL = args.TTL
+			c.records[i].Line = args.Line
+			return nil
+		}
+	}
+	return fmt.Errorf("DomainRecordNotBelongToUser")
+}
+
+func (c *mockClientDNS) DeleteDomainRecord(ctx context.Context, args *dns.DeleteDomainRecordArgs) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i := range c.records {
+		if c.records[i].RecordId == args.RecordId {
+			c.records = append(c.records[:i], c.records[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("DomainRecordNotBelongToUser")
+}
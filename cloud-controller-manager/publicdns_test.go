@@ -0,0 +1,185 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/dns"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"testing"
+)
+
+func TestEnsurePublicDNSRecords(t *testing.T) {
+	// record of the same rr maintained by others
+	mock := newMockClientDNS(dns.RecordType{
+		DomainName: "example.com", RecordId: "1", RR: "www", Type: "A", Value: "1.1.1.1", TTL: 600, Line: "default",
+	})
+	client := &PublicDNSClient{c: mock}
+	ctx := context.Background()
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			Annotations: map[string]string{
+				ServiceAnnotationLoadBalancerAddressType: string(slb.InternetAddressType),
+				ServiceAnnotationPublicDNSDomain:         "example.com",
+				ServiceAnnotationPublicDNSRR:             "www",
+			},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	find := func(value string) *dns.RecordType {
+		return findDomainRecord(mock.allRecords(), getRecordTypeOfIP(value), value)
+	}
+
+	status := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "47.0.0.1"}, {IP: "2408::1"}}}
+	if !isPublicDNSEnabled(service) {
+		t.Fatal("expect public dns enabled")
+	}
+	if err := client.EnsurePublicDNSRecords(ctx, service, publicIPs(service, status), nil); err != nil {
+		t.Fatalf("ensure public dns records: %s", err.Error())
+	}
+	if r := find("47.0.0.1"); r == nil || r.Type != "A" || r.TTL != DEFAULT_PUBLIC_DNS_TTL {
+		t.Fatalf("unexpected A record %v", r)
+	}
+	if r := find("2408::1"); r == nil || r.Type != "AAAA" {
+		t.Fatalf("unexpected AAAA record %v", r)
+	}
+
+	// ttl and line are updated in place
+	service.Annotations[ServiceAnnotationPublicDNSTTL] = "60"
+	service.Annotations[ServiceAnnotationPublicDNSLine] = "telecom"
+	if err := client.EnsurePublicDNSRecords(ctx, service, publicIPs(service, status), ingressIPs(status)); err != nil {
+		t.Fatalf("ensure public dns records: %s", err.Error())
+	}
+	if r := find("47.0.0.1"); r == nil || r.TTL != 60 || r.Line != "telecom" {
+		t.Fatalf("expect ttl and line updated, got %v", r)
+	}
+	if len(mock.allRecords()) != 3 {
+		t.Fatalf("expect 3 records, got %v", mock.allRecords())
+	}
+
+	// records of the previous address are replaced
+	changed := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "47.0.0.2"}}}
+	if err := client.EnsurePublicDNSRecords(ctx, service, publicIPs(service, changed), ingressIPs(status)); err != nil {
+		t.Fatalf("ensure public dns records: %s", err.Error())
+	}
+	if find("47.0.0.1") != nil || find("2408::1") != nil || find("47.0.0.2") == nil {
+		t.Fatalf("expect records of previous address replaced, got %v", mock.allRecords())
+	}
+	if find("1.1.1.1") == nil {
+		t.Fatal("records of others should be kept")
+	}
+
+	// intranet loadbalancer can not be published
+	intranet := service.DeepCopy()
+	intranet.Annotations[ServiceAnnotationLoadBalancerAddressType] = string(slb.IntranetAddressType)
+	if err := client.EnsurePublicDNSRecords(ctx, intranet, publicIPs(intranet, changed), nil); err == nil {
+		t.Fatal("expect error for intranet loadbalancer")
+	}
+
+	if err := client.EnsurePublicDNSRecordsDeleted(ctx, service, "example.com", "www", ingressIPs(changed)); err != nil {
+		t.Fatalf("delete public dns records: %s", err.Error())
+	}
+	records := mock.allRecords()
+	if len(records) != 1 || records[0].RecordId != "1" {
+		t.Fatalf("expect only records of others left, got %v", records)
+	}
+}
+
+func TestPublishedPublicDNSRecords(t *testing.T) {
+	prid := nodeid(string(REGION), INSTANCEID)
+	mock := newMockClientDNS()
+	f := NewDefaultFrameWork(nil)
+	f.Cloud.climgr.publicDNS = &PublicDNSClient{c: mock}
+	f.WithService(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: "default",
+				UID:       types.UID(serviceUIDNoneExist),
+				Annotations: map[string]string{
+					ServiceAnnotationPublicDNSDomain: "example.com",
+					ServiceAnnotationPublicDNSRR:     "www",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Port: listenPort1, TargetPort: targetPort1, Protocol: v1.ProtocolTCP, NodePort: nodePort1},
+				},
+				Type: v1.ServiceTypeLoadBalancer,
+			},
+		},
+	).WithNodes(
+		[]*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: prid},
+				Spec:       v1.NodeSpec{ProviderID: prid},
+			},
+		},
+	)
+
+	// ensure the service as the service controller does
+	ensure := func(f *FrameWork) error {
+		resources := &utils.ManagedResources{}
+		ctx := context.WithValue(context.Background(), utils.ContextResources, resources)
+		status, err := f.CloudImpl().EnsureLoadBalancer(ctx, CLUSTER_ID, f.SVC, f.Nodes)
+		if err != nil {
+			return fmt.Errorf("EnsureLoadBalancer error: %s", err.Error())
+		}
+		data, err := json.Marshal(resources)
+		if err != nil {
+			return err
+		}
+		f.SVC.Annotations[utils.ServiceAnnotationLoadBalancerResources] = string(data)
+		f.SVC.Status.LoadBalancer = *status
+		return nil
+	}
+	subDomainRecords := func(rr string) []dns.RecordType {
+		var records []dns.RecordType
+		for _, r := range mock.allRecords() {
+			if r.RR == rr {
+				records = append(records, r)
+			}
+		}
+		return records
+	}
+
+	f.RunCustomized(t, "Published public dns records",
+		func(f *FrameWork) error {
+			if err := ensure(f); err != nil {
+				return err
+			}
+			if records := subDomainRecords("www"); len(records) != 1 || records[0].Value != LOADBALANCER_ADDRESS {
+				return fmt.Errorf("expect record of www published, got %v", mock.allRecords())
+			}
+
+			// records of the previous rr are deleted
+			f.SVC.Annotations[ServiceAnnotationPublicDNSRR] = "web"
+			if err := ensure(f); err != nil {
+				return err
+			}
+			if len(subDomainRecords("www")) != 0 || len(subDomainRecords("web")) != 1 {
+				return fmt.Errorf("expect record moved from www to web, got %v", mock.allRecords())
+			}
+
+			// records are deleted when public dns is turned off
+			delete(f.SVC.Annotations, ServiceAnnotationPublicDNSDomain)
+			delete(f.SVC.Annotations, ServiceAnnotationPublicDNSRR)
+			if err := ensure(f); err != nil {
+				return err
+			}
+			if len(mock.allRecords()) != 0 {
+				return fmt.Errorf("expect published records deleted, got %v", mock.allRecords())
+			}
+			if getPublishedDNS(f.SVC) != nil {
+				return fmt.Errorf("expect published records no longer recorded")
+			}
+			return nil
+		},
+	)
+}
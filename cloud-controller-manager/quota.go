@@ -0,0 +1,263 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"sync"
+)
+
+// DEFAULT_QUOTA_KEY quota applies to namespaces which are not listed in namespaceQuotas
+const DEFAULT_QUOTA_KEY = "*"
+
+// NamespaceQuota caps the slb created by cloud controller manager in one namespace.
+// Zero value means no limit.
+type NamespaceQuota struct {
+	MaxLoadBalancers         int `json:"maxLoadBalancers"`
+	MaxInternetLoadBalancers int `json:"maxInternetLoadBalancers"`
+	// MaxBandwidth total bandwidth(Mbps) of internet slb charged by bandwidth
+	MaxBandwidth int `json:"maxBandwidth"`
+}
+
+type namespaceUsage struct {
+	LoadBalancers         int
+	InternetLoadBalancers int
+	Bandwidth             int
+}
+
+func (u *namespaceUsage) add(addressType slb.AddressType, charge slb.InternetChargeType, bandwidth int) {
+	u.LoadBalancers++
+	if addressType != slb.InternetAddressType {
+		return
+	}
+	u.InternetLoadBalancers++
+	u.Bandwidth += chargedBandwidth(charge, bandwidth)
+}
+
+func (u *namespaceUsage) merge(other namespaceUsage) {
+	u.LoadBalancers += other.LoadBalancers
+	u.InternetLoadBalancers += other.InternetLoadBalancers
+	u.Bandwidth += other.Bandwidth
+}
+
+// chargedBandwidth bandwidth counted in quota, only slb charged by bandwidth counts.
+func chargedBandwidth(charge slb.InternetChargeType, bandwidth int) int {
+	if charge == slb.PayByBandwidth && bandwidth > 0 {
+		return bandwidth
+	}
+	return 0
+}
+
+func (q *NamespaceQuota) check(used namespaceUsage) error {
+	if q.MaxLoadBalancers > 0 && used.LoadBalancers > q.MaxLoadBalancers {
+		return fmt.Errorf("loadbalancer count %d exceeds quota %d", used.LoadBalancers, q.MaxLoadBalancers)
+	}
+	if q.MaxInternetLoadBalancers > 0 && used.InternetLoadBalancers > q.MaxInternetLoadBalancers {
+		return fmt.Errorf("internet loadbalancer count %d exceeds quota %d",
+			used.InternetLoadBalancers, q.MaxInternetLoadBalancers)
+	}
+	if q.MaxBandwidth > 0 && used.Bandwidth > q.MaxBandwidth {
+		return fmt.Errorf("total bandwidth %dMbps exceeds quota %dMbps", used.Bandwidth, q.MaxBandwidth)
+	}
+	return nil
+}
+
+func getNamespaceQuota(namespace string) (*NamespaceQuota, bool) {
+	if q, ok := cfg.Global.NamespaceQuotas[namespace]; ok {
+		return &q, true
+	}
+	if q, ok := cfg.Global.NamespaceQuotas[DEFAULT_QUOTA_KEY]; ok {
+		return &q, true
+	}
+	return nil, false
+}
+
+// getNamespaceUsage count the slb created by ccm in namespace through NAMESPACEKEY tag
+// in the region of the client. Slb created before NAMESPACEKEY was introduced are
+// tagged when their services are synced.
+func (s *LoadBalancerClient) getNamespaceUsage(ctx context.Context, namespace string) (namespaceUsage, error) {
+	used := namespaceUsage{}
+	items, err := json.Marshal(
+		[]slb.TagItem{
+			{
+				TagKey:   ACKKEY,
+				TagValue: CLUSTER_ID,
+			},
+			{
+				TagKey:   NAMESPACEKEY,
+				TagValue: namespace,
+			},
+		},
+	)
+	if err != nil {
+		return used, err
+	}
+	lbs, err := s.c.DescribeLoadBalancers(
+		ctx,
+		&slb.DescribeLoadBalancersArgs{
+			Tags:     string(items),
+			RegionId: s.Region(),
+		},
+	)
+	if err != nil {
+		return used, err
+	}
+	for _, lb := range lbs {
+		used.add(lb.AddressType, lb.InternetChargeType, lb.Bandwidth)
+	}
+	return used, nil
+}
+
+// namespaceUsage count the slb of the namespace in all regions it may use,
+// which are the cluster region and the regions of its LoadBalancer services.
+func (c *Cloud) namespaceUsage(ctx context.Context, namespace string) (namespaceUsage, error) {
+	regions := map[common.Region]bool{DEFAULT_REGION: true}
+	if c.ifactory != nil {
+		svcs, err := c.ifactory.Core().V1().Services().Lister().Services(namespace).List(labels.Everything())
+		if err != nil {
+			return namespaceUsage{}, fmt.Errorf("list services: %s", err.Error())
+		}
+		for _, svc := range svcs {
+			if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+				continue
+			}
+			defaulted, _ := ExtractAnnotationRequest(svc)
+			regions[defaulted.Region] = true
+		}
+	}
+	used := namespaceUsage{}
+	for region := range regions {
+		u, err := c.climgr.Regional(region).LoadBalancers().getNamespaceUsage(ctx, namespace)
+		if err != nil {
+			return used, fmt.Errorf("region %s: %s", region, err.Error())
+		}
+		used.merge(u)
+	}
+	return used, nil
+}
+
+// namespaceQuotaLocks locks of namespaces with quota. Quota check and the
+// change counted are serialized within the namespace, so that concurrent
+// syncs never exceed the quota together.
+var namespaceQuotaLocks sync.Map
+
+// lockNamespaceQuota lock the namespace if it has quota and return the unlock func.
+func lockNamespaceQuota(namespace string) func() {
+	if _, ok := getNamespaceQuota(namespace); !ok {
+		return func() {}
+	}
+	lock, _ := namespaceQuotaLocks.LoadOrStore(namespace, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// createLoadBalancer create the slb within the namespace quota and tag it.
+// The slb is counted in usage once tagged with NAMESPACEKEY.
+func (s *LoadBalancerClient) createLoadBalancer(
+	ctx context.Context,
+	service *v1.Service,
+	opts *slb.CreateLoadBalancerArgs,
+	tags map[string]string,
+) (*slb.CreateLoadBalancerResponse, error) {
+	defer lockNamespaceQuota(service.Namespace)()
+	if err := s.checkNamespaceQuota(ctx, service, opts); err != nil {
+		return nil, err
+	}
+	lbr, err := s.c.CreateLoadBalancer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := addSLBTag(s.c, ctx, tags, opts.RegionId, lbr.LoadBalancerId); err != nil {
+		return nil, err
+	}
+	return lbr, nil
+}
+
+// updateLoadBalancer apply the annotations to the slb within the namespace quota.
+func (s *LoadBalancerClient) updateLoadBalancer(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	request *AnnotationRequest,
+	tags []slb.TagItemType,
+) error {
+	defer lockNamespaceQuota(service.Namespace)()
+	if err := s.checkBandwidthQuota(ctx, service, lb, request); err != nil {
+		return err
+	}
+	return updateLoadBalancerByAnnotations(ctx, s.c, lb, service, request, tags)
+}
+
+// checkNamespaceQuota make sure the slb about to be created does not exceed the namespace quota.
+func (s *LoadBalancerClient) checkNamespaceQuota(ctx context.Context, service *v1.Service, opts *slb.CreateLoadBalancerArgs) error {
+	return s.checkQuota(ctx, service, "creating", func(used *namespaceUsage) {
+		used.add(opts.AddressType, opts.InternetChargeType, opts.Bandwidth)
+	})
+}
+
+// checkBandwidthQuota make sure the bandwidth increase of the slb about to be
+// applied by updateLoadBalancerByAnnotations does not exceed the namespace quota.
+func (s *LoadBalancerClient) checkBandwidthQuota(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	request *AnnotationRequest,
+) error {
+	if lb.AddressType != slb.InternetAddressType {
+		return nil
+	}
+	charge, bandwidth := lb.InternetChargeType, lb.Bandwidth
+	if request.ChargeType != "" {
+		charge = request.ChargeType
+	}
+	if request.ChargeType == slb.PayByBandwidth && request.Bandwidth != 0 {
+		bandwidth = request.Bandwidth
+	}
+	increase := chargedBandwidth(charge, bandwidth) - chargedBandwidth(lb.InternetChargeType, lb.Bandwidth)
+	if increase <= 0 {
+		return nil
+	}
+	return s.checkQuota(ctx, service, "updating", func(used *namespaceUsage) {
+		used.Bandwidth += increase
+	})
+}
+
+// checkQuota check the usage of the service namespace after the change applied.
+func (s *LoadBalancerClient) checkQuota(ctx context.Context, service *v1.Service, action string, apply func(used *namespaceUsage)) error {
+	quota, ok := getNamespaceQuota(service.Namespace)
+	if !ok {
+		return nil
+	}
+	usage := s.getNamespaceUsage
+	if s.usage != nil {
+		usage = s.usage
+	}
+	used, err := usage(ctx, service.Namespace)
+	if err != nil {
+		return fmt.Errorf("get loadbalancer usage of namespace %s: %s", service.Namespace, err.Error())
+	}
+	apply(&used)
+	utils.Logf(service, "namespace quota %+v, usage after %s %+v", *quota, action, used)
+	if err := quota.check(used); err != nil {
+		record, rerr := utils.GetRecorderFromContext(ctx)
+		if rerr != nil {
+			klog.Warningf("get recorder error: %s", rerr.Error())
+		} else {
+			record.Eventf(
+				service,
+				v1.EventTypeWarning,
+				"NamespaceQuotaExceeded",
+				"Error %s load balancer: namespace %s quota exceeded, %s",
+				action, service.Namespace, err.Error(),
+			)
+		}
+		return fmt.Errorf("alicloud: namespace %s quota exceeded, %s", service.Namespace, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"strings"
+	"time"
+)
+
+// PRIVATE_ZONE_RECORD_GC_PERIOD period to delete records of deleted services
+const PRIVATE_ZONE_RECORD_GC_PERIOD = 10 * time.Minute
+
+// persistedRecords records created for a service
+type persistedRecords struct {
+	ZoneId string `json:"zoneId"`
+	// Records record ids keyed by record cache key
+	Records map[string]int64 `json:"records"`
+}
+
+// recordBackend persist the records created for services
+type recordBackend interface {
+	// load records keyed by service uid
+	load(ctx context.Context) (map[string]*persistedRecords, error)
+	// save records of the service, records are removed if nil
+	save(ctx context.Context, service *v1.Service, records *persistedRecords) error
+}
+
+// serviceRecordBackend persist the records of each service in the private
+// zone records annotation of the service itself.
+type serviceRecordBackend struct {
+	client kubernetes.Interface
+}
+
+func newServiceRecordBackend(client kubernetes.Interface) *serviceRecordBackend {
+	return &serviceRecordBackend{client: client}
+}
+
+func (b *serviceRecordBackend) load(ctx context.Context) (map[string]*persistedRecords, error) {
+	svcs, err := b.client.CoreV1().Services(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %s", err.Error())
+	}
+	result := make(map[string]*persistedRecords)
+	for i := range svcs.Items {
+		svc := &svcs.Items[i]
+		data, ok := svc.Annotations[utils.ServiceAnnotationPrivateZoneRecords]
+		if !ok {
+			continue
+		}
+		records := &persistedRecords{}
+		if err := json.Unmarshal([]byte(data), records); err != nil {
+			utils.Logf(svc, "skip malformed private zone records: %s", err.Error())
+			continue
+		}
+		result[string(svc.UID)] = records
+	}
+	return result, nil
+}
+
+func (b *serviceRecordBackend) save(ctx context.Context, service *v1.Service, records *persistedRecords) error {
+	svc, err := b.client.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("get service: %s", err.Error())
+	}
+	// service recreated with the same name
+	if svc.UID != service.UID {
+		return nil
+	}
+	var value interface{}
+	if records != nil {
+		data, err := json.Marshal(records)
+		if err != nil {
+			return fmt.Errorf("marshal private zone records: %s", err.Error())
+		}
+		if svc.Annotations[utils.ServiceAnnotationPrivateZoneRecords] == string(data) {
+			return nil
+		}
+		value = string(data)
+	} else if _, ok := svc.Annotations[utils.ServiceAnnotationPrivateZoneRecords]; !ok {
+		return nil
+	}
+	// annotation is removed by null value of merge patch
+	patch, err := json.Marshal(
+		map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					utils.ServiceAnnotationPrivateZoneRecords: value,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("marshal patch: %s", err.Error())
+	}
+	_, err = b.client.CoreV1().Services(service.Namespace).Patch(
+		ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("patch service: %s", err.Error())
+	}
+	return nil
+}
+
+// recordCacheUID uid of the service which the record cache key belongs to,
+// see recordCacheKey and serviceRecordCacheKey
+func recordCacheUID(key string) string {
+	return strings.TrimSuffix(strings.SplitN(key, "/", 2)[0], IPV6_NAME_SUFFIX)
+}
+
+// restore load the persisted records, and persist the records from now on.
+func (kv *kvstore) restore(ctx context.Context, backend recordBackend) error {
+	services, err := backend.load(ctx)
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	// records are persisted even if failed to load, each service keeps
+	// its own records
+	kv.backend = backend
+	if err != nil {
+		return err
+	}
+	for uid, records := range services {
+		for key, id := range records.Records {
+			if recordCacheUID(key) != uid {
+				continue
+			}
+			kv.store[key] = id
+		}
+		if records.ZoneId != "" {
+			kv.zones[uid] = records.ZoneId
+		}
+	}
+	klog.Infof("alicloud: restored private zone records of %d services", len(services))
+	return nil
+}
+
+func (kv *kvstore) setZone(uid, zoneId string) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	kv.zones[uid] = zoneId
+}
+
+// ids ids of the records cached for the service under any key
+func (kv *kvstore) ids(uid string) map[int64]bool {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	result := make(map[int64]bool)
+	for key, id := range kv.store {
+		if recordCacheUID(key) == uid {
+			result[id] = true
+		}
+	}
+	return result
+}
+
+// removeZone remove the zone of the service once it has no records
+func (kv *kvstore) removeZone(uid string) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	for key := range kv.store {
+		if recordCacheUID(key) == uid {
+			return
+		}
+	}
+	delete(kv.zones, uid)
+}
+
+func (kv *kvstore) zone(uid string) string {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	return kv.zones[uid]
+}
+
+// persist save the records of the service to backend. Records are still
+// cached in memory when failed, and saved again on next change.
+func (kv *kvstore) persist(ctx context.Context, service *v1.Service) {
+	uid := string(service.UID)
+	kv.lock.Lock()
+	records := &persistedRecords{ZoneId: kv.zones[uid], Records: map[string]int64{}}
+	for key, id := range kv.store {
+		if recordCacheUID(key) == uid {
+			records.Records[key] = id
+		}
+	}
+	if len(records.Records) == 0 {
+		delete(kv.zones, uid)
+		records = nil
+	}
+	backend := kv.backend
+	kv.lock.Unlock()
+
+	if backend == nil {
+		return
+	}
+	if err := backend.save(ctx, service, records); err != nil {
+		utils.Logf(service, "persist private zone records: %s", err.Error())
+	}
+}
+
+// collectPrivateZoneRecords delete the cached records of services which no
+// longer exist, e.g. records failed to be deleted with the service. Records
+// of services deleted while ccm is not running are not known.
+func (c *Cloud) collectPrivateZoneRecords(ctx context.Context) error {
+	// snapshot before listing services, so that records of services created
+	// after the listing are not collected
+	entries := GetPrivateZoneRecordCache().list("")
+	if len(entries) == 0 {
+		return nil
+	}
+	svcs, err := c.kclient.CoreV1().Services(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list services: %s", err.Error())
+	}
+	alive := make(map[string]bool)
+	for _, svc := range svcs.Items {
+		alive[string(svc.UID)] = true
+	}
+	return c.climgr.PrivateZones().collectRecordGarbage(ctx, entries, alive)
+}
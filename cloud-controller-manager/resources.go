@@ -0,0 +1,184 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/ecs"
+	"github.com/denverdino/aliyungo/pvtz"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"strings"
+)
+
+// recordLoadBalancerResources record slb, listeners and vserver groups of
+// the service. Nothing is recorded unless resources are requested in context.
+func recordLoadBalancerResources(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	vgs *vgroups,
+) {
+	resources, err := utils.GetResourcesFromContext(ctx)
+	if err != nil {
+		return
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	r := resources.LoadBalancer(lb.LoadBalancerId)
+	r.Region = string(lb.RegionId)
+	r.AddressIPVersion = string(lb.AddressIPVersion)
+	r.AclId = defaulted.AclID
+	r.Tags = getUserTags(service)
+	_, annotated := getBackwardsCompatibleAnnotation(service.Annotations)[ServiceAnnotationLoadBalancerPersistenceTimeout]
+	r.SessionPersistence = service.Spec.SessionAffinity == v1.ServiceAffinityClientIP && !annotated
+	r.Listeners = nil
+	for _, port := range service.Spec.Ports {
+		proto, err := serviceProtocol(service, port)
+		if err != nil {
+			proto = strings.ToLower(string(port.Protocol))
+		}
+		r.Listeners = append(r.Listeners, utils.ListenerResource{Port: int(port.Port), Protocol: proto})
+	}
+	r.VServerGroups = nil
+	for _, vg := range *vgs {
+		r.VServerGroups = append(r.VServerGroups,
+			utils.VServerGroupResource{
+				VGroupId: vg.VGroupId,
+				Name:     vg.NamedKey.Key(),
+				Backends: len(vg.BackendServers),
+			})
+	}
+}
+
+// recordRelatedResources record eips and private zone record of the slb.
+// Recording is best effort, eips recorded before are kept when they can not
+// be described.
+func recordRelatedResources(
+	ctx context.Context,
+	service *v1.Service,
+	ins *InstanceClient,
+	lb *slb.LoadBalancerType,
+	pz *pvtz.DescribeZoneInfoResponse,
+	pzr *pvtz.ZoneRecordType,
+) {
+	resources, err := utils.GetResourcesFromContext(ctx)
+	if err != nil {
+		return
+	}
+	r := resources.LoadBalancer(lb.LoadBalancerId)
+	if pz != nil && pzr != nil {
+		r.PrivateZoneRecord = &utils.PrivateZoneRecordResource{
+			ZoneId:   pz.ZoneId,
+			RecordId: fmt.Sprintf("%d", pzr.RecordId),
+			Rr:       pzr.Rr,
+			Value:    pzr.Value,
+		}
+	}
+	// eip is only associated with intranet slb
+	r.EipIds = nil
+	if lb.AddressType != slb.IntranetAddressType {
+		return
+	}
+	eips, _, err := ins.DescribeEipAddresses(
+		ctx,
+		&ecs.DescribeEipAddressesArgs{
+			RegionId:               lb.RegionId,
+			AssociatedInstanceType: ecs.AssociatedInstanceTypeSlbInstance,
+			AssociatedInstanceId:   lb.LoadBalancerId,
+		},
+	)
+	if err != nil {
+		if recorded := getManagedResources(service); recorded != nil {
+			for _, res := range recorded.LoadBalancers {
+				if res.LoadBalancerId == lb.LoadBalancerId {
+					r.EipIds = res.EipIds
+				}
+			}
+		}
+		record, rerr := utils.GetRecorderFromContext(ctx)
+		if rerr != nil {
+			klog.Warningf("get recorder error: %s", rerr.Error())
+			utils.Logf(service, "describe eips of loadbalancer %s error: %s", lb.LoadBalancerId, err.Error())
+			return
+		}
+		record.Eventf(service, v1.EventTypeWarning, "RecordResourcesFailed",
+			"Error describing eips of load balancer %s: %s", lb.LoadBalancerId, err.Error())
+		return
+	}
+	for _, eip := range eips {
+		r.EipIds = append(r.EipIds, eip.AllocationId)
+	}
+}
+
+// getManagedResources resources recorded by the last successful reconcile,
+// nil if not recorded.
+func getManagedResources(service *v1.Service) *utils.ManagedResources {
+	data, ok := service.Annotations[utils.ServiceAnnotationLoadBalancerResources]
+	if !ok {
+		return nil
+	}
+	resources := &utils.ManagedResources{}
+	if err := json.Unmarshal([]byte(data), resources); err != nil {
+		utils.Logf(service, "unmarshal managed resources: %s", err.Error())
+		return nil
+	}
+	return resources
+}
+
+// getRecordedLoadBalancer record of the slb by the last successful reconcile,
+// nil if not recorded.
+func getRecordedLoadBalancer(service *v1.Service, lbid string) *utils.LoadBalancerResource {
+	resources := getManagedResources(service)
+	if resources == nil {
+		return nil
+	}
+	for _, lb := range resources.LoadBalancers {
+		if lb.LoadBalancerId == lbid {
+			return lb
+		}
+	}
+	return nil
+}
+
+// getAppliedTags additional-resource-tags applied to the slb and its related
+// resources by the last successful reconcile, nil if not recorded.
+func getAppliedTags(service *v1.Service, lbid string) map[string]string {
+	lb := getRecordedLoadBalancer(service, lbid)
+	if lb == nil {
+		return nil
+	}
+	return lb.Tags
+}
+
+// isSessionPersistenceRecorded whether session persistence of the listeners
+// was derived from ClientIP session affinity by the last successful reconcile.
+func isSessionPersistenceRecorded(service *v1.Service) bool {
+	resources := getManagedResources(service)
+	if resources == nil {
+		return false
+	}
+	for _, lb := range resources.LoadBalancers {
+		if lb.SessionPersistence {
+			return true
+		}
+	}
+	return false
+}
+
+// getRecordedRegion region of the slb recorded by the last successful reconcile,
+// empty if unknown.
+func getRecordedRegion(service *v1.Service) common.Region {
+	resources := getManagedResources(service)
+	if resources == nil {
+		return ""
+	}
+	for _, lb := range resources.LoadBalancers {
+		if lb.Region != "" {
+			return common.Region(lb.Region)
+		}
+	}
+	return ""
+}
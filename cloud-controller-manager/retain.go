@@ -0,0 +1,175 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"sort"
+	"strings"
+)
+
+// isRetainLoadBalancer the slb is kept on service deletion when retain-on-delete
+// annotation is on. Cluster default is used when the annotation is absent.
+func isRetainLoadBalancer(svc *v1.Service) bool {
+	switch strings.ToLower(serviceAnnotation(svc, ServiceAnnotationLoadBalancerRetainOnDelete)) {
+	case string(slb.OnFlag):
+		return true
+	case string(slb.OffFlag):
+		return false
+	}
+	return cfg.Global.RetainLoadBalancerOnDelete
+}
+
+// isReleasedTag tags which mark the slb as managed by kubernetes.
+// They are removed when the slb is released, so that it can be re-adopted by loadbalancer-id annotation.
+func isReleasedTag(key string) bool {
+	return key == TAGKEY ||
+		key == ACKKEY ||
+		key == SHAREDKEY ||
+		key == SHAREDOWNERKEY ||
+		key == NAMESPACEKEY ||
+		key == DUALSTACKIPV6KEY
+}
+
+// retainLoadBalancer detach all listeners and vserver groups created by kubernetes,
+// and retag the slb as released instead of deleting it.
+func (s *LoadBalancerClient) retainLoadBalancer(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
+	utils.Logf(service, "retain loadbalancer [%s] on deletion", lb.LoadBalancerId)
+
+	var listeners Listeners
+	for _, port := range lb.ListenerPortsAndProtocol.ListenerPortAndProtocol {
+		if _, err := LoadNamedKey(port.Description); err != nil {
+			// skip listener which is not created by kubernetes
+			continue
+		}
+		listeners = append(listeners,
+			&Listener{
+				Name:            port.Description,
+				Port:            int32(port.ListenerPort),
+				TransforedProto: port.ListenerProtocol,
+				LoadBalancerID:  lb.LoadBalancerId,
+				Client:          s.c,
+			},
+		)
+	}
+	// http listener forwarding to https must be removed first
+	isHTTP := func(i int) bool {
+		return strings.ToUpper(listeners[i].TransforedProto) == "HTTP"
+	}
+	sort.SliceStable(
+		listeners,
+		func(i, j int) bool {
+			return isHTTP(i) && !isHTTP(j)
+		},
+	)
+	for _, lis := range listeners {
+		klog.Infof("retain loadbalancer: remove listener [%s] of [%s]", lis.Name, lb.LoadBalancerId)
+		if err := lis.Remove(ctx); err != nil {
+			return fmt.Errorf("remove listener %d: %s", lis.Port, err.Error())
+		}
+	}
+
+	vgrps, err := BuildVirtualGroupFromRemoteAPI(ctx, lb, s)
+	if err != nil {
+		return err
+	}
+	for _, vg := range vgrps {
+		vg.Logf("retain loadbalancer: remove vserver group [%s][%s]", vg.NamedKey.Key(), vg.VGroupId)
+		if err := vg.Remove(ctx); err != nil {
+			return fmt.Errorf("remove vserver group %s: %s", vg.NamedKey.Key(), err.Error())
+		}
+	}
+
+	if err := s.releaseLoadBalancerTags(ctx, service, lb); err != nil {
+		return fmt.Errorf("release loadbalancer tags: %s", err.Error())
+	}
+
+	record, err := utils.GetRecorderFromContext(ctx)
+	if err != nil {
+		klog.Warningf("get recorder error: %s", err.Error())
+		klog.Infof("alicloud: loadbalancer [%s] is retained for service %s/%s",
+			lb.LoadBalancerId, service.Namespace, service.Name)
+	} else {
+		record.Eventf(
+			service,
+			v1.EventTypeNormal,
+			"RetainedLoadBalancer",
+			"Load balancer %s(%s) is retained, re-adopt it with annotation %s",
+			lb.LoadBalancerId, lb.Address, ServiceAnnotationLoadBalancerId,
+		)
+	}
+	return nil
+}
+
+func (s *LoadBalancerClient) releaseLoadBalancerTags(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
+	tags, _, err := s.c.DescribeTags(
+		ctx,
+		&slb.DescribeTagsArgs{
+			RegionId:       lb.RegionId,
+			LoadBalancerID: lb.LoadBalancerId,
+		})
+	if err != nil {
+		return err
+	}
+	var removed []slb.TagItem
+	for _, tag := range tags {
+		if isReleasedTag(tag.TagKey) {
+			removed = append(removed, tag.TagItem)
+		}
+	}
+	if len(removed) > 0 {
+		items, err := json.Marshal(removed)
+		if err != nil {
+			return err
+		}
+		if err := s.c.RemoveTags(
+			ctx,
+			&slb.RemoveTagsArgs{
+				RegionId:       lb.RegionId,
+				LoadBalancerID: lb.LoadBalancerId,
+				Tags:           string(items),
+			},
+		); err != nil {
+			return err
+		}
+	}
+	return addSLBTag(s.c, ctx,
+		map[string]string{RELEASEDKEY: fmt.Sprintf("%s/%s", service.Namespace, service.Name)},
+		lb.RegionId, lb.LoadBalancerId)
+}
+
+// adoptReleasedLoadBalancer remove the released tag when a retained slb is
+// re-adopted by loadbalancer-id annotation.
+func (s *LoadBalancerClient) adoptReleasedLoadBalancer(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	tags []slb.TagItemType,
+) error {
+	var released []slb.TagItem
+	for _, tag := range tags {
+		if tag.TagKey == RELEASEDKEY {
+			released = append(released, tag.TagItem)
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	items, err := json.Marshal(released)
+	if err != nil {
+		return err
+	}
+	utils.Logf(service, "adopt released loadbalancer [%s]", lb.LoadBalancerId)
+	return s.c.RemoveTags(
+		ctx,
+		&slb.RemoveTagsArgs{
+			RegionId:       lb.RegionId,
+			LoadBalancerID: lb.LoadBalancerId,
+			Tags:           string(items),
+		},
+	)
+}
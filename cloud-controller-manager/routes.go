@@ -34,6 +34,13 @@ type vpc struct {
 	tableids  []string
 }
 
+const (
+	// ROUTE_IPV4 ip version of ipv4 route entries
+	ROUTE_IPV4 = "IPv4"
+	// ROUTE_IPV6 ip version of ipv6 route entries
+	ROUTE_IPV6 = "IPv6"
+)
+
 //RoutesClient wrap route sdk
 type RoutesClient struct {
 	region string
@@ -84,25 +91,31 @@ func (r *RoutesClient) WithVPC(ctx context.Context, vpcid string, tableids strin
 }
 
 // ListRoutes lists all managed routes that belong to the specified clusterName
-func (r *RoutesClient) ListRoutes(ctx context.Context, tableid string) (routes []*cloudprovider.Route, err error) {
+// Routes of each ip version are listed separately if versions are specified.
+func (r *RoutesClient) ListRoutes(ctx context.Context, tableid string, versions ...string) (routes []*cloudprovider.Route, err error) {
 
 	klog.Infof("ListRoutes: for route table %s", tableid)
-	// route will be overwritten by getRouteEntryBatch
-	err = r.getRouteEntryBatch(ctx, tableid, "", &routes)
-	if err != nil {
-		return []*cloudprovider.Route{},
-			fmt.Errorf("table %s get route entries error ,err %s", tableid, err.Error())
-	} else {
-		return routes, nil
+	if len(versions) == 0 {
+		versions = []string{""}
 	}
+	for _, version := range versions {
+		// route will be overwritten by getRouteEntryBatch
+		err = r.getRouteEntryBatch(ctx, tableid, version, "", &routes)
+		if err != nil {
+			return []*cloudprovider.Route{},
+				fmt.Errorf("table %s get route entries error ,err %s", tableid, err.Error())
+		}
+	}
+	return routes, nil
 }
 
-func (r *RoutesClient) getRouteEntryBatch(ctx context.Context, tableid string, nextToken string, routes *[]*cloudprovider.Route) error {
+func (r *RoutesClient) getRouteEntryBatch(ctx context.Context, tableid string, version string, nextToken string, routes *[]*cloudprovider.Route) error {
 
 	args := &ecs.DescribeRouteEntryListArgs{
 		RegionId:       r.region,
 		RouteTableId:   tableid,
 		RouteEntryType: "Custom",
+		IpVersion:      version,
 		NextToken:      nextToken,
 	}
 	response, err := r.client.DescribeRouteEntryList(ctx, args)
@@ -124,7 +137,8 @@ func (r *RoutesClient) getRouteEntryBatch(ctx context.Context, tableid string, n
 			// skip none Instance route
 			strings.ToLower(e.NextHops.NextHop[0].NextHopType) != "instance" ||
 			// skip DNAT route
-			e.DestinationCidrBlock == "0.0.0.0/0" {
+			e.DestinationCidrBlock == "0.0.0.0/0" ||
+			e.DestinationCidrBlock == "::/0" {
 			continue
 		}
 
@@ -137,11 +151,19 @@ func (r *RoutesClient) getRouteEntryBatch(ctx context.Context, tableid string, n
 	}
 	// get next batch
 	if response.NextToken != "" {
-		return r.getRouteEntryBatch(ctx, tableid, response.NextToken, routes)
+		return r.getRouteEntryBatch(ctx, tableid, version, response.NextToken, routes)
 	}
 	return nil
 }
 
+// routeIPVersion ip version of the route destination cidr
+func routeIPVersion(cidr string) string {
+	if strings.Contains(cidr, ":") {
+		return ROUTE_IPV6
+	}
+	return ROUTE_IPV4
+}
+
 //RouteTables return all the tables in the vpc network.
 func (r *RoutesClient) RouteTables(ctx context.Context) ([]string, error) {
 	if len(r.vpc.tableids) != 0 {
@@ -172,32 +194,60 @@ func (r *RoutesClient) RouteTables(ctx context.Context) ([]string, error) {
 // route.Name will be ignored, although the cloud-provider may use nameHint
 // to create a more user-meaningful name.
 func (r *RoutesClient) CreateRoute(ctx context.Context, tabid string, route *cloudprovider.Route, region common.Region, vpcid string) error {
+	args, err := r.routeEntryToCreate(ctx, tabid, route)
+	if err != nil || args == nil {
+		return err
+	}
+	klog.Infof("CreateRoute:[%s] start to create route, %s -> %s", tabid, route.DestinationCIDR, route.TargetNode)
+	return WaitCreate(ctx, r, tabid, args)
+}
+
+// SubmitRoute creates the described managed route without waiting for it to
+// be available, routes submitted to the table are waited by WaitRouteTable.
+func (r *RoutesClient) SubmitRoute(ctx context.Context, tabid string, route *cloudprovider.Route, region common.Region, vpcid string) error {
+	args, err := r.routeEntryToCreate(ctx, tabid, route)
+	if err != nil || args == nil {
+		return err
+	}
+	klog.Infof("SubmitRoute:[%s] start to create route, %s -> %s", tabid, route.DestinationCIDR, route.TargetNode)
+	if err := r.client.CreateRouteEntry(ctx, args); err != nil {
+		return fmt.Errorf("SubmitRoute: create route for table %s error, %s", tabid, err.Error())
+	}
+	return nil
+}
+
+// WaitRouteTable wait for all route entries of the table available
+func (r *RoutesClient) WaitRouteTable(ctx context.Context, tabid string) error {
+	return WaitForRouteEntryAvailable(ctx, r.client, r.vpc.vrouterid, tabid)
+}
+
+// routeEntryToCreate args to create the route, nil if the route exists
+func (r *RoutesClient) routeEntryToCreate(ctx context.Context, tabid string, route *cloudprovider.Route) (*ecs.CreateRouteEntryArgs, error) {
 	describeRouteEntryListArgs := &ecs.DescribeRouteEntryListArgs{
 		RegionId:             r.region,
 		RouteTableId:         tabid,
 		RouteEntryType:       string(ecs.RouteTableCustom),
 		DestinationCidrBlock: route.DestinationCIDR,
+		IpVersion:            routeIPVersion(route.DestinationCIDR),
 		NextHopId:            string(route.TargetNode),
 	}
 	response, err := r.client.DescribeRouteEntryList(ctx, describeRouteEntryListArgs)
 	if err != nil || response == nil {
-		return fmt.Errorf("describe table %s RouteEntry list error, %v", tabid, err)
+		return nil, fmt.Errorf("describe table %s RouteEntry list error, %v", tabid, err)
 	}
 
 	if len(response.RouteEntrys.RouteEntry) > 0 {
 		klog.Infof("CreateRoute: skip exist route, %s -> %s", route.DestinationCIDR, route.TargetNode)
-		return nil
+		return nil, nil
 	}
 
-	args := &ecs.CreateRouteEntryArgs{
+	return &ecs.CreateRouteEntryArgs{
 		ClientToken:          "",
 		RouteTableId:         tabid,
 		DestinationCidrBlock: route.DestinationCIDR,
 		NextHopType:          ecs.NextHopInstance,
 		NextHopId:            string(route.TargetNode),
-	}
-	klog.Infof("CreateRoute:[%s] start to create route, %s -> %s", tabid, route.DestinationCIDR, route.TargetNode)
-	return WaitCreate(ctx, r, tabid, args)
+	}, nil
 }
 
 // DeleteRoute deletes the specified managed route
@@ -34,6 +34,7 @@ type mockRouteSDK struct {
 	createRouteEntry                func(args *ecs.CreateRouteEntryArgs) error
 	waitForAllRouteEntriesAvailable func(vrouterId string, routeTableId string, timeout int) error
 	describeRouteEntryList          func(args *ecs.DescribeRouteEntryListArgs) (response *ecs.DescribeRouteEntryListResponse, err error)
+	describeVSwitches               func(args *DescribeVSwitchesArgs) (vswitches []ecs.VSwitchSetType, pagination *common.PaginationResult, err error)
 }
 
 func WithNewRouteStore() CloudDataMock {
@@ -102,6 +103,13 @@ func WithRouteTableEntrySet() CloudDataMock {
 	}
 }
 
+func (m *mockRouteSDK) DescribeVSwitches(ctx context.Context, args *DescribeVSwitchesArgs) (vswitches []ecs.VSwitchSetType, pagination *common.PaginationResult, err error) {
+	if m.describeVSwitches != nil {
+		return m.describeVSwitches(args)
+	}
+	return []ecs.VSwitchSetType{}, nil, nil
+}
+
 func (m *mockRouteSDK) DescribeVpcs(ctx context.Context, args *ecs.DescribeVpcsArgs) (vpcs []ecs.VpcSetType, pagination *common.PaginationResult, err error) {
 	if m.describeVpcs != nil {
 		return m.describeVpcs(args)
@@ -243,9 +251,13 @@ func (m *mockRouteSDK) DescribeRouteEntryList(ctx context.Context, args *ecs.Des
 	}
 
 	for _, e := range result.RouteEntrys.RouteEntry {
+		version := routeIPVersion(e.DestinationCidrBlock)
+		if args.IpVersion != "" && args.IpVersion != version {
+			continue
+		}
 		routeEntry := ecs.RouteEntry{
 			DestinationCidrBlock: e.DestinationCidrBlock,
-			IpVersion:            "",
+			IpVersion:            version,
 			RouteEntryId:         "",
 			RouteEntryName:       "",
 			RouteTableId:         e.RouteTableId,
@@ -19,6 +19,7 @@ package alicloud
 import (
 	"context"
 	"fmt"
+	"github.com/denverdino/aliyungo/ecs"
 	"strings"
 	"testing"
 )
@@ -72,6 +73,57 @@ func TestListRoutes(t *testing.T) {
 	}
 }
 
+func TestListDualStackRoutes(t *testing.T) {
+	entry := func(cidr, instance string) ecs.RouteEntrySetType {
+		return ecs.RouteEntrySetType{
+			RouteTableId:         ROUTE_TABLE_ID,
+			DestinationCidrBlock: cidr,
+			Type:                 "Custom",
+			NextHopType:          "Instance",
+			InstanceId:           instance,
+			Status:               "Available",
+		}
+	}
+	PreSetCloudData(
+		WithNewRouteStore(),
+		WithVpcs(),
+		WithVRouter(),
+	)
+	cmgr, err := NewMockRouteMgr("")
+	if err != nil {
+		t.Fatal("failed to create client manager")
+	}
+	ROUTES.tables.Store(
+		ROUTE_TABLE_ID,
+		ecs.RouteTableSetType{
+			VRouterId:    VROUTER_ID,
+			RouteTableId: ROUTE_TABLE_ID,
+			RouteEntrys: struct {
+				RouteEntry []ecs.RouteEntrySetType
+			}{
+				RouteEntry: []ecs.RouteEntrySetType{
+					entry("172.16.1.0/24", "i-1"),
+					entry("2408:4005:3f6:2400::/64", "i-1"),
+					entry("::/0", "i-2"),
+				},
+			},
+			RouteTableType: "System",
+		},
+	)
+
+	routes, err := cmgr.Routes().ListRoutes(context.Background(), ROUTE_TABLE_ID, ROUTE_IPV4, ROUTE_IPV6)
+	if err != nil {
+		t.Fatalf("failed to list routes, %v", err)
+	}
+	var cidrs []string
+	for _, r := range routes {
+		cidrs = append(cidrs, r.DestinationCIDR)
+	}
+	if strings.Join(cidrs, ",") != "172.16.1.0/24,2408:4005:3f6:2400::/64" {
+		t.Fatalf("unexpected routes listed: %v", cidrs)
+	}
+}
+
 func testCamel(t *testing.T, original, expected string) {
 	converted := replaceCamel(normalizePrefix(original))
 	if converted != expected {
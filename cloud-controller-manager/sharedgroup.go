@@ -0,0 +1,231 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"strings"
+	"sync"
+)
+
+// sharedGroupLocks locks of shared groups. Find-or-create and delete of a shared
+// loadbalancer are serialized within its group, so that members of the same
+// group never create two slb at the same time.
+var sharedGroupLocks sync.Map
+
+// lockSharedGroup lock the shared group and return the unlock func.
+func lockSharedGroup(group string) func() {
+	lock, _ := sharedGroupLocks.LoadOrStore(group, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// isSharedLoadBalancer services with shared-group annotation are packed onto
+// one slb managed by ccm. User assigned loadbalancer id takes precedence.
+func isSharedLoadBalancer(svc *v1.Service) bool {
+	return serviceAnnotation(svc, ServiceAnnotationLoadBalancerSharedGroup) != "" &&
+		!isUserDefinedLoadBalancer(svc)
+}
+
+// getSharedGroupTagValue value of TAGKEY for shared loadbalancer.
+// Service names can not contain '/', so it never collides with GetLoadBalancerName.
+func getSharedGroupTagValue(group string) string {
+	return fmt.Sprintf("shared/%s", group)
+}
+
+// getSharedLoadBalancerName default name of the shared loadbalancer.
+func getSharedLoadBalancerName(group string) string {
+	ret := fmt.Sprintf("k8s-shared-%s", group)
+	if len(ret) > 80 {
+		ret = ret[:80]
+	}
+	return ret
+}
+
+// getSharedGroupMember value of SHAREDOWNERKEY for the service.
+func getSharedGroupMember(svc *v1.Service) string {
+	return fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)
+}
+
+// getSharedGroupOwner the member whose slb level annotations, such as bandwidth
+// and spec, are applied to the shared loadbalancer.
+func getSharedGroupOwner(tags []slb.TagItemType) string {
+	for _, tag := range tags {
+		if tag.TagKey == SHAREDOWNERKEY {
+			return tag.TagValue
+		}
+	}
+	return ""
+}
+
+// ensureSharedGroupOwner return whether the service owns the shared loadbalancer.
+// The member created the slb owns it, and ownership is taken over by the next
+// member synced after the owner leaves the group.
+func (s *LoadBalancerClient) ensureSharedGroupOwner(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	tags []slb.TagItemType,
+) (bool, error) {
+	member := getSharedGroupMember(service)
+	if owner := getSharedGroupOwner(tags); owner != "" {
+		return owner == member, nil
+	}
+	utils.Logf(service, "take over the ownership of shared loadbalancer [%s]", lb.LoadBalancerId)
+	err := addSLBTag(s.c, ctx, map[string]string{SHAREDOWNERKEY: member}, lb.RegionId, lb.LoadBalancerId)
+	return err == nil, err
+}
+
+// checkSharedGroupAnnotations slb level annotations are taken from the owner of
+// the shared loadbalancer only. Other members must not set them to a different
+// value, otherwise members would overwrite each other.
+func checkSharedGroupAnnotations(request *AnnotationRequest, lb *slb.LoadBalancerType, owner string) error {
+	var conflicts []string
+	if request.AddressType != "" && request.AddressType != lb.AddressType {
+		conflicts = append(conflicts, fmt.Sprintf("address type %s", request.AddressType))
+	}
+	if request.ChargeType != "" && request.ChargeType != lb.InternetChargeType {
+		conflicts = append(conflicts, fmt.Sprintf("charge type %s", request.ChargeType))
+	}
+	if request.Bandwidth != 0 && request.Bandwidth != lb.Bandwidth {
+		conflicts = append(conflicts, fmt.Sprintf("bandwidth %d", request.Bandwidth))
+	}
+	if request.LoadBalancerSpec != "" && request.LoadBalancerSpec != lb.LoadBalancerSpec {
+		conflicts = append(conflicts, fmt.Sprintf("spec %s", request.LoadBalancerSpec))
+	}
+	if request.DeleteProtection != "" && request.DeleteProtection != lb.DeleteProtection {
+		conflicts = append(conflicts, fmt.Sprintf("delete protection %s", request.DeleteProtection))
+	}
+	if request.ModificationProtectionStatus != "" &&
+		request.ModificationProtectionStatus != lb.ModificationProtectionStatus {
+		conflicts = append(conflicts, fmt.Sprintf("modification protection %s", request.ModificationProtectionStatus))
+	}
+	if request.LoadBalancerName != "" && request.LoadBalancerName != lb.LoadBalancerName {
+		conflicts = append(conflicts, fmt.Sprintf("name %s", request.LoadBalancerName))
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("[SharedGroupConflict] %s conflicts with shared loadbalancer [%s], "+
+		"loadbalancer attributes are managed by the owner service %s of the group",
+		strings.Join(conflicts, ", "), lb.LoadBalancerId, owner)
+}
+
+// FindLoadBalancerBySharedGroup find shared loadbalancer by group tag within this cluster.
+func (s *LoadBalancerClient) FindLoadBalancerBySharedGroup(ctx context.Context, group string) (bool, *slb.LoadBalancerType, error) {
+	items, err := json.Marshal(
+		[]slb.TagItem{
+			{
+				TagKey:   SHAREDKEY,
+				TagValue: group,
+			},
+			{
+				TagKey:   ACKKEY,
+				TagValue: CLUSTER_ID,
+			},
+		},
+	)
+	if err != nil {
+		return false, nil, err
+	}
+	lbs, err := s.c.DescribeLoadBalancers(
+		ctx,
+		&slb.DescribeLoadBalancersArgs{
+			Tags:     string(items),
+			RegionId: s.Region(),
+		},
+	)
+	klog.V(2).Infof("find shared loadbalancer by tags [%s]", string(items))
+	if err != nil {
+		return false, nil, err
+	}
+	if len(lbs) == 0 {
+		return false, nil, nil
+	}
+	if len(lbs) > 1 {
+		klog.Warningf("alicloud: multiple loadbalancer returned for shared group [%s], "+
+			"using the first one with IP=%s", group, lbs[0].Address)
+	}
+	lb, err := s.c.DescribeLoadBalancerAttribute(ctx, lbs[0].LoadBalancerId)
+	return err == nil, lb, err
+}
+
+// checkSharedListenerConflict a listener port on shared loadbalancer belongs to
+// exactly one service. Report the owner when the port is taken by someone else.
+func checkSharedListenerConflict(svc *v1.Service, remote *Listener) error {
+	if !isSharedLoadBalancer(svc) || isManagedByMyService(svc, remote) {
+		return nil
+	}
+	owner := fmt.Sprintf("user managed listener [%s]", remote.Name)
+	if remote.NamedKey != nil {
+		owner = fmt.Sprintf("service %s/%s", remote.NamedKey.Namespace, remote.NamedKey.ServiceName)
+		if remote.NamedKey.CID != CLUSTER_ID {
+			owner = fmt.Sprintf("%s of cluster %s", owner, remote.NamedKey.CID)
+		}
+	}
+	return fmt.Errorf("[PortConflict] port %d of shared loadbalancer [%s] is already used by %s",
+		remote.Port, remote.LoadBalancerID, owner)
+}
+
+// sharedGroupMembers return the listeners left on the shared loadbalancer.
+func sharedGroupMembers(lb *slb.LoadBalancerType) []string {
+	var members []string
+	for _, lis := range lb.ListenerPortsAndProtocol.ListenerPortAndProtocol {
+		members = append(members, fmt.Sprintf("%d:%s", lis.ListenerPort, lis.Description))
+	}
+	return members
+}
+
+// ensureSharedLoadBalancerDeleted remove listeners and vgroups owned by the service,
+// slb is deleted only when the last member goes away.
+func (s *LoadBalancerClient) ensureSharedLoadBalancerDeleted(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
+	err := EnsureListenersDeleted(ctx, s.c, service, lb, BuildVirtualGroupFromService(s, service, lb))
+	if err != nil {
+		return err
+	}
+	lb, err = s.c.DescribeLoadBalancerAttribute(ctx, lb.LoadBalancerId)
+	if err != nil {
+		return err
+	}
+	if members := sharedGroupMembers(lb); len(members) > 0 {
+		utils.Logf(service, "shared loadbalancer [%s] is still in use by listeners %v, skip deleting.",
+			lb.LoadBalancerId, members)
+		return s.releaseSharedGroupOwner(ctx, service, lb)
+	}
+	utils.Logf(service, "last member of shared loadbalancer [%s] is gone.", lb.LoadBalancerId)
+	return s.deleteOrRetainLoadBalancer(ctx, service, lb)
+}
+
+// releaseSharedGroupOwner give up the ownership when the owner leaves the group,
+// so that another member can take it over.
+func (s *LoadBalancerClient) releaseSharedGroupOwner(ctx context.Context, service *v1.Service, lb *slb.LoadBalancerType) error {
+	tags, _, err := s.c.DescribeTags(
+		ctx,
+		&slb.DescribeTagsArgs{
+			RegionId:       lb.RegionId,
+			LoadBalancerID: lb.LoadBalancerId,
+		})
+	if err != nil {
+		return err
+	}
+	if getSharedGroupOwner(tags) != getSharedGroupMember(service) {
+		return nil
+	}
+	items, err := json.Marshal([]slb.TagItem{{TagKey: SHAREDOWNERKEY, TagValue: getSharedGroupMember(service)}})
+	if err != nil {
+		return err
+	}
+	utils.Logf(service, "release the ownership of shared loadbalancer [%s]", lb.LoadBalancerId)
+	return s.c.RemoveTags(
+		ctx,
+		&slb.RemoveTagsArgs{
+			RegionId:       lb.RegionId,
+			LoadBalancerID: lb.LoadBalancerId,
+			Tags:           string(items),
+		},
+	)
+}
@@ -0,0 +1,341 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/ecs"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"sort"
+	"strings"
+)
+
+// resource types of TagResources api
+const (
+	TagResourceACL          = "acl"
+	TagResourceVServerGroup = "vservergroup"
+	TagResourceEIP          = "EIP"
+)
+
+// ResourceTag tag of TagResources api
+type ResourceTag struct {
+	Key   string
+	Value string
+}
+
+// TagResourcesArgs TagResources is not provided by the sdk.
+type TagResourcesArgs struct {
+	RegionId     common.Region
+	ResourceType string
+	ResourceId   []string `query:"list"`
+	Tag          []ResourceTag
+}
+
+// UntagResourcesArgs UntagResources is not provided by the sdk.
+type UntagResourcesArgs struct {
+	RegionId     common.Region
+	ResourceType string
+	ResourceId   []string `query:"list"`
+	TagKey       []string `query:"list"`
+}
+
+// ListTagResourcesArgs ListTagResources is not provided by the sdk.
+type ListTagResourcesArgs struct {
+	RegionId     common.Region
+	ResourceType string
+	ResourceId   []string `query:"list"`
+	NextToken    string
+}
+
+// TagResourceType tag of a resource
+type TagResourceType struct {
+	ResourceId   string
+	ResourceType string
+	TagKey       string
+	TagValue     string
+}
+
+type ListTagResourcesResponse struct {
+	common.Response
+	NextToken    string
+	TagResources struct {
+		TagResource []TagResourceType
+	}
+}
+
+// TagResourcesSDK tag api shared by slb and vpc
+type TagResourcesSDK interface {
+	TagResources(ctx context.Context, args *TagResourcesArgs) error
+	UntagResources(ctx context.Context, args *UntagResourcesArgs) error
+	ListTagResources(ctx context.Context, args *ListTagResourcesArgs) (tags []TagResourceType, err error)
+}
+
+// EipSDK vpc client to describe and tag eips in the region of slb
+type EipSDK interface {
+	TagResourcesSDK
+	DescribeEipAddresses(ctx context.Context, args *ecs.DescribeEipAddressesArgs) (eipAddresses []ecs.EipAddressSetType, pagination *common.PaginationResult, err error)
+}
+
+// isSystemTag tags maintained by ccm or cloud, which are never reconciled
+// with additional-resource-tags.
+func isSystemTag(key string) bool {
+	switch key {
+	case TAGKEY, REUSEKEY, ACKKEY, SHAREDKEY, SHAREDOWNERKEY, NAMESPACEKEY, RELEASEDKEY, DUALSTACKIPV6KEY:
+		return true
+	}
+	return strings.HasPrefix(key, "acs:") || strings.HasPrefix(key, "aliyun")
+}
+
+// getUserTags return tags of additional-resource-tags without system tags
+func getUserTags(service *v1.Service) map[string]string {
+	tags := getLoadBalancerAdditionalTags(getBackwardsCompatibleAnnotation(service.Annotations))
+	for k := range tags {
+		if isSystemTag(k) {
+			delete(tags, k)
+		}
+	}
+	return tags
+}
+
+// diffTags compute tags to add and tags to remove.
+// Tags with a changed value are in both sets. Tags which are not desired
+// are removed only when they were applied before, so that tags added by
+// others are kept. System tags are never touched.
+func diffTags(desired, current, applied map[string]string) (add, remove map[string]string) {
+	add, remove = map[string]string{}, map[string]string{}
+	for k, v := range desired {
+		if isSystemTag(k) {
+			continue
+		}
+		old, ok := current[k]
+		if ok && old == v {
+			continue
+		}
+		if ok {
+			remove[k] = old
+		}
+		add[k] = v
+	}
+	for k, v := range current {
+		if _, ok := applied[k]; !ok || isSystemTag(k) {
+			continue
+		}
+		if _, ok := desired[k]; !ok {
+			remove[k] = v
+		}
+	}
+	return add, remove
+}
+
+func tagItems(tags map[string]string) []slb.TagItem {
+	var items []slb.TagItem
+	for k, v := range tags {
+		items = append(items, slb.TagItem{TagKey: k, TagValue: v})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].TagKey < items[j].TagKey })
+	return items
+}
+
+// ensureLoadBalancerTags reconcile additional-resource-tags of slb.
+// Tags applied by ccm are pruned only on the slb created by ccm for this
+// service, tags of reused or shared slb are only added.
+func (s *LoadBalancerClient) ensureLoadBalancerTags(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	tags []slb.TagItemType,
+) error {
+	current := make(map[string]string)
+	for _, tag := range tags {
+		current[tag.TagKey] = tag.TagValue
+	}
+	var applied map[string]string
+	if isLoadBalancerHasTag(tags) &&
+		!isUserDefinedLoadBalancer(service) &&
+		!isSharedLoadBalancer(service) {
+		applied = getAppliedTags(service, lb.LoadBalancerId)
+	}
+	add, remove := diffTags(getUserTags(service), current, applied)
+	if len(remove) > 0 {
+		items, err := json.Marshal(tagItems(remove))
+		if err != nil {
+			return err
+		}
+		utils.Logf(service, "remove tags %s from loadbalancer %s", items, lb.LoadBalancerId)
+		if err := s.c.RemoveTags(
+			ctx,
+			&slb.RemoveTagsArgs{
+				RegionId:       lb.RegionId,
+				LoadBalancerID: lb.LoadBalancerId,
+				Tags:           string(items),
+			},
+		); err != nil {
+			return fmt.Errorf("remove loadbalancer tags: %s", err.Error())
+		}
+	}
+	if len(add) > 0 {
+		utils.Logf(service, "add tags %v to loadbalancer %s", add, lb.LoadBalancerId)
+		if err := addSLBTag(s.c, ctx, add, lb.RegionId, lb.LoadBalancerId); err != nil {
+			return fmt.Errorf("add loadbalancer tags: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// ensureResourceTags reconcile additional-resource-tags of the resources
+// which are related to the slb of the service. Only applied tags are pruned.
+func ensureResourceTags(
+	ctx context.Context,
+	client TagResourcesSDK,
+	service *v1.Service,
+	region common.Region,
+	resourceType string,
+	ids []string,
+	applied map[string]string,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	remote, err := client.ListTagResources(
+		ctx,
+		&ListTagResourcesArgs{
+			RegionId:     region,
+			ResourceType: resourceType,
+			ResourceId:   ids,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("list %s tags: %s", resourceType, err.Error())
+	}
+	current := make(map[string]map[string]string)
+	for _, tag := range remote {
+		if current[tag.ResourceId] == nil {
+			current[tag.ResourceId] = make(map[string]string)
+		}
+		current[tag.ResourceId][tag.TagKey] = tag.TagValue
+	}
+	desired := getUserTags(service)
+	for _, id := range ids {
+		add, remove := diffTags(desired, current[id], applied)
+		if len(remove) > 0 {
+			var keys []string
+			for k := range remove {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			utils.Logf(service, "remove tags %v from %s %s", keys, resourceType, id)
+			if err := client.UntagResources(
+				ctx,
+				&UntagResourcesArgs{
+					RegionId:     region,
+					ResourceType: resourceType,
+					ResourceId:   []string{id},
+					TagKey:       keys,
+				},
+			); err != nil {
+				return fmt.Errorf("untag %s %s: %s", resourceType, id, err.Error())
+			}
+		}
+		if len(add) > 0 {
+			var tags []ResourceTag
+			for _, item := range tagItems(add) {
+				tags = append(tags, ResourceTag{Key: item.TagKey, Value: item.TagValue})
+			}
+			utils.Logf(service, "add tags %v to %s %s", add, resourceType, id)
+			if err := client.TagResources(
+				ctx,
+				&TagResourcesArgs{
+					RegionId:     region,
+					ResourceType: resourceType,
+					ResourceId:   []string{id},
+					Tag:          tags,
+				},
+			); err != nil {
+				return fmt.Errorf("tag %s %s: %s", resourceType, id, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// ensureRelatedResourceTags apply additional-resource-tags to vserver groups,
+// acl and eips of the slb. Tags applied to the acl and eips are pruned the
+// same way as the slb, and only on the acl and eips recorded for the slb.
+func (s *LoadBalancerClient) ensureRelatedResourceTags(
+	ctx context.Context,
+	service *v1.Service,
+	lb *slb.LoadBalancerType,
+	vgs *vgroups,
+) error {
+	var ids []string
+	for _, vg := range *vgs {
+		if vg.VGroupId != "" {
+			ids = append(ids, vg.VGroupId)
+		}
+	}
+	// vserver groups are owned by the service even on shared slb
+	if err := ensureResourceTags(ctx, s.c, service, lb.RegionId,
+		TagResourceVServerGroup, ids, getAppliedTags(service, lb.LoadBalancerId)); err != nil {
+		return err
+	}
+
+	var recorded *utils.LoadBalancerResource
+	if !isUserDefinedLoadBalancer(service) && !isSharedLoadBalancer(service) {
+		recorded = getRecordedLoadBalancer(service, lb.LoadBalancerId)
+	}
+	defaulted, _ := ExtractAnnotationRequest(service)
+	if defaulted.AclID != "" {
+		var applied map[string]string
+		if recorded != nil && recorded.AclId == defaulted.AclID {
+			applied = recorded.Tags
+		}
+		if err := ensureResourceTags(ctx, s.c, service, lb.RegionId,
+			TagResourceACL, []string{defaulted.AclID}, applied); err != nil {
+			return err
+		}
+	}
+
+	if s.eip == nil {
+		return nil
+	}
+	eips, _, err := s.eip.DescribeEipAddresses(
+		ctx,
+		&ecs.DescribeEipAddressesArgs{
+			RegionId:               lb.RegionId,
+			AssociatedInstanceType: ecs.AssociatedInstanceTypeSlbInstance,
+			AssociatedInstanceId:   lb.LoadBalancerId,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("describe eips of loadbalancer %s: %s", lb.LoadBalancerId, err.Error())
+	}
+	// eips associated after the last successful reconcile were not tagged by ccm
+	var tagged, others []string
+	for _, eip := range eips {
+		if recorded != nil && hasString(recorded.EipIds, eip.AllocationId) {
+			tagged = append(tagged, eip.AllocationId)
+		} else {
+			others = append(others, eip.AllocationId)
+		}
+	}
+	var applied map[string]string
+	if recorded != nil {
+		applied = recorded.Tags
+	}
+	if err := ensureResourceTags(ctx, s.eip, service, lb.RegionId, TagResourceEIP, tagged, applied); err != nil {
+		return err
+	}
+	return ensureResourceTags(ctx, s.eip, service, lb.RegionId, TagResourceEIP, others, nil)
+}
+
+func hasString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -40,7 +40,11 @@ type localService struct {
 
 type kvstore struct {
 	store map[string]int64
-	lock  sync.RWMutex
+	// zones zone id of the records keyed by service uid
+	zones map[string]string
+	// backend persist the records, records are kept in memory only if nil
+	backend recordBackend
+	lock    sync.RWMutex
 }
 
 func InitCache() {
@@ -49,6 +53,7 @@ func InitCache() {
 	}
 	serviceCache = &kvstore{
 		store: map[string]int64{},
+		zones: map[string]string{},
 	}
 }
 func init() {
@@ -98,6 +103,19 @@ func (kv *kvstore) remove(key string) {
 	delete(kv.store, key)
 }
 
+// list return a copy of the entries with the key prefix
+func (kv *kvstore) list(prefix string) map[string]int64 {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	result := make(map[string]int64)
+	for k, v := range kv.store {
+		if strings.HasPrefix(k, prefix) {
+			result[k] = v
+		}
+	}
+	return result
+}
+
 // NodeList return nodes list in string
 func NodeList(nodes []*v1.Node) []string {
 	ns := []string{}
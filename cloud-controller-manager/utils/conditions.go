@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// condition types of service, updated on each reconcile.
+const (
+	ConditionLoadBalancerProvisioned = "LoadBalancerProvisioned"
+	ConditionListenersSynced         = "ListenersSynced"
+	ConditionBackendsSynced          = "BackendsSynced"
+	ConditionDNSRecordSynced         = "DNSRecordSynced"
+)
+
+// ConditionTypes all condition types maintained by ccm, in reconcile order.
+var ConditionTypes = []string{
+	ConditionLoadBalancerProvisioned,
+	ConditionListenersSynced,
+	ConditionBackendsSynced,
+	ConditionDNSRecordSynced,
+}
+
+// ConditionReasonSynced reason of a phase which succeeded
+const ConditionReasonSynced = "Synced"
+
+// SyncCondition result of a reconcile phase
+type SyncCondition struct {
+	Type    string
+	Synced  bool
+	Reason  string
+	Message string
+}
+
+// SyncConditions results of the reconcile phases of a service
+type SyncConditions struct {
+	lock       sync.Mutex
+	conditions map[string]*SyncCondition
+}
+
+// Set record the result of a phase, reason is used when the phase failed.
+// A failure is never overridden by a later success in the same reconcile,
+// eg. the ipv6 half of dual stack.
+func (s *SyncConditions) Set(ctype, reason string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conditions == nil {
+		s.conditions = make(map[string]*SyncCondition)
+	}
+	if old, ok := s.conditions[ctype]; ok && !old.Synced && err == nil {
+		return
+	}
+	cond := &SyncCondition{Type: ctype, Synced: true, Reason: ConditionReasonSynced}
+	if err != nil {
+		cond.Synced, cond.Reason, cond.Message = false, reason, err.Error()
+	}
+	s.conditions[ctype] = cond
+}
+
+// Skip record a phase which is not required, eg. no dns record is configured.
+func (s *SyncConditions) Skip(ctype, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conditions == nil {
+		s.conditions = make(map[string]*SyncCondition)
+	}
+	if _, ok := s.conditions[ctype]; ok {
+		return
+	}
+	s.conditions[ctype] = &SyncCondition{Type: ctype, Synced: true, Reason: reason}
+}
+
+// Get return the result of a phase, nil if the phase is not reached.
+func (s *SyncConditions) Get(ctype string) *SyncCondition {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conditions[ctype]
+}
+
+// GetConditionsFromContext return the conditions requested by controller
+func GetConditionsFromContext(ctx context.Context) (*SyncConditions, error) {
+	conditions := ctx.Value(ContextConditions)
+	if conditions == nil {
+		return nil, fmt.Errorf("conditions in context is nil")
+	}
+
+	c, ok := conditions.(*SyncConditions)
+	if !ok {
+		return nil, fmt.Errorf("expect SyncConditions type, got %s", reflect.TypeOf(conditions))
+	}
+
+	return c, nil
+}
+
+// RecordCondition record the result of a reconcile phase in context, reason
+// is used when err is not nil. It returns err as is, so that it can wrap the
+// return of a phase.
+func RecordCondition(ctx context.Context, ctype, reason string, err error) error {
+	conditions, cerr := GetConditionsFromContext(ctx)
+	if cerr != nil {
+		return err
+	}
+	conditions.Set(ctype, reason, err)
+	return err
+}
@@ -7,6 +7,18 @@ const (
 	BACKEND_TYPE_ENI                                      = "eni"
 	BACKEND_TYPE_ECS                                      = "ecs"
 	ServiceAnnotationLoadBalancerRemoveUnscheduledBackend = "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-remove-unscheduled-backend"
+	// ServiceAnnotationLoadBalancerPauseReconcile skip all cloud mutations of the service when set to on
+	ServiceAnnotationLoadBalancerPauseReconcile = "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-pause-reconcile"
+	// ServiceAnnotationLoadBalancerObservedState observed loadbalancer state of a paused service
+	ServiceAnnotationLoadBalancerObservedState = "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-observed-state"
+	// ServiceAnnotationLoadBalancerResources cloud resources managed by ccm for the service, in json
+	ServiceAnnotationLoadBalancerResources = "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-resources"
+	// ServiceAnnotationPrivateZoneRecords ids of the private zone records created by ccm for the service, in json
+	ServiceAnnotationPrivateZoneRecords = "service.beta.kubernetes.io/alibaba-cloud-private-zone-records"
+	// ServiceAnnotationPrivateZoneEnable publish private zone records for ClusterIP or headless service when set to on
+	ServiceAnnotationPrivateZoneEnable = "service.beta.kubernetes.io/alibaba-cloud-private-zone-enable"
+	// ServiceAnnotationPrivateZoneRecordName name of the private zone records of the service
+	ServiceAnnotationPrivateZoneRecordName = "service.beta.kubernetes.io/alibaba-cloud-private-zone-record-name"
 	// LabelNodeRoleExcludeNodeDeprecated specifies that the node should be exclude from CCM
 	LabelNodeRoleExcludeNodeDeprecated = "service.beta.kubernetes.io/exclude-node"
 	LabelNodeRoleExcludeNode           = "service.alibabacloud.com/exclude-node"
@@ -17,4 +29,6 @@ const (
 	ECINodeLabel                            = "virtual-kubelet"
 	ContextService               contextKey = "request.service"
 	ContextRecorder              contextKey = "context.recorder"
+	ContextResources             contextKey = "context.resources"
+	ContextConditions            contextKey = "context.conditions"
 )
\ No newline at end of file
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ManagedResources cloud resources managed by ccm for a service.
+// It is recorded in the resources annotation after each successful reconcile.
+type ManagedResources struct {
+	lock          sync.Mutex
+	LoadBalancers []*LoadBalancerResource `json:"loadBalancers,omitempty"`
+	PublicDNS     *PublicDNSResource      `json:"publicDNS,omitempty"`
+}
+
+// LoadBalancerResource slb and the resources related to it
+type LoadBalancerResource struct {
+	LoadBalancerId    string                     `json:"loadBalancerId"`
+	Region            string                     `json:"region,omitempty"`
+	AddressIPVersion  string                     `json:"addressIPVersion,omitempty"`
+	Listeners         []ListenerResource         `json:"listeners,omitempty"`
+	VServerGroups     []VServerGroupResource     `json:"vServerGroups,omitempty"`
+	AclId             string                     `json:"aclId,omitempty"`
+	EipIds            []string                   `json:"eipIds,omitempty"`
+	PrivateZoneRecord *PrivateZoneRecordResource `json:"privateZoneRecord,omitempty"`
+	// Tags additional-resource-tags applied by ccm, only these are pruned
+	// when removed from the annotation.
+	Tags map[string]string `json:"tags,omitempty"`
+	// SessionPersistence session persistence of listeners is derived from
+	// ClientIP session affinity by ccm, it is cleared once affinity is removed.
+	SessionPersistence bool `json:"sessionPersistence,omitempty"`
+}
+
+// ListenerResource listener of slb
+type ListenerResource struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// VServerGroupResource vserver group of slb
+type VServerGroupResource struct {
+	VGroupId string `json:"vGroupId"`
+	Name     string `json:"name"`
+	Backends int    `json:"backends"`
+}
+
+// PrivateZoneRecordResource private zone record pointing to slb
+type PrivateZoneRecordResource struct {
+	ZoneId   string `json:"zoneId"`
+	RecordId string `json:"recordId"`
+	Rr       string `json:"rr"`
+	Value    string `json:"value"`
+}
+
+// PublicDNSResource public dns records published for the service
+type PublicDNSResource struct {
+	Domain string   `json:"domain"`
+	Rr     string   `json:"rr"`
+	IPs    []string `json:"ips,omitempty"`
+}
+
+// SetPublicDNS record the public dns records published for the service
+func (m *ManagedResources) SetPublicDNS(published *PublicDNSResource) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.PublicDNS = published
+}
+
+// LoadBalancer return the record of slb, a new record is added when not found.
+func (m *ManagedResources) LoadBalancer(id string) *LoadBalancerResource {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, lb := range m.LoadBalancers {
+		if lb.LoadBalancerId == id {
+			return lb
+		}
+	}
+	lb := &LoadBalancerResource{LoadBalancerId: id}
+	m.LoadBalancers = append(m.LoadBalancers, lb)
+	return lb
+}
+
+func GetResourcesFromContext(ctx context.Context) (*ManagedResources, error) {
+	resources := ctx.Value(ContextResources)
+	if resources == nil {
+		return nil, fmt.Errorf("resources in context is nil")
+	}
+
+	r, ok := resources.(*ManagedResources)
+	if !ok {
+		return nil, fmt.Errorf("expect ManagedResources type, got %s", reflect.TypeOf(resources))
+	}
+
+	return r, nil
+}
@@ -94,7 +94,29 @@ func IsServiceHashChanged(service *v1.Service) (bool, error) {
 }
 
 func GetServiceHash(service *v1.Service) (string, error) {
-	return HashObjects([]interface{}{service.Spec, service.Annotations})
+	return HashObjects([]interface{}{service.Spec, SpecAnnotations(service.Annotations)})
+}
+
+// SpecAnnotations return annotations without the ones written by ccm,
+// which are not part of the desired state.
+func SpecAnnotations(annotations map[string]string) map[string]string {
+	_, observed := annotations[ServiceAnnotationLoadBalancerObservedState]
+	_, resources := annotations[ServiceAnnotationLoadBalancerResources]
+	_, records := annotations[ServiceAnnotationPrivateZoneRecords]
+	if !observed && !resources && !records {
+		return annotations
+	}
+	result := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		result[k] = v
+	}
+	delete(result, ServiceAnnotationLoadBalancerObservedState)
+	delete(result, ServiceAnnotationLoadBalancerResources)
+	delete(result, ServiceAnnotationPrivateZoneRecords)
+	if len(result) == 0 {
+		return nil
+	}
+	return result
 }
 
 func GetRecorderFromContext(ctx context.Context) (record.EventRecorder, error) {
@@ -474,7 +474,7 @@ func BuildVirtualGroupFromService(
 			},
 			LoadBalancerId: slbins.LoadBalancerId,
 			Client:         client.c,
-			RegionId:       common.Region(client.region),
+			RegionId:       client.Region(),
 			InsClient:      client.ins,
 			VpcID:          client.vpcid,
 		}
@@ -494,7 +494,7 @@ func BuildVirtualGroupFromRemoteAPI(
 ) (vgroups, error) {
 	vgrps := vgroups{}
 	vargs := slb.DescribeVServerGroupsArgs{
-		RegionId:       common.Region(slbins.region),
+		RegionId:       slbins.Region(),
 		LoadBalancerId: lb.LoadBalancerId,
 	}
 	vgrp, err := slbins.c.DescribeVServerGroups(ctx, &vargs)
@@ -517,7 +517,7 @@ func BuildVirtualGroupFromRemoteAPI(
 				VpcID:          slbins.vpcid,
 				InsClient:      slbins.ins,
 				Client:         slbins.c,
-				RegionId:       common.Region(slbins.region),
+				RegionId:       slbins.Region(),
 				VGroupId:       val.VServerGroupId,
 			},
 		)
@@ -0,0 +1,173 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/ecs"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"sort"
+	"strings"
+)
+
+// DescribeVSwitchesArgs ecs.DescribeVSwitchesArgs does not support tag filter.
+type DescribeVSwitchesArgs struct {
+	RegionId  common.Region
+	VpcId     string
+	VSwitchId string
+	ZoneId    string
+	Tag       map[string]string
+	common.Pagination
+}
+
+// VSwitchSDK vpc client sdk for vswitch
+type VSwitchSDK interface {
+	DescribeVSwitches(ctx context.Context, args *DescribeVSwitchesArgs) (vswitches []ecs.VSwitchSetType, pagination *common.PaginationResult, err error)
+}
+
+// VSwitchSelector select vswitch for intranet slb from candidates
+// configured by vswitch ids or vswitch tags.
+type VSwitchSelector struct {
+	c    VSwitchSDK
+	ids  []string
+	tags map[string]string
+}
+
+// Enabled whether candidate vswitches are configured
+func (v *VSwitchSelector) Enabled() bool {
+	return v != nil && (len(v.ids) != 0 || len(v.tags) != 0)
+}
+
+// Candidates return candidate vswitches of the vpc, sorted by available ip count.
+// Both ids and tags must match when they are configured together.
+func (v *VSwitchSelector) Candidates(ctx context.Context, region common.Region, vpcid string) ([]ecs.VSwitchSetType, error) {
+	ids := make(map[string]bool)
+	for _, id := range v.ids {
+		ids[id] = true
+	}
+	var candidates []ecs.VSwitchSetType
+	pagination := common.Pagination{PageNumber: 1, PageSize: 50}
+	for {
+		vswitches, result, err := v.c.DescribeVSwitches(ctx,
+			&DescribeVSwitchesArgs{
+				RegionId:   region,
+				VpcId:      vpcid,
+				Tag:        v.tags,
+				Pagination: pagination,
+			})
+		if err != nil {
+			return nil, fmt.Errorf("alicloud: describe vswitches of vpc %s error: %s", vpcid, err.Error())
+		}
+		for _, vsw := range vswitches {
+			if len(ids) != 0 && !ids[vsw.VSwitchId] {
+				continue
+			}
+			candidates = append(candidates, vsw)
+		}
+		if result == nil {
+			break
+		}
+		next := result.NextPage()
+		if next == nil {
+			break
+		}
+		pagination = *next
+	}
+	sort.SliceStable(
+		candidates,
+		func(i, j int) bool {
+			return candidates[i].AvailableIpAddressCount > candidates[j].AvailableIpAddressCount
+		},
+	)
+	return candidates, nil
+}
+
+// selectVSwitch pick the candidate vswitch with the most available ips for
+// intranet slb. Vswitch in the selected master zone is preferred, then the
+// selected slave zone which becomes the master zone. Other zones are used only
+// when master zone is not specified by user, and the final zones are reported.
+func (s *LoadBalancerClient) selectVSwitch(
+	ctx context.Context,
+	service *v1.Service,
+	args *slb.CreateLoadBalancerArgs,
+) error {
+	if args.VSwitchId != "" || !s.vswitch.Enabled() {
+		return nil
+	}
+	defaulted, request := ExtractAnnotationRequest(service)
+	if defaulted.AddressType != slb.IntranetAddressType || defaulted.SLBNetworkType == "classic" {
+		return nil
+	}
+	candidates, err := s.vswitch.Candidates(ctx, s.Region(), s.vpcid)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("alicloud: no candidate vswitch found in vpc %s for intranet loadbalancer", s.vpcid)
+	}
+	var ids []string
+	var chosen, slave, fallback *ecs.VSwitchSetType
+	for i := range candidates {
+		vsw := &candidates[i]
+		ids = append(ids, vsw.VSwitchId)
+		if vsw.AvailableIpAddressCount <= 0 ||
+			vsw.Status != "" && vsw.Status != ecs.VSwitchStatusAvailable {
+			continue
+		}
+		if fallback == nil {
+			fallback = vsw
+		}
+		if chosen == nil && (args.MasterZoneId == "" || vsw.ZoneId == args.MasterZoneId) {
+			chosen = vsw
+		}
+		if slave == nil && args.SlaveZoneId != "" && vsw.ZoneId == args.SlaveZoneId {
+			slave = vsw
+		}
+	}
+	if fallback == nil {
+		return fmt.Errorf("alicloud: all candidate vswitches [%s] are exhausted, "+
+			"no ip address available for intranet loadbalancer", strings.Join(ids, ","))
+	}
+	if chosen == nil {
+		if request.MasterZoneID != "" {
+			return fmt.Errorf("alicloud: no candidate vswitch with available ip address "+
+				"in master zone %s, candidates [%s]", request.MasterZoneID, strings.Join(ids, ","))
+		}
+		if slave != nil && request.SlaveZoneID == "" {
+			// keep the selected zone pair with master and slave swapped if
+			// the reversed pair has stock, otherwise slave zone is left to slb
+			master := args.MasterZoneId
+			args.MasterZoneId, args.SlaveZoneId = args.SlaveZoneId, ""
+			if s.hasZonePair(ctx, args, master) {
+				args.SlaveZoneId = master
+			}
+			chosen = slave
+		} else {
+			chosen = fallback
+		}
+	}
+	if chosen.ZoneId != args.MasterZoneId {
+		// zone of slb is determined by vswitch
+		selected := args.MasterZoneId
+		args.MasterZoneId = chosen.ZoneId
+		args.SlaveZoneId = ""
+		if selected != "" {
+			msg := fmt.Sprintf("No candidate vswitch in selected zone %s, select master zone %s of vswitch %s",
+				selected, args.MasterZoneId, chosen.VSwitchId)
+			record, err := utils.GetRecorderFromContext(ctx)
+			if err != nil {
+				klog.Warningf("get recorder error: %s", err.Error())
+				utils.Logf(service, "%s", msg)
+			} else {
+				record.Event(service, v1.EventTypeNormal, "ZoneSelected", msg)
+			}
+		}
+	}
+	args.VSwitchId = chosen.VSwitchId
+	utils.Logf(service, "select vswitch %s in zone %s with %d available ips",
+		chosen.VSwitchId, chosen.ZoneId, chosen.AvailableIpAddressCount)
+	return nil
+}
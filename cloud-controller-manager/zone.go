@@ -0,0 +1,205 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	"github.com/denverdino/aliyungo/common"
+	"github.com/denverdino/aliyungo/slb"
+	"k8s.io/api/core/v1"
+	"k8s.io/cloud-provider-alibaba-cloud/cloud-controller-manager/utils"
+	"k8s.io/klog"
+	"sort"
+)
+
+// DescribeAvailableResourceArgs DescribeAvailableResource is not provided by the slb sdk.
+type DescribeAvailableResourceArgs struct {
+	RegionId         common.Region
+	AddressType      string
+	AddressIPVersion string
+}
+
+// SupportResourceType address type and ip version which has stock in a zone pair
+type SupportResourceType struct {
+	AddressType      string
+	AddressIPVersion string
+}
+
+// AvailableResourceType master/slave zone pair of slb
+type AvailableResourceType struct {
+	MasterZoneId     string
+	SlaveZoneId      string
+	SupportResources struct {
+		SupportResource []SupportResourceType
+	}
+}
+
+type DescribeAvailableResourceResponse struct {
+	common.Response
+	AvailableResources struct {
+		AvailableResource []AvailableResourceType
+	}
+}
+
+// nodeZone return the zone label of node
+func nodeZone(node *v1.Node) string {
+	if zone, ok := node.Labels[v1.LabelZoneFailureDomainStable]; ok {
+		return zone
+	}
+	return node.Labels[v1.LabelZoneFailureDomain]
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// countBackendZones count ready backend nodes of the service in each zone.
+// Only nodes with local endpoints are counted for Local service.
+func countBackendZones(nodes *EndpointWithENI) map[string]int {
+	hosts := make(map[string]bool)
+	if nodes.LocalMode && nodes.Endpoints != nil {
+		for _, sub := range nodes.Endpoints.Subsets {
+			for _, addr := range sub.Addresses {
+				if addr.NodeName != nil {
+					hosts[*addr.NodeName] = true
+				}
+			}
+		}
+	}
+	zones := make(map[string]int)
+	for _, node := range nodes.Nodes {
+		if !isNodeReady(node) {
+			continue
+		}
+		if len(hosts) != 0 && !hosts[node.Name] {
+			continue
+		}
+		if zone := nodeZone(node); zone != "" {
+			zones[zone]++
+		}
+	}
+	return zones
+}
+
+// selectZones pick the master/slave zone pair with the most ready backend
+// nodes among the zones which have slb stock for the requested spec.
+// The zones are chosen by slb when no candidate is found.
+func (s *LoadBalancerClient) selectZones(
+	ctx context.Context,
+	service *v1.Service,
+	nodes *EndpointWithENI,
+	args *slb.CreateLoadBalancerArgs,
+) {
+	if args.MasterZoneId != "" || args.SlaveZoneId != "" || args.VSwitchId != "" {
+		// zones are specified by user or determined by vswitch
+		return
+	}
+	if nodes == nil {
+		return
+	}
+	counts := countBackendZones(nodes)
+	if len(counts) == 0 {
+		utils.Logf(service, "no ready backend nodes with zone label, leave zone selection to slb")
+		return
+	}
+	resources, err := s.c.DescribeAvailableResource(
+		ctx,
+		&DescribeAvailableResourceArgs{
+			RegionId:         args.RegionId,
+			AddressType:      string(args.AddressType),
+			AddressIPVersion: string(args.AddressIPVersion),
+		},
+	)
+	if err != nil {
+		klog.Warningf("alicloud: describe slb available resource error: %s, "+
+			"leave zone selection to slb", err.Error())
+		return
+	}
+	var candidates []AvailableResourceType
+	for _, res := range resources {
+		if counts[res.MasterZoneId] == 0 || !hasSupportResource(res, args) {
+			continue
+		}
+		candidates = append(candidates, res)
+	}
+	if len(candidates) == 0 {
+		utils.Logf(service, "no zone with both slb stock and backend nodes, leave zone selection to slb")
+		return
+	}
+	sort.SliceStable(
+		candidates,
+		func(i, j int) bool {
+			mi, mj := counts[candidates[i].MasterZoneId], counts[candidates[j].MasterZoneId]
+			if mi != mj {
+				return mi > mj
+			}
+			si, sj := counts[candidates[i].SlaveZoneId], counts[candidates[j].SlaveZoneId]
+			if si != sj {
+				return si > sj
+			}
+			if candidates[i].MasterZoneId != candidates[j].MasterZoneId {
+				return candidates[i].MasterZoneId < candidates[j].MasterZoneId
+			}
+			return candidates[i].SlaveZoneId < candidates[j].SlaveZoneId
+		},
+	)
+	args.MasterZoneId = candidates[0].MasterZoneId
+	args.SlaveZoneId = candidates[0].SlaveZoneId
+
+	msg := fmt.Sprintf("Select master zone %s with %d ready nodes, slave zone %s with %d ready nodes",
+		args.MasterZoneId, counts[args.MasterZoneId], args.SlaveZoneId, counts[args.SlaveZoneId])
+	record, err := utils.GetRecorderFromContext(ctx)
+	if err != nil {
+		klog.Warningf("get recorder error: %s", err.Error())
+		utils.Logf(service, "%s", msg)
+		return
+	}
+	record.Event(service, v1.EventTypeNormal, "ZoneSelected", msg)
+}
+
+func hasSupportResource(res AvailableResourceType, args *slb.CreateLoadBalancerArgs) bool {
+	if len(res.SupportResources.SupportResource) == 0 {
+		return true
+	}
+	addrtype := args.AddressType
+	if addrtype == "" {
+		addrtype = slb.InternetAddressType
+	}
+	ipver := args.AddressIPVersion
+	if ipver == "" {
+		ipver = slb.IPv4
+	}
+	for _, support := range res.SupportResources.SupportResource {
+		if support.AddressType == string(addrtype) &&
+			support.AddressIPVersion == string(ipver) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasZonePair whether slb has stock in the master zone of args with the slave zone.
+func (s *LoadBalancerClient) hasZonePair(ctx context.Context, args *slb.CreateLoadBalancerArgs, slave string) bool {
+	resources, err := s.c.DescribeAvailableResource(
+		ctx,
+		&DescribeAvailableResourceArgs{
+			RegionId:         args.RegionId,
+			AddressType:      string(args.AddressType),
+			AddressIPVersion: string(args.AddressIPVersion),
+		},
+	)
+	if err != nil {
+		klog.Warningf("alicloud: describe slb available resource error: %s", err.Error())
+		return false
+	}
+	for _, res := range resources {
+		if res.MasterZoneId == args.MasterZoneId && res.SlaveZoneId == slave && hasSupportResource(res, args) {
+			return true
+		}
+	}
+	return false
+}
@@ -59,6 +59,19 @@ type ServerCCM struct {
 	Kubeconfig string
 	cloud      cloudprovider.Interface
 
+	// LoadBalancerClass class of the service loadbalancer owned by this controller.
+	LoadBalancerClass string
+
+	// ConcurrentRouteTableSyncs number of route tables whose routes are
+	// created concurrently.
+	ConcurrentRouteTableSyncs int
+
+	// NodeSubnetSource source of the node subnets routed by route controller
+	NodeSubnetSource string
+
+	// NodeSubnetAnnotation node annotation of subnets, used by annotation source
+	NodeSubnetAnnotation string
+
 	// NodeStatusUpdateFrequency is the frequency at which the controller
 	// updates nodes' status
 	NodeStatusUpdateFrequency metav1.Duration
@@ -98,6 +111,8 @@ func NewServerCCM() *ServerCCM {
 			},
 		},
 		NodeStatusUpdateFrequency: metav1.Duration{Duration: 5 * time.Minute},
+		ConcurrentRouteTableSyncs: route.DEFAULT_ROUTE_TABLE_CONCURRENCY,
+		NodeSubnetSource:          route.SUBNET_SOURCE_AUTO,
 	}
 	ccm.Generic.LeaderElection.LeaderElect = true
 	return &ccm
@@ -151,6 +166,7 @@ func (ccm *ServerCCM) initialization() error {
 	}
 
 	alicloud.CloudConfigFile = ccm.KubeCloudShared.CloudProvider.CloudConfigFile
+	alicloud.LoadBalancerClass = ccm.LoadBalancerClass
 	cloud, err := cloudprovider.InitCloudProvider(
 		ccm.KubeCloudShared.CloudProvider.Name,
 		ccm.KubeCloudShared.CloudProvider.CloudConfigFile,
@@ -250,6 +266,9 @@ func Run(ccm *ServerCCM) error {
 		ConfigCloudRoutes:         ccm.KubeCloudShared.ConfigureCloudRoutes,
 		RouteReconciliationPeriod: ccm.KubeCloudShared.RouteReconciliationPeriod,
 		ControllerStartInterval:   ccm.Generic.ControllerStartInterval,
+		ConcurrentRouteTableSyncs: ccm.ConcurrentRouteTableSyncs,
+		NodeSubnetSource:          ccm.NodeSubnetSource,
+		NodeSubnetAnnotation:      ccm.NodeSubnetAnnotation,
 	}
 
 	if !ccm.Generic.LeaderElection.LeaderElect {
@@ -366,6 +385,7 @@ func runControllerService(
 		builder.ClientOrDie("cloud-controller-manager"),
 		informer,
 		ccm.KubeCloudShared.ClusterName,
+		ccm.LoadBalancerClass,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to start service controller: %v", err)
@@ -44,7 +44,7 @@ func AddFlags(ccm *app.ServerCCM, fs *pflag.FlagSet) {
 	fs.BoolVar(&ccm.KubeCloudShared.ConfigureCloudRoutes, "configure-cloud-routes", true, "Should CIDRs allocated by allocate-node-cidrs be configured on the cloud provider.")
 	fs.BoolVar(&ccm.Generic.Debugging.EnableProfiling, "profiling", true, "Enable profiling via web interface host:port/debug/pprof/.")
 	fs.BoolVar(&ccm.Generic.Debugging.EnableContentionProfiling, "contention-profiling", false, "Enable lock contention profiling, if profiling is enabled.")
-	fs.StringVar(&ccm.KubeCloudShared.ClusterCIDR, "cluster-cidr", ccm.KubeCloudShared.ClusterCIDR, "CIDR Range for Pods in cluster.")
+	fs.StringVar(&ccm.KubeCloudShared.ClusterCIDR, "cluster-cidr", ccm.KubeCloudShared.ClusterCIDR, "CIDR Range for Pods in cluster. Comma separated ipv4 and ipv6 ranges for dual-stack cluster.")
 	fs.StringVar(&ccm.KubeCloudShared.ClusterName, "cluster-name", ccm.KubeCloudShared.ClusterName, "The instance prefix for the cluster.")
 	fs.BoolVar(&ccm.KubeCloudShared.AllocateNodeCIDRs, "allocate-node-cidrs", false, "Should CIDRs for Pods be allocated and set on the cloud provider.")
 	fs.StringVar(&ccm.Master, "master", ccm.Master, "The address of the Kubernetes API server (overrides any value in kubeconfig).")
@@ -54,6 +54,10 @@ func AddFlags(ccm *app.ServerCCM, fs *pflag.FlagSet) {
 	fs.Int32Var(&ccm.Generic.ClientConnection.Burst, "kube-api-burst", ccm.Generic.ClientConnection.Burst, "Burst to use while talking with kubernetes apiserver.")
 	fs.DurationVar(&ccm.Generic.ControllerStartInterval.Duration, "controller-start-interval", ccm.Generic.ControllerStartInterval.Duration, "Interval between starting controller managers.")
 	fs.Int32Var(&ccm.ServiceController.ConcurrentServiceSyncs, "concurrent-service-syncs", ccm.ServiceController.ConcurrentServiceSyncs, "The number of services that are allowed to sync concurrently. Larger number = more responsive service management, but more CPU (and network) load")
+	fs.IntVar(&ccm.ConcurrentRouteTableSyncs, "concurrent-route-table-syncs", ccm.ConcurrentRouteTableSyncs, "The number of route tables whose routes are allowed to be created concurrently. Routes of the same table are always created one after another.")
+	fs.StringVar(&ccm.NodeSubnetSource, "node-subnet-source", ccm.NodeSubnetSource, "The source of the pod subnets of nodes to create routes for. One of auto, podcidr, ovn, calico and annotation. auto uses the ovn-kubernetes host subnets if annotated and PodCIDRs otherwise, calico uses the ipam blocks affine to the node.")
+	fs.StringVar(&ccm.NodeSubnetAnnotation, "node-subnet-annotation", ccm.NodeSubnetAnnotation, "The node annotation of comma separated pod subnets, used by node subnet source annotation.")
+	fs.StringVar(&ccm.LoadBalancerClass, "load-balancer-class", ccm.LoadBalancerClass, "The loadbalancer class owned by this controller. Services without class are always processed, services of other classes are skipped. The class of a service is read from annotation service.beta.kubernetes.io/class only, spec.loadBalancerClass is ignored since the Kubernetes API v0.18 this release is built with has no such field.")
 	err := fs.MarkDeprecated("allow-untagged-cloud", "This flag is deprecated and will be removed in a future release. A cluster-id will be required on cloud instances.")
 	if err != nil {
 		klog.Warningf("add flags error: %s", err.Error())